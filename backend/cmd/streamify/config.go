@@ -0,0 +1,546 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/codegen"
+	"github.com/AnishG-git/streamify/internal/files"
+	"github.com/AnishG-git/streamify/internal/ice"
+	"github.com/AnishG-git/streamify/internal/logic"
+	"github.com/AnishG-git/streamify/internal/ratelimit"
+	"github.com/AnishG-git/streamify/internal/recorder"
+	"github.com/AnishG-git/streamify/internal/sfu"
+	"github.com/AnishG-git/streamify/internal/turnserver"
+	"github.com/pion/webrtc/v4"
+)
+
+type config struct {
+	redisAddr      string
+	redisKeyPrefix string
+	// databaseURL is the Postgres database durable data is kept in, it is only kept in Redis when empty
+	databaseURL string
+
+	codes             codegen.Policy
+	defaultCapacity   int
+	maxCapacity       int
+	maxViewerCapacity int
+
+	maxRoomDuration   time.Duration
+	maxScheduleAhead  time.Duration
+	roomEndWarning    time.Duration
+	schedulerInterval time.Duration
+
+	rateLimitBackend string
+	// rateLimitTrustedProxies is how many proxies in front of the server append to X-Forwarded-For
+	rateLimitTrustedProxies int
+	generateLimit           ratelimit.Limit
+	connectLimit            ratelimit.Limit
+	authLimit               ratelimit.Limit
+	iceLimit                ratelimit.Limit
+
+	messageLimits logic.MessageLimits
+	chat          logic.ChatConfig
+	annotations   logic.AnnotationConfig
+	lobbyTimeout  time.Duration
+	kickBan       time.Duration
+
+	ice ice.Config
+
+	turnEmbedded bool
+	turn         turnserver.Config
+
+	sfuEnabled     bool
+	sfu            sfu.Config
+	maxSFUCapacity int
+
+	recordingEnabled bool
+	recording        recorder.Config
+
+	filesEnabled bool
+	files        files.Config
+
+	// webhooksFile lists the webhook endpoints, webhooks are disabled when it is empty
+	webhooksFile        string
+	webhookPollInterval time.Duration
+
+	// auditStream and auditFile are the sinks of the audit log, it is disabled when neither is set
+	auditStream       bool
+	auditStreamMaxLen int
+	auditFile         string
+	// auditPostgres also writes the audit log to Postgres when databaseURL is set
+	auditPostgres bool
+	// adminToken authorizes the admin endpoints, they are disabled when it is empty
+	adminToken string
+
+	// accounts need databaseURL, members join with just a name without them
+	authSessionTTL time.Duration
+	// authExternalSecret verifies identity assertions, external sign-in is disabled when it is empty
+	authExternalSecret  string
+	authExternalIssuers []string
+	authRequireAccount  bool
+}
+
+// loadConfig reads the server configuration from the environment, falling back to defaults
+func loadConfig() (*config, error) {
+	cfg := &config{
+		redisAddr:      envString("REDIS_ADDR", "redis:6379"),
+		redisKeyPrefix: envString("REDIS_KEY_PREFIX", "streamify:"),
+		databaseURL:    envString("DATABASE_URL", ""),
+
+		rateLimitBackend: envString("RATE_LIMIT_BACKEND", "memory"),
+	}
+
+	var generator codegen.Generator
+	var defaultLength int
+	switch style := envString("ROOM_CODE_STYLE", "charset"); style {
+	case "charset":
+		charset := envString("ROOM_CODE_CHARSET", codegen.DefaultCharset)
+		// codes are matched case-insensitively by upper-casing what members type
+		if charset != strings.ToUpper(charset) {
+			return nil, fmt.Errorf("ROOM_CODE_CHARSET must not contain lower case letters")
+		}
+		generator = codegen.CharsetGenerator{Charset: charset}
+		defaultLength = 5
+	case "words":
+		// word codes count words rather than characters
+		generator = codegen.WordGenerator{Separator: "-"}
+		defaultLength = 3
+	default:
+		return nil, fmt.Errorf("unknown ROOM_CODE_STYLE %q", style)
+	}
+
+	length, err := envInt("ROOM_CODE_LENGTH", defaultLength)
+	if err != nil {
+		return nil, err
+	}
+	maxLength, err := envInt("ROOM_CODE_MAX_LENGTH", length+3)
+	if err != nil {
+		return nil, err
+	}
+	attempts, err := envInt("ROOM_CODE_ATTEMPTS", 10)
+	if err != nil {
+		return nil, err
+	}
+	cfg.codes = codegen.Policy{
+		Generator:         generator,
+		Length:            length,
+		MaxLength:         maxLength,
+		AttemptsPerLength: attempts,
+	}
+
+	cfg.defaultCapacity, err = envPositiveInt("ROOM_DEFAULT_CAPACITY", 2)
+	if err != nil {
+		return nil, err
+	}
+	cfg.maxCapacity, err = envPositiveInt("ROOM_MAX_CAPACITY", 8)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.defaultCapacity > cfg.maxCapacity {
+		return nil, fmt.Errorf("ROOM_DEFAULT_CAPACITY must not be above ROOM_MAX_CAPACITY")
+	}
+	cfg.maxViewerCapacity, err = envInt("ROOM_MAX_VIEWER_CAPACITY", 100)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.maxViewerCapacity < 0 {
+		return nil, fmt.Errorf("ROOM_MAX_VIEWER_CAPACITY must not be negative")
+	}
+
+	cfg.maxRoomDuration, err = envDuration("ROOM_MAX_DURATION", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	cfg.maxScheduleAhead, err = envDuration("ROOM_MAX_SCHEDULE_AHEAD", 30*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	cfg.roomEndWarning, err = envDuration("ROOM_END_WARNING", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	cfg.schedulerInterval, err = envDuration("SCHEDULER_INTERVAL", time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.maxRoomDuration < 0 || cfg.maxScheduleAhead < 0 || cfg.roomEndWarning < 0 {
+		return nil, fmt.Errorf("ROOM_MAX_DURATION, ROOM_MAX_SCHEDULE_AHEAD and ROOM_END_WARNING must not be negative")
+	}
+	if cfg.schedulerInterval <= 0 {
+		return nil, fmt.Errorf("SCHEDULER_INTERVAL must be positive")
+	}
+
+	cfg.rateLimitTrustedProxies, err = envInt("RATE_LIMIT_TRUSTED_PROXIES", 0)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.rateLimitTrustedProxies < 0 {
+		return nil, fmt.Errorf("RATE_LIMIT_TRUSTED_PROXIES must not be negative")
+	}
+	cfg.generateLimit, err = envLimit("RATE_LIMIT_GENERATE", 10, 5)
+	if err != nil {
+		return nil, err
+	}
+	cfg.connectLimit, err = envLimit("RATE_LIMIT_CONNECT", 30, 10)
+	if err != nil {
+		return nil, err
+	}
+	cfg.authLimit, err = envLimit("RATE_LIMIT_AUTH", 10, 5)
+	if err != nil {
+		return nil, err
+	}
+	cfg.iceLimit, err = envLimit("RATE_LIMIT_ICE", 30, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	maxMessageSize, err := envPositiveInt("WS_MAX_MESSAGE_BYTES", 64*1024)
+	if err != nil {
+		return nil, err
+	}
+	messagesPerSecond, err := envPositiveInt("WS_MESSAGES_PER_SECOND", 20)
+	if err != nil {
+		return nil, err
+	}
+	messageBurst, err := envPositiveInt("WS_MESSAGE_BURST", 50)
+	if err != nil {
+		return nil, err
+	}
+	maxViolations, err := envPositiveInt("WS_MAX_VIOLATIONS", 10)
+	if err != nil {
+		return nil, err
+	}
+	inputEventsPerSecond, err := envPositiveInt("WS_INPUT_EVENTS_PER_SECOND", 60)
+	if err != nil {
+		return nil, err
+	}
+	inputEventBurst, err := envPositiveInt("WS_INPUT_EVENT_BURST", 120)
+	if err != nil {
+		return nil, err
+	}
+	ephemeralEventsPerSecond, err := envPositiveInt("WS_EPHEMERAL_EVENTS_PER_SECOND", 5)
+	if err != nil {
+		return nil, err
+	}
+	ephemeralEventBurst, err := envPositiveInt("WS_EPHEMERAL_EVENT_BURST", 20)
+	if err != nil {
+		return nil, err
+	}
+	fileChunksPerSecond, err := envPositiveInt("WS_FILE_CHUNKS_PER_SECOND", 40)
+	if err != nil {
+		return nil, err
+	}
+	fileChunkBurst, err := envPositiveInt("WS_FILE_CHUNK_BURST", 40)
+	if err != nil {
+		return nil, err
+	}
+	cfg.messageLimits = logic.MessageLimits{
+		MaxMessageSize: int64(maxMessageSize),
+		Rate:           ratelimit.Limit{Rate: float64(messagesPerSecond), Burst: messageBurst},
+		InputRate:      ratelimit.Limit{Rate: float64(inputEventsPerSecond), Burst: inputEventBurst},
+		EphemeralRate:  ratelimit.Limit{Rate: float64(ephemeralEventsPerSecond), Burst: ephemeralEventBurst},
+		FileChunkRate:  ratelimit.Limit{Rate: float64(fileChunksPerSecond), Burst: fileChunkBurst},
+		MaxViolations:  maxViolations,
+	}
+
+	chatHistorySize, err := envInt("CHAT_HISTORY_SIZE", 200)
+	if err != nil {
+		return nil, err
+	}
+	chatReplayCount, err := envInt("CHAT_REPLAY_COUNT", 50)
+	if err != nil {
+		return nil, err
+	}
+	chatMaxLength, err := envInt("CHAT_MAX_LENGTH", 2000)
+	if err != nil {
+		return nil, err
+	}
+	if chatHistorySize < 1 || chatMaxLength < 1 {
+		return nil, fmt.Errorf("CHAT_HISTORY_SIZE and CHAT_MAX_LENGTH must be positive")
+	}
+	cfg.chat = logic.ChatConfig{
+		HistorySize: chatHistorySize,
+		ReplayCount: min(chatReplayCount, chatHistorySize),
+		MaxLength:   chatMaxLength,
+	}
+
+	annotationLogSize, err := envInt("ANNOTATION_LOG_SIZE", 5000)
+	if err != nil {
+		return nil, err
+	}
+	annotationMaxPoints, err := envInt("ANNOTATION_MAX_POINTS", 2000)
+	if err != nil {
+		return nil, err
+	}
+	if annotationLogSize < 1 || annotationMaxPoints < 1 {
+		return nil, fmt.Errorf("ANNOTATION_LOG_SIZE and ANNOTATION_MAX_POINTS must be positive")
+	}
+	cfg.annotations = logic.AnnotationConfig{
+		LogSize:   annotationLogSize,
+		MaxPoints: annotationMaxPoints,
+	}
+
+	cfg.lobbyTimeout, err = envDuration("LOBBY_TIMEOUT", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.lobbyTimeout <= 0 {
+		return nil, fmt.Errorf("LOBBY_TIMEOUT must be positive")
+	}
+	cfg.kickBan, err = envDuration("KICK_BAN_DURATION", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.kickBan < 0 {
+		return nil, fmt.Errorf("KICK_BAN_DURATION must not be negative")
+	}
+
+	turnTTL, err := envDuration("TURN_CREDENTIAL_TTL", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ice = ice.Config{
+		STUNURLs: envList("ICE_STUN_URLS", []string{"stun:stun.l.google.com:19302"}),
+		TURNURLs: envList("ICE_TURN_URLS", nil),
+		Secret:   envString("TURN_SECRET", ""),
+		TTL:      turnTTL,
+	}
+
+	cfg.turnEmbedded, err = envBool("TURN_EMBEDDED", false)
+	if err != nil {
+		return nil, err
+	}
+	relayMinPort, err := envInt("TURN_RELAY_PORT_MIN", 0)
+	if err != nil {
+		return nil, err
+	}
+	relayMaxPort, err := envInt("TURN_RELAY_PORT_MAX", 0)
+	if err != nil {
+		return nil, err
+	}
+	roomAllocationQuota, err := envPositiveInt("TURN_ROOM_ALLOCATION_QUOTA", 10)
+	if err != nil {
+		return nil, err
+	}
+	cfg.turn = turnserver.Config{
+		ListenAddr:          envString("TURN_LISTEN_ADDR", "0.0.0.0:3478"),
+		PublicIP:            envString("TURN_PUBLIC_IP", "127.0.0.1"),
+		Realm:               envString("TURN_REALM", "streamify"),
+		Secret:              cfg.ice.Secret,
+		RelayMinPort:        uint16(relayMinPort),
+		RelayMaxPort:        uint16(relayMaxPort),
+		RoomAllocationQuota: roomAllocationQuota,
+	}
+	if cfg.turnEmbedded && len(cfg.ice.TURNURLs) == 0 {
+		// advertise the embedded server unless TURN URLs were configured explicitly
+		_, port, err := net.SplitHostPort(cfg.turn.ListenAddr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TURN_LISTEN_ADDR: %w", err)
+		}
+		turnAddr := net.JoinHostPort(cfg.turn.PublicIP, port)
+		cfg.ice.TURNURLs = []string{
+			"turn:" + turnAddr + "?transport=udp",
+			"turn:" + turnAddr + "?transport=tcp",
+		}
+	}
+
+	cfg.sfuEnabled, err = envBool("SFU_ENABLED", false)
+	if err != nil {
+		return nil, err
+	}
+	cfg.maxSFUCapacity, err = envPositiveInt("SFU_MAX_CAPACITY", 25)
+	if err != nil {
+		return nil, err
+	}
+	sfuPortMin, err := envInt("SFU_PORT_MIN", 0)
+	if err != nil {
+		return nil, err
+	}
+	sfuPortMax, err := envInt("SFU_PORT_MAX", 0)
+	if err != nil {
+		return nil, err
+	}
+	cfg.sfu = sfu.Config{
+		PublicIP: envString("SFU_PUBLIC_IP", ""),
+		PortMin:  uint16(sfuPortMin),
+		PortMax:  uint16(sfuPortMax),
+	}
+	// the SFU only needs STUN to learn its own reflexive address, clients bring TURN when they need it
+	if len(cfg.ice.STUNURLs) > 0 {
+		cfg.sfu.ICEServers = []webrtc.ICEServer{{URLs: cfg.ice.STUNURLs}}
+	}
+
+	cfg.recordingEnabled, err = envBool("RECORDING_ENABLED", false)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.recordingEnabled && !cfg.sfuEnabled {
+		return nil, fmt.Errorf("RECORDING_ENABLED requires SFU_ENABLED")
+	}
+	cfg.recording = recorder.Config{
+		Dir: envString("RECORDING_DIR", "recordings"),
+	}
+
+	cfg.filesEnabled, err = envBool("FILE_TRANSFER_ENABLED", true)
+	if err != nil {
+		return nil, err
+	}
+	fileMaxBytes, err := envInt("FILE_MAX_BYTES", 25<<20)
+	if err != nil {
+		return nil, err
+	}
+	fileRoomQuota, err := envInt("FILE_ROOM_QUOTA_BYTES", 100<<20)
+	if err != nil {
+		return nil, err
+	}
+	fileSpoolTTL, err := envDuration("FILE_SPOOL_TTL", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	// the host name tells apart instances sharing the spool directory and survives restarts
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "streamify"
+	}
+	cfg.files = files.Config{
+		MaxFileSize: int64(fileMaxBytes),
+		RoomQuota:   int64(fileRoomQuota),
+		SpoolDir:    envString("FILE_SPOOL_DIR", ""),
+		Instance:    envString("FILE_SPOOL_INSTANCE", hostname),
+		SpoolTTL:    fileSpoolTTL,
+	}
+
+	cfg.webhooksFile = envString("WEBHOOKS_FILE", "")
+	cfg.webhookPollInterval, err = envDuration("WEBHOOK_POLL_INTERVAL", time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.webhookPollInterval <= 0 {
+		return nil, fmt.Errorf("WEBHOOK_POLL_INTERVAL must be positive")
+	}
+
+	cfg.auditStream, err = envBool("AUDIT_STREAM", true)
+	if err != nil {
+		return nil, err
+	}
+	cfg.auditStreamMaxLen, err = envInt("AUDIT_STREAM_MAX_LEN", 1000000)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.auditStreamMaxLen < 0 {
+		return nil, fmt.Errorf("AUDIT_STREAM_MAX_LEN must not be negative")
+	}
+	cfg.auditFile = envString("AUDIT_FILE", "")
+	cfg.auditPostgres, err = envBool("AUDIT_POSTGRES", true)
+	if err != nil {
+		return nil, err
+	}
+	cfg.adminToken = envString("ADMIN_TOKEN", "")
+
+	cfg.authSessionTTL, err = envDuration("AUTH_SESSION_TTL", 30*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.authSessionTTL <= 0 {
+		return nil, fmt.Errorf("AUTH_SESSION_TTL must be positive")
+	}
+	cfg.authExternalSecret = envString("AUTH_EXTERNAL_SECRET", "")
+	cfg.authExternalIssuers = envList("AUTH_EXTERNAL_ISSUERS", nil)
+	cfg.authRequireAccount, err = envBool("AUTH_REQUIRE_ACCOUNT", false)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.authRequireAccount && cfg.databaseURL == "" {
+		return nil, fmt.Errorf("AUTH_REQUIRE_ACCOUNT needs DATABASE_URL")
+	}
+
+	return cfg, nil
+}
+
+func envString(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) (int, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return n, nil
+}
+
+// envPositiveInt reads an int that must be at least 1, zero would disable or block what it limits
+func envPositiveInt(key string, fallback int) (int, error) {
+	n, err := envInt(key, fallback)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 {
+		return 0, fmt.Errorf("%s must be at least 1, got %d", key, n)
+	}
+	return n, nil
+}
+
+func envBool(key string, fallback bool) (bool, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return b, nil
+}
+
+// envLimit reads <prefix>_PER_MINUTE and <prefix>_BURST
+func envLimit(prefix string, perMinute int, burst int) (ratelimit.Limit, error) {
+	perMinute, err := envPositiveInt(prefix+"_PER_MINUTE", perMinute)
+	if err != nil {
+		return ratelimit.Limit{}, err
+	}
+	burst, err = envPositiveInt(prefix+"_BURST", burst)
+	if err != nil {
+		return ratelimit.Limit{}, err
+	}
+	return ratelimit.PerMinute(perMinute, burst), nil
+}
+
+func envDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return d, nil
+}
+
+// envList reads a comma separated list
+func envList(key string, fallback []string) []string {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
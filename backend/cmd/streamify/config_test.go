@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "defaults"},
+		{name: "zero burst", env: map[string]string{"WS_MESSAGE_BURST": "0"}, wantErr: "WS_MESSAGE_BURST"},
+		{name: "negative rate", env: map[string]string{"WS_MESSAGES_PER_SECOND": "-5"}, wantErr: "WS_MESSAGES_PER_SECOND"},
+		{name: "zero max size", env: map[string]string{"WS_MAX_MESSAGE_BYTES": "0"}, wantErr: "WS_MAX_MESSAGE_BYTES"},
+		{name: "zero violations", env: map[string]string{"WS_MAX_VIOLATIONS": "0"}, wantErr: "WS_MAX_VIOLATIONS"},
+		{name: "zero input burst", env: map[string]string{"WS_INPUT_EVENT_BURST": "0"}, wantErr: "WS_INPUT_EVENT_BURST"},
+		{name: "zero ephemeral rate", env: map[string]string{"WS_EPHEMERAL_EVENTS_PER_SECOND": "0"}, wantErr: "WS_EPHEMERAL_EVENTS_PER_SECOND"},
+		{name: "zero file chunk burst", env: map[string]string{"WS_FILE_CHUNK_BURST": "0"}, wantErr: "WS_FILE_CHUNK_BURST"},
+		{name: "zero request rate", env: map[string]string{"RATE_LIMIT_CONNECT_PER_MINUTE": "0"}, wantErr: "RATE_LIMIT_CONNECT_PER_MINUTE"},
+		{name: "zero request burst", env: map[string]string{"RATE_LIMIT_AUTH_BURST": "0"}, wantErr: "RATE_LIMIT_AUTH_BURST"},
+		{name: "zero TURN quota", env: map[string]string{"TURN_ROOM_ALLOCATION_QUOTA": "0"}, wantErr: "TURN_ROOM_ALLOCATION_QUOTA"},
+		{name: "zero default capacity", env: map[string]string{"ROOM_DEFAULT_CAPACITY": "0"}, wantErr: "ROOM_DEFAULT_CAPACITY"},
+		{name: "zero max capacity", env: map[string]string{"ROOM_MAX_CAPACITY": "0"}, wantErr: "ROOM_MAX_CAPACITY"},
+		{name: "default above max capacity", env: map[string]string{"ROOM_DEFAULT_CAPACITY": "10", "ROOM_MAX_CAPACITY": "8"}, wantErr: "ROOM_DEFAULT_CAPACITY"},
+		{name: "lower case charset", env: map[string]string{"ROOM_CODE_CHARSET": "abc123"}, wantErr: "ROOM_CODE_CHARSET"},
+		{name: "negative trusted proxies", env: map[string]string{"RATE_LIMIT_TRUSTED_PROXIES": "-1"}, wantErr: "RATE_LIMIT_TRUSTED_PROXIES"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			_, err := loadConfig()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("loadConfig() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("loadConfig() = %v, want an error about %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,22 +1,148 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 
+	"github.com/AnishG-git/streamify/internal/audit"
+	"github.com/AnishG-git/streamify/internal/files"
+	"github.com/AnishG-git/streamify/internal/identity"
+	"github.com/AnishG-git/streamify/internal/logic"
+	"github.com/AnishG-git/streamify/internal/recorder"
+	"github.com/AnishG-git/streamify/internal/sfu"
+	"github.com/AnishG-git/streamify/internal/storage"
+	"github.com/AnishG-git/streamify/internal/storage/postgres"
+	"github.com/AnishG-git/streamify/internal/turnserver"
+	"github.com/AnishG-git/streamify/internal/webhooks"
 	"github.com/gorilla/handlers"
 )
 
 func main() {
 	mainLog := log.Default()
-	rds, err := mustLoadRedis()
+	cfg, err := loadConfig()
+	if err != nil {
+		mainLog.Fatalf("Failed to load config: %s", err)
+	}
+
+	client, err := mustLoadRedis(cfg)
 	if err != nil {
 		mainLog.Fatalf("Failed to load database: %s", err)
 	}
 	mainLog.Print("Connected to database")
+	rds := storage.NewRDS(client, cfg.redisKeyPrefix)
+
+	var store storage.Storage = rds
+	var db *postgres.Store
+	if cfg.databaseURL != "" {
+		db, err = postgres.Open(context.Background(), cfg.databaseURL)
+		if err != nil {
+			mainLog.Fatalf("Failed to connect to Postgres: %s", err)
+		}
+		defer db.Close()
+		store = storage.NewDurable(rds, db, db, mainLog)
+		// recording metadata is shared by every instance
+		cfg.recording.Store = db
+		mainLog.Print("Connected to Postgres")
+	}
+
+	if cfg.webhooksFile != "" {
+		endpoints, err := webhooks.LoadEndpoints(cfg.webhooksFile)
+		if err != nil {
+			mainLog.Fatalf("Failed to load webhook endpoints: %s", err)
+		}
+		dispatcher := webhooks.New(client, cfg.redisKeyPrefix, webhooks.Config{
+			Endpoints:    endpoints,
+			PollInterval: cfg.webhookPollInterval,
+		}, mainLog)
+		go dispatcher.Run(context.Background())
+		store = webhooks.NewStorage(store, dispatcher)
+		mainLog.Printf("Webhooks enabled for %d endpoints", len(endpoints))
+	}
+
+	var auditSinks []audit.Sink
+	// the first sink answers queries, Postgres has the indexes for it
+	if db != nil && cfg.auditPostgres {
+		auditSinks = append(auditSinks, db.AuditSink())
+	}
+	if cfg.auditStream {
+		auditSinks = append(auditSinks, audit.NewStreamSink(client, cfg.redisKeyPrefix, int64(cfg.auditStreamMaxLen)))
+	}
+	if cfg.auditFile != "" {
+		fileSink, err := audit.NewFileSink(cfg.auditFile)
+		if err != nil {
+			mainLog.Fatalf("Failed to open audit file: %s", err)
+		}
+		defer fileSink.Close()
+		auditSinks = append(auditSinks, fileSink)
+	}
+	var auditLog *audit.Log
+	if len(auditSinks) > 0 {
+		auditLog = audit.New(mainLog, auditSinks...)
+		mainLog.Printf("Audit log enabled with %d sinks", len(auditSinks))
+	}
+
+	limiter, err := loadRateLimiter(cfg, client)
+	if err != nil {
+		mainLog.Fatalf("Failed to load rate limiter: %s", err)
+	}
+
+	if cfg.turnEmbedded {
+		turnServer, err := turnserver.Start(cfg.turn, mainLog)
+		if err != nil {
+			mainLog.Fatalf("Failed to start TURN server: %s", err)
+		}
+		defer turnServer.Close()
+	}
+
+	var mediaServer *sfu.SFU
+	if cfg.sfuEnabled {
+		mediaServer, err = sfu.New(cfg.sfu, mainLog)
+		if err != nil {
+			mainLog.Fatalf("Failed to start SFU: %s", err)
+		}
+		mainLog.Print("SFU mode enabled")
+	} else {
+		// rooms can only be created in SFU mode when the SFU is running
+		cfg.maxSFUCapacity = 0
+	}
+
+	var rec *recorder.Recorder
+	if cfg.recordingEnabled {
+		rec, err = recorder.New(cfg.recording, mediaServer, mainLog)
+		if err != nil {
+			mainLog.Fatalf("Failed to start recorder: %s", err)
+		}
+		mainLog.Printf("Recording enabled, writing to %s", cfg.recording.Dir)
+	}
+
+	var fileManager *files.Manager
+	if cfg.filesEnabled {
+		fileManager, err = files.New(cfg.files, mainLog)
+		if err != nil {
+			mainLog.Fatalf("Failed to start file transfer: %s", err)
+		}
+		if fileManager.Spooling() {
+			mainLog.Printf("File transfer enabled, spooling to %s", cfg.files.SpoolDir)
+		}
+	}
 
 	const addr = ":8080"
-	server := newServer(mainLog, addr, rds)
+	var chatHistory storage.ChatStore
+	accounts := logic.AccountConfig{
+		SessionTTL:     cfg.authSessionTTL,
+		RequireAccount: cfg.authRequireAccount,
+	}
+	if db != nil {
+		chatHistory = db
+		accounts.Users = db
+		accounts.Rooms = db
+		if cfg.authExternalSecret != "" {
+			accounts.External = identity.NewVerifier([]byte(cfg.authExternalSecret), cfg.authExternalIssuers)
+			mainLog.Print("External sign-in enabled")
+		}
+	}
+	server := newServer(mainLog, addr, store, limiter, mediaServer, rec, fileManager, auditLog, chatHistory, accounts, cfg)
 	errCh := make(chan error)
 
 	go func() {
@@ -24,8 +150,9 @@ func main() {
 		// Allow CORS for local development
 		cors := handlers.CORS(
 			handlers.AllowedOrigins([]string{"*"}),
-			handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
+			handlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
 			handlers.AllowedHeaders([]string{"Content-Type", "Authorization"}),
+			handlers.ExposedHeaders([]string{"Retry-After"}),
 		)
 		if err := http.ListenAndServe(server.address, cors(server.router)); err != nil {
 			mainLog.Printf("Server failed: %s", err)
@@ -1,51 +1,140 @@
 package main
 
 import (
+	"context"
 	"log"
 	"sync"
 
+	"github.com/AnishG-git/streamify/internal/audit"
 	"github.com/AnishG-git/streamify/internal/connections"
+	"github.com/AnishG-git/streamify/internal/files"
 	"github.com/AnishG-git/streamify/internal/handlers"
+	"github.com/AnishG-git/streamify/internal/logic"
+	"github.com/AnishG-git/streamify/internal/metrics"
+	"github.com/AnishG-git/streamify/internal/ratelimit"
+	"github.com/AnishG-git/streamify/internal/recorder"
+	"github.com/AnishG-git/streamify/internal/sfu"
 	"github.com/AnishG-git/streamify/internal/storage"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"github.com/gorilla/websocket"
 )
 
 type server struct {
 	router      *mux.Router
 	address     string
 	rds         storage.Storage
-	connections map[string]*websocket.Conn
+	connections map[string]*connections.Client
 	mu          *sync.Mutex
 	serverID    string
 	logger      *log.Logger
+	limiter     ratelimit.Limiter
+	auditLog    *audit.Log
+	cfg         *config
 }
 
-func newServer(logger *log.Logger, addr string, storage storage.Storage) *server {
+func newServer(logger *log.Logger, addr string, storage storage.Storage, limiter ratelimit.Limiter, sfu *sfu.SFU, recorder *recorder.Recorder, fileManager *files.Manager, auditLog *audit.Log, chatHistory storage.ChatStore, accounts logic.AccountConfig, cfg *config) *server {
 	router := mux.NewRouter()
 
 	s := &server{
 		router:      router,
 		address:     addr,
 		rds:         storage,
-		connections: make(map[string]*websocket.Conn),
+		connections: make(map[string]*connections.Client),
 		mu:          &sync.Mutex{},
 		serverID:    uuid.NewString(),
 		logger:      logger,
+		limiter:     limiter,
+		auditLog:    auditLog,
+		cfg:         cfg,
 	}
 
 	manager := connections.NewManager(s.rds, s.mu, s.connections, s.serverID)
-	h := handlers.New(s.logger, manager)
+	h := handlers.New(s.logger, manager, handlers.Config{
+		Rooms: logic.RoomPolicy{
+			Codes:             &cfg.codes,
+			DefaultCapacity:   cfg.defaultCapacity,
+			MaxCapacity:       cfg.maxCapacity,
+			MaxSFUCapacity:    cfg.maxSFUCapacity,
+			MaxViewerCapacity: cfg.maxViewerCapacity,
+			MaxDuration:       cfg.maxRoomDuration,
+			MaxScheduleAhead:  cfg.maxScheduleAhead,
+			EndWarning:        cfg.roomEndWarning,
+		},
+		Connect: logic.ConnectConfig{
+			Limits:       cfg.messageLimits,
+			SFU:          sfu,
+			Recorder:     recorder,
+			Chat:         cfg.chat,
+			Annotations:  cfg.annotations,
+			Files:        fileManager,
+			LobbyTimeout: cfg.lobbyTimeout,
+			KickBan:      cfg.kickBan,
+			Codes:        &cfg.codes,
+			Audit:        auditLog,
+		},
+		ICE:         cfg.ice,
+		ClientIP:    ratelimit.ClientIP(cfg.rateLimitTrustedProxies),
+		AdminToken:  cfg.adminToken,
+		ChatHistory: chatHistory,
+		Accounts:    accounts,
+	})
+	metrics.PublishLimits("ws_message_limits", cfg.messageLimits)
+	logger.Printf("WebSocket message limits: max size %d bytes, %.1f msg/s, burst %d, %d violations before disconnect",
+		cfg.messageLimits.MaxMessageSize, cfg.messageLimits.Rate.Rate, cfg.messageLimits.Rate.Burst, cfg.messageLimits.MaxViolations)
 
 	s.routes(h)
+	go s.runScheduler(manager)
 	return s
 }
 
+// runScheduler closes scheduled rooms when they end, alongside the schedulers of the other instances
+func (s *server) runScheduler(manager connections.ConnManager) {
+	if err := logic.RunScheduler(context.Background(), s.logger, manager, s.auditLog, s.cfg.schedulerInterval); err != nil {
+		s.logger.Printf("Scheduler stopped: %v", err)
+	}
+}
+
 func (s *server) routes(h *handlers.Handlers) {
+	clientIP := ratelimit.ClientIP(s.cfg.rateLimitTrustedProxies)
+	generateLimit := ratelimit.Middleware(s.limiter, s.logger,
+		ratelimit.Rule{Name: "generate:ip", Limit: s.cfg.generateLimit, Key: clientIP},
+		ratelimit.Rule{Name: "generate:user", Limit: s.cfg.generateLimit, Key: h.UserKey("")},
+	)
+	connectLimit := ratelimit.Middleware(s.limiter, s.logger,
+		ratelimit.Rule{Name: "connect:ip", Limit: s.cfg.connectLimit, Key: clientIP},
+		ratelimit.Rule{Name: "connect:user", Limit: s.cfg.connectLimit, Key: h.UserKey("authToken")},
+	)
+	authLimit := ratelimit.Middleware(s.limiter, s.logger,
+		ratelimit.Rule{Name: "auth:ip", Limit: s.cfg.authLimit, Key: clientIP},
+	)
+	iceLimit := ratelimit.Middleware(s.limiter, s.logger,
+		ratelimit.Rule{Name: "ice:ip", Limit: s.cfg.iceLimit, Key: clientIP},
+	)
+
+	s.router.HandleFunc("/debug/vars", h.DebugVarsHandler()).Methods("GET")
+	s.router.HandleFunc("/admin/audit", h.AuditLogHandler()).Methods("GET")
+	s.router.HandleFunc("/admin/chat", h.ChatHistoryHandler()).Methods("GET")
+
+	auth := s.router.PathPrefix("/auth").Subrouter()
+	auth.Handle("/register", authLimit(h.RegisterHandler())).Methods("POST")
+	auth.Handle("/login", authLimit(h.LoginHandler())).Methods("POST")
+	auth.Handle("/external", authLimit(h.ExternalLoginHandler())).Methods("POST")
+	auth.HandleFunc("/logout", h.LogoutHandler()).Methods("POST")
+
+	s.router.HandleFunc("/me", h.GetProfileHandler()).Methods("GET")
+	// changing the password checks the current one, which must not be guessed at full speed
+	s.router.Handle("/me", authLimit(h.UpdateProfileHandler())).Methods("PATCH")
+	s.router.HandleFunc("/me/rooms", h.MyRoomsHandler()).Methods("GET")
+
 	room := s.router.PathPrefix("/room").Subrouter()
-	room.HandleFunc("/generate", h.GenerateRoomHandler()).Methods("GET")
-	room.HandleFunc("/connect/{code}", h.ConnectRoomHandler()).Methods("GET")
+	room.Handle("/generate", generateLimit(h.GenerateRoomHandler())).Methods("GET")
+	room.Handle("/connect/{code}", connectLimit(h.ConnectRoomHandler())).Methods("GET")
+	room.Handle("/{code}/ice-servers", iceLimit(h.ICEServersHandler())).Methods("GET")
+	room.HandleFunc("/{code}/recordings", h.ListRecordingsHandler()).Methods("GET")
+	room.HandleFunc("/{code}/files/{id}", h.DownloadFileHandler()).Methods("GET")
+	room.HandleFunc("/{code}", h.GetRoomHandler()).Methods("GET")
+	room.HandleFunc("/{code}", h.UpdateRoomHandler()).Methods("PATCH")
+	room.HandleFunc("/{code}", h.DeleteRoomHandler()).Methods("DELETE")
 }
 
 // func (s *server) connectRoomHandler() http.HandlerFunc {
@@ -2,15 +2,16 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"time"
 
-	"github.com/AnishG-git/streamify/internal/storage"
+	"github.com/AnishG-git/streamify/internal/ratelimit"
 	"github.com/redis/go-redis/v9"
 )
 
-func mustLoadRedis() (storage.Storage, error) {
+func mustLoadRedis(cfg *config) (*redis.Client, error) {
 	client := redis.NewClient(&redis.Options{
-		Addr: "redis:6379",
+		Addr: cfg.redisAddr,
 		DB:   0,
 	})
 
@@ -23,6 +24,18 @@ func mustLoadRedis() (storage.Storage, error) {
 		return nil, err
 	}
 
-	rds := storage.NewRDS(client)
-	return rds, nil
+	return client, nil
+}
+
+// loadRateLimiter picks the rate limit backend. The Redis backend shares limits
+// between instances, the memory backend only limits within this process.
+func loadRateLimiter(cfg *config, client *redis.Client) (ratelimit.Limiter, error) {
+	switch cfg.rateLimitBackend {
+	case "memory":
+		return ratelimit.NewMemory(), nil
+	case "redis":
+		return ratelimit.NewRedis(client, cfg.redisKeyPrefix), nil
+	default:
+		return nil, fmt.Errorf("unknown RATE_LIMIT_BACKEND %q", cfg.rateLimitBackend)
+	}
 }
@@ -63,7 +63,7 @@ func (s *server) removeConnectionFromRoom(ctx context.Context, roomCode string,
 	}
 
 	// If the room is still empty, delete it
-	err = storage.DeleteRoom(ctx, roomCode)
+	_, err = storage.DeleteRoom(ctx, roomCode)
 	if err != nil {
 		s.logger.Printf("Failed to remove room %s", roomCode)
 	}
@@ -0,0 +1,63 @@
+// Command webhook-receiver is a local stand-in for a webhook endpoint. It checks the
+// signature of every delivery, logs the event and can fail a share of the deliveries
+// on purpose to exercise the retries.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/webhooks"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "address to listen on")
+	secret := flag.String("secret", "", "secret of the endpoint, signatures aren't checked without it")
+	failRate := flag.Float64("fail", 0, "share of deliveries answered with 503, from 0 to 1")
+	tolerance := flag.Duration("tolerance", 5*time.Minute, "oldest signature timestamp accepted")
+	flag.Parse()
+
+	logger := log.Default()
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			return
+		}
+		delivery := r.Header.Get(webhooks.HeaderDelivery)
+
+		if *secret != "" {
+			err := webhooks.Verify(*secret, r.Header.Get(webhooks.HeaderSignature), body, *tolerance, time.Now())
+			if err != nil {
+				logger.Printf("Rejected delivery %s: %v", delivery, err)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+		if rand.Float64() < *failRate {
+			logger.Printf("Failing delivery %s on purpose", delivery)
+			http.Error(w, "Failing on purpose", http.StatusServiceUnavailable)
+			return
+		}
+
+		var event webhooks.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			http.Error(w, "Invalid event", http.StatusBadRequest)
+			return
+		}
+		logger.Printf("Delivery %s: %s of room %s %v", delivery, event.Type, event.RoomCode, event.Data)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	logger.Printf("Receiving webhooks on %s", *addr)
+	logger.Fatal(http.ListenAndServe(*addr, nil))
+}
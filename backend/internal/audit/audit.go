@@ -0,0 +1,159 @@
+// Package audit keeps an append-only record of who joined which room, when and from where, and
+// of the moderation actions taken in it. Every entry is written to each configured sink, a Redis
+// stream shared by every instance and/or a local JSONL file, and can be queried back by room and
+// time range.
+package audit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ActionMemberJoined    = "member.joined"
+	ActionMemberLeft      = "member.left"
+	ActionMemberKicked    = "member.kicked"
+	ActionKnockAdmitted   = "knock.admitted"
+	ActionKnockDenied     = "knock.denied"
+	ActionPresenterGrant  = "presenter.granted"
+	ActionPresenterDeny   = "presenter.denied"
+	ActionPresenterRevoke = "presenter.revoked"
+	ActionBreakoutMove    = "breakout.moved"
+	ActionRoomUpdated     = "room.updated"
+	ActionRoomDeleted     = "room.deleted"
+	ActionRoomEnded       = "room.ended"
+)
+
+// ActorOwner is the actor of the actions taken with the owner token over HTTP
+const ActorOwner = "owner"
+
+// defaultQueryLimit and maxQueryLimit bound how many entries one query returns
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 1000
+)
+
+var (
+	ErrNotQueryable  = errors.New("no queryable audit sink is configured")
+	ErrInvalidCursor = errors.New("invalid audit cursor")
+)
+
+// Entry is one audited event
+type Entry struct {
+	ID       string    `json:"id"`
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	RoomCode string    `json:"roomCode"`
+	// Actor is the member who acted, ActorOwner or empty when the server acted on its own
+	Actor string `json:"actor,omitempty"`
+	// Target is the member acted upon
+	Target string `json:"target,omitempty"`
+	Role   string `json:"role,omitempty"`
+	// IP is the address the actor connected from, it is empty when the server acted
+	IP      string                 `json:"ip,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+	// Cursor is the entry's position in the sink it was read from, set by queries
+	Cursor string `json:"-"`
+}
+
+// Filter selects entries, the zero value selects the oldest entries of every room
+type Filter struct {
+	// RoomCode selects the entries of one room, all rooms if empty
+	RoomCode string
+	// From and To bound the entries' times, both are inclusive and unbounded if zero
+	From time.Time
+	To   time.Time
+	// Limit is the most entries returned, 100 if zero and at most 1000
+	Limit int
+	// After is the Cursor of an entry read from the same sink, only entries after it are selected
+	After string
+}
+
+func (f *Filter) matches(entry *Entry) bool {
+	if f.RoomCode != "" && entry.RoomCode != f.RoomCode {
+		return false
+	}
+	if !f.From.IsZero() && entry.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && entry.Time.After(f.To) {
+		return false
+	}
+	return true
+}
+
+// Max is the most entries the filter selects
+func (f *Filter) Max() int {
+	if f.Limit <= 0 {
+		return defaultQueryLimit
+	}
+	return min(f.Limit, maxQueryLimit)
+}
+
+// Sink stores entries
+type Sink interface {
+	Write(ctx context.Context, entry *Entry) error
+}
+
+// Querier is a sink entries can be read back from, oldest first, with their Cursor set. It
+// returns one entry more than the filter's limit when there are more, so callers can tell the
+// result was cut short, and ErrInvalidCursor when the filter's After isn't one of its cursors.
+type Querier interface {
+	Query(ctx context.Context, filter Filter) ([]*Entry, error)
+}
+
+// Log writes entries to its sinks. A nil Log drops every entry.
+type Log struct {
+	sinks  []Sink
+	logger *log.Logger
+}
+
+func New(logger *log.Logger, sinks ...Sink) *Log {
+	return &Log{
+		sinks:  sinks,
+		logger: logger,
+	}
+}
+
+// Record stamps an entry and writes it to every sink. Failures are logged, a sink that fails
+// misses the entry.
+func (l *Log) Record(ctx context.Context, entry *Entry) {
+	if l == nil {
+		return
+	}
+	entry.ID = uuid.NewString()
+	entry.Time = time.Now().UTC()
+	ctx = context.WithoutCancel(ctx)
+	for _, sink := range l.sinks {
+		if err := sink.Write(ctx, entry); err != nil {
+			l.logger.Printf("Failed to write audit entry %s of room %s: %v", entry.Action, entry.RoomCode, err)
+		}
+	}
+}
+
+// Query reads entries back from the first sink that supports it. more reports whether entries
+// past the limit match the filter too, the next page is after the last entry's Cursor.
+func (l *Log) Query(ctx context.Context, filter Filter) (entries []*Entry, more bool, err error) {
+	if l == nil {
+		return nil, false, ErrNotQueryable
+	}
+	for _, sink := range l.sinks {
+		querier, ok := sink.(Querier)
+		if !ok {
+			continue
+		}
+		entries, err := querier.Query(ctx, filter)
+		if err != nil {
+			return nil, false, err
+		}
+		if limit := filter.Max(); len(entries) > limit {
+			return entries[:limit], true, nil
+		}
+		return entries, false, nil
+	}
+	return nil, false, ErrNotQueryable
+}
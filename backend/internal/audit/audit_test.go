@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSinkQueryPages(t *testing.T) {
+	ctx := context.Background()
+	sink, err := NewFileSink(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatalf("NewFileSink() = %v", err)
+	}
+	defer sink.Close()
+	l := New(log.New(io.Discard, "", 0), sink)
+
+	for _, entry := range []*Entry{
+		{Action: ActionMemberJoined, RoomCode: "ABC123", Actor: "alice"},
+		{Action: ActionMemberJoined, RoomCode: "XYZ789", Actor: "bob"},
+		{Action: ActionMemberKicked, RoomCode: "ABC123", Actor: "alice", Target: "carol"},
+		{Action: ActionMemberLeft, RoomCode: "ABC123", Actor: "alice"},
+	} {
+		l.Record(ctx, entry)
+	}
+
+	filter := Filter{RoomCode: "ABC123", Limit: 2}
+	first, more, err := l.Query(ctx, filter)
+	if err != nil {
+		t.Fatalf("Query() = %v", err)
+	}
+	if len(first) != 2 || !more || first[0].Action != ActionMemberJoined || first[1].Action != ActionMemberKicked {
+		t.Fatalf("first page = %d entries, more %v, want the join and the kick with more to come", len(first), more)
+	}
+
+	filter.After = first[len(first)-1].Cursor
+	second, more, err := l.Query(ctx, filter)
+	if err != nil {
+		t.Fatalf("Query() = %v", err)
+	}
+	if len(second) != 1 || more || second[0].Action != ActionMemberLeft {
+		t.Errorf("second page = %d entries, more %v, want only the leave", len(second), more)
+	}
+
+	for _, cursor := range []string{"-1", "not-a-line"} {
+		if _, _, err := l.Query(ctx, Filter{After: cursor}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("Query(After %q) = %v, want ErrInvalidCursor", cursor, err)
+		}
+	}
+}
+
+func TestNilLog(t *testing.T) {
+	var l *Log
+	l.Record(context.Background(), &Entry{Action: ActionRoomDeleted})
+	if _, _, err := l.Query(context.Background(), Filter{}); !errors.Is(err, ErrNotQueryable) {
+		t.Errorf("Query() on a nil Log = %v, want ErrNotQueryable", err)
+	}
+}
@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// maxLineSize bounds the entries a query reads back from the file
+const maxLineSize = 1 << 20
+
+// FileSink appends entries to a local file, one JSON object per line. Every entry is synced to
+// disk before Write returns.
+type FileSink struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{
+		path: path,
+		file: file,
+	}, nil
+}
+
+func (s *FileSink) Write(ctx context.Context, entry *Entry) error {
+	marshalledEntry, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(marshalledEntry, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Query scans the whole file, the stream sink is the better choice for large logs
+func (s *FileSink) Query(ctx context.Context, filter Filter) ([]*Entry, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// the cursor is the number of the line of the last entry of the previous page
+	after := -1
+	if filter.After != "" {
+		after, err = strconv.Atoi(filter.After)
+		if err != nil || after < 0 {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	var entries []*Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for line := 0; scanner.Scan(); line++ {
+		if line <= after {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || !filter.matches(&entry) {
+			continue
+		}
+		entry.Cursor = strconv.Itoa(line)
+		entries = append(entries, &entry)
+		if len(entries) > filter.Max() {
+			break
+		}
+	}
+	return entries, scanner.Err()
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
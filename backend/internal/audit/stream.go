@@ -0,0 +1,110 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+const (
+	// streamBatch is how many stream entries a query reads at once
+	streamBatch = 500
+	// streamSkew widens the range of stream IDs a query reads. Stream IDs come from the Redis server's
+	// clock and entry times from the clock of the instance that recorded them, which may differ.
+	streamSkew = time.Minute
+)
+
+// StreamSink appends entries to a Redis stream. Stream IDs start with the time an entry was added
+// in unix milliseconds, so time ranges are read without an index. There is no index by room, so
+// it isn't meant for querying the entries of a room: without a time range such a query reads the
+// whole stream. Postgres is the sink for that.
+type StreamSink struct {
+	cli       *redis.Client
+	keyPrefix string
+	// maxLen roughly bounds the stream, the oldest entries are trimmed first. Zero keeps every entry.
+	maxLen int64
+}
+
+func NewStreamSink(cli *redis.Client, keyPrefix string, maxLen int64) *StreamSink {
+	return &StreamSink{
+		cli:       cli,
+		keyPrefix: keyPrefix,
+		maxLen:    maxLen,
+	}
+}
+
+func (s *StreamSink) key() string {
+	return s.keyPrefix + "audit"
+}
+
+func (s *StreamSink) Write(ctx context.Context, entry *Entry) error {
+	marshalledEntry, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return s.cli.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.key(),
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{"entry": marshalledEntry},
+	}).Err()
+}
+
+// Query reads the stream from the start of the filter's time range until it has found enough
+// entries, filtering by room as it goes
+func (s *StreamSink) Query(ctx context.Context, filter Filter) ([]*Entry, error) {
+	start, end := "-", "+"
+	if !filter.From.IsZero() {
+		start = strconv.FormatInt(filter.From.Add(-streamSkew).UnixMilli(), 10)
+	}
+	// the cursor is the ID of the last message of the previous page
+	if filter.After != "" {
+		if !validStreamID(filter.After) {
+			return nil, ErrInvalidCursor
+		}
+		start = "(" + filter.After
+	}
+	if !filter.To.IsZero() {
+		end = strconv.FormatInt(filter.To.Add(streamSkew).UnixMilli(), 10)
+	}
+
+	var entries []*Entry
+	for {
+		messages, err := s.cli.XRangeN(ctx, s.key(), start, end, streamBatch).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, message := range messages {
+			raw, _ := message.Values["entry"].(string)
+			var entry Entry
+			if err := json.Unmarshal([]byte(raw), &entry); err != nil || !filter.matches(&entry) {
+				continue
+			}
+			entry.Cursor = message.ID
+			entries = append(entries, &entry)
+			if len(entries) > filter.Max() {
+				return entries, nil
+			}
+		}
+		if len(messages) < streamBatch {
+			return entries, nil
+		}
+		// continue after the last message read
+		start = "(" + messages[len(messages)-1].ID
+	}
+}
+
+// validStreamID reports whether id has the form of a stream ID, <milliseconds>-<sequence>
+func validStreamID(id string) bool {
+	ms, seq, ok := strings.Cut(id, "-")
+	if !ok {
+		return false
+	}
+	_, msErr := strconv.ParseUint(ms, 10, 64)
+	_, seqErr := strconv.ParseUint(seq, 10, 64)
+	return msErr == nil && seqErr == nil
+}
@@ -0,0 +1,140 @@
+package codegen
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultCharset is the original 36 character room code alphabet
+	DefaultCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	// UnambiguousCharset drops characters that are easily confused when read aloud (0/O, 1/I)
+	UnambiguousCharset = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+var ErrCodeSpaceExhausted = errors.New("no free room code found")
+
+// vanityCodePattern allows letters, digits and inner dashes, e.g. "TEAM-STANDUP"
+var vanityCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9-]{2,30}[A-Z0-9]$`)
+
+// Normalize upper-cases a requested code so it matches the generated codes and what clients type
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Validate reports whether a normalized code can be used as a custom room code
+func Validate(code string) error {
+	if !vanityCodePattern.MatchString(code) {
+		return fmt.Errorf("room code must be 4-32 letters, digits or dashes and start and end with a letter or digit")
+	}
+	return nil
+}
+
+// Generator produces candidate room codes. What length means is up to the generator
+// (characters for CharsetGenerator, words for WordGenerator).
+type Generator interface {
+	Generate(length int) (string, error)
+}
+
+type CharsetGenerator struct {
+	Charset string
+}
+
+func (g CharsetGenerator) Generate(length int) (string, error) {
+	if len(g.Charset) < 2 {
+		return "", fmt.Errorf("charset must contain at least 2 characters")
+	}
+	var sb strings.Builder
+	sb.Grow(length)
+	for i := 0; i < length; i++ {
+		idx, err := randomIndex(len(g.Charset))
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(g.Charset[idx])
+	}
+	return sb.String(), nil
+}
+
+// WordGenerator produces human-friendly codes such as "AMBER-FALCON-RIVER"
+type WordGenerator struct {
+	Words     []string
+	Separator string
+}
+
+func (g WordGenerator) Generate(length int) (string, error) {
+	words := g.Words
+	if len(words) == 0 {
+		words = defaultWords
+	}
+	parts := make([]string, 0, length)
+	for i := 0; i < length; i++ {
+		idx, err := randomIndex(len(words))
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, words[idx])
+	}
+	return strings.Join(parts, g.Separator), nil
+}
+
+// randomIndex returns a uniformly distributed index in [0, n) from crypto/rand
+func randomIndex(n int) (int, error) {
+	idx, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	return int(idx.Int64()), nil
+}
+
+// Policy controls how codes are generated and reserved
+type Policy struct {
+	Generator Generator
+	// Length is the starting code length
+	Length int
+	// MaxLength is the longest code the policy escalates to before giving up
+	MaxLength int
+	// AttemptsPerLength is how many collisions are tolerated before the length is increased
+	AttemptsPerLength int
+}
+
+// ReserveFunc atomically reserves a code, reporting false if it was already taken
+type ReserveFunc func(ctx context.Context, code string) (bool, error)
+
+// Reserve generates codes until reserve accepts one. After AttemptsPerLength collisions
+// the length is increased by one, up to MaxLength, after which ErrCodeSpaceExhausted is returned.
+func (p *Policy) Reserve(ctx context.Context, reserve ReserveFunc) (string, error) {
+	maxLength := p.MaxLength
+	if maxLength < p.Length {
+		maxLength = p.Length
+	}
+	attempts := p.AttemptsPerLength
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	for length := p.Length; length <= maxLength; length++ {
+		for i := 0; i < attempts; i++ {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+			code, err := p.Generator.Generate(length)
+			if err != nil {
+				return "", err
+			}
+			reserved, err := reserve(ctx, code)
+			if err != nil {
+				return "", err
+			}
+			if reserved {
+				return code, nil
+			}
+		}
+	}
+	return "", ErrCodeSpaceExhausted
+}
@@ -0,0 +1,214 @@
+package codegen
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeValidate(t *testing.T) {
+	tests := []struct {
+		code    string
+		want    string
+		wantErr bool
+	}{
+		{code: "team-standup", want: "TEAM-STANDUP"},
+		{code: "  abc1 ", want: "ABC1"},
+		{code: "A1B2C3", want: "A1B2C3"},
+		{code: "abc", want: "ABC", wantErr: true},
+		{code: strings.Repeat("a", 32), want: strings.Repeat("A", 32)},
+		{code: strings.Repeat("a", 33), want: strings.Repeat("A", 33), wantErr: true},
+		{code: "-team", want: "-TEAM", wantErr: true},
+		{code: "team-", want: "TEAM-", wantErr: true},
+		{code: "team standup", want: "TEAM STANDUP", wantErr: true},
+		{code: "team_standup", want: "TEAM_STANDUP", wantErr: true},
+		{code: "", want: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			got := Normalize(tt.code)
+			if got != tt.want {
+				t.Fatalf("Normalize(%q) = %q, want %q", tt.code, got, tt.want)
+			}
+			if err := Validate(got); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate(%q) = %v, wantErr %v", got, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCharsetGenerator(t *testing.T) {
+	tests := []struct {
+		name    string
+		charset string
+		length  int
+		wantErr bool
+	}{
+		{name: "default", charset: DefaultCharset, length: 6},
+		{name: "unambiguous", charset: UnambiguousCharset, length: 8},
+		{name: "empty charset", charset: "", length: 6, wantErr: true},
+		{name: "single character", charset: "A", length: 6, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := CharsetGenerator{Charset: tt.charset}.Generate(tt.length)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Generate() = %q, want an error", code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate() = %v", err)
+			}
+			if len(code) != tt.length {
+				t.Fatalf("Generate() = %q, want %d characters", code, tt.length)
+			}
+			for _, c := range code {
+				if !strings.ContainsRune(tt.charset, c) {
+					t.Fatalf("Generate() = %q, %q isn't in the charset", code, c)
+				}
+			}
+		})
+	}
+}
+
+func TestWordGenerator(t *testing.T) {
+	tests := []struct {
+		name      string
+		generator WordGenerator
+		length    int
+	}{
+		{name: "default words", generator: WordGenerator{Separator: "-"}, length: 3},
+		{name: "custom words", generator: WordGenerator{Words: []string{"AMBER", "RIVER"}, Separator: "_"}, length: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := tt.generator.Generate(tt.length)
+			if err != nil {
+				t.Fatalf("Generate() = %v", err)
+			}
+			words := strings.Split(code, tt.generator.Separator)
+			if len(words) != tt.length {
+				t.Fatalf("Generate() = %q, want %d words", code, tt.length)
+			}
+			dictionary := tt.generator.Words
+			if len(dictionary) == 0 {
+				dictionary = defaultWords
+			}
+			for _, word := range words {
+				if !slices.Contains(dictionary, word) {
+					t.Fatalf("Generate() = %q, %q isn't a known word", code, word)
+				}
+			}
+		})
+	}
+}
+
+// lengthGenerator returns codes of "X"s so the tests can see which length was tried
+type lengthGenerator struct{}
+
+func (lengthGenerator) Generate(length int) (string, error) {
+	return strings.Repeat("X", length), nil
+}
+
+func TestPolicyReserve(t *testing.T) {
+	errRedis := errors.New("redis is down")
+
+	tests := []struct {
+		name   string
+		policy Policy
+		// taken reports how many codes of each length are rejected before one is accepted
+		taken     map[int]int
+		fail      bool
+		want      string
+		wantErr   error
+		wantTries int
+	}{
+		{
+			name:      "first code is free",
+			policy:    Policy{Length: 4, MaxLength: 6, AttemptsPerLength: 3},
+			want:      "XXXX",
+			wantTries: 1,
+		},
+		{
+			name:      "collisions below the limit keep the length",
+			policy:    Policy{Length: 4, MaxLength: 6, AttemptsPerLength: 3},
+			taken:     map[int]int{4: 2},
+			want:      "XXXX",
+			wantTries: 3,
+		},
+		{
+			name:      "escalates the length",
+			policy:    Policy{Length: 4, MaxLength: 6, AttemptsPerLength: 3},
+			taken:     map[int]int{4: 3, 5: 1},
+			want:      "XXXXX",
+			wantTries: 5,
+		},
+		{
+			name:      "exhausted",
+			policy:    Policy{Length: 4, MaxLength: 5, AttemptsPerLength: 2},
+			taken:     map[int]int{4: 2, 5: 2},
+			wantErr:   ErrCodeSpaceExhausted,
+			wantTries: 4,
+		},
+		{
+			name:      "max length below length tries the length",
+			policy:    Policy{Length: 4, MaxLength: 0, AttemptsPerLength: 0},
+			taken:     map[int]int{4: 1},
+			wantErr:   ErrCodeSpaceExhausted,
+			wantTries: 1,
+		},
+		{
+			name:      "reserve fails",
+			policy:    Policy{Length: 4, MaxLength: 6, AttemptsPerLength: 3},
+			fail:      true,
+			wantErr:   errRedis,
+			wantTries: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.policy.Generator = lengthGenerator{}
+			tries := 0
+			rejected := make(map[int]int)
+			reserve := func(ctx context.Context, code string) (bool, error) {
+				tries++
+				if tt.fail {
+					return false, errRedis
+				}
+				if rejected[len(code)] < tt.taken[len(code)] {
+					rejected[len(code)]++
+					return false, nil
+				}
+				return true, nil
+			}
+
+			code, err := tt.policy.Reserve(context.Background(), reserve)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reserve() = %v, want %v", err, tt.wantErr)
+			}
+			if code != tt.want {
+				t.Fatalf("Reserve() = %q, want %q", code, tt.want)
+			}
+			if tries != tt.wantTries {
+				t.Fatalf("Reserve() tried %d codes, want %d", tries, tt.wantTries)
+			}
+		})
+	}
+}
+
+func TestPolicyReserveCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	policy := Policy{Generator: lengthGenerator{}, Length: 4, MaxLength: 4, AttemptsPerLength: 1}
+	_, err := policy.Reserve(ctx, func(ctx context.Context, code string) (bool, error) {
+		t.Fatal("reserve called after the context was canceled")
+		return false, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Reserve() = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,13 @@
+package codegen
+
+// defaultWords is a short list of easy to spell, easy to pronounce words used by WordGenerator
+var defaultWords = []string{
+	"AMBER", "ANCHOR", "APPLE", "ARROW", "BADGER", "BAMBOO", "BEACON", "BIRCH",
+	"BISON", "BLOSSOM", "BREEZE", "BRIDGE", "CACTUS", "CANYON", "CEDAR", "CHERRY",
+	"CLOVER", "COMET", "CORAL", "COYOTE", "DELTA", "DUNE", "EAGLE", "EMBER",
+	"FALCON", "FERN", "FJORD", "FOREST", "GARNET", "GLACIER", "HARBOR", "HAZEL",
+	"HERON", "HOLLOW", "ISLAND", "IVORY", "JADE", "JASPER", "KESTREL", "LAGOON",
+	"LANTERN", "LEMON", "MAPLE", "MEADOW", "MESA", "MINT", "NECTAR", "OAK",
+	"OCEAN", "OLIVE", "ORBIT", "OTTER", "PEBBLE", "PINE", "PLUM", "PRAIRIE",
+	"QUARTZ", "RAVEN", "RIVER", "SAGE", "SPRUCE", "SUMMIT", "TIGER", "WILLOW",
+}
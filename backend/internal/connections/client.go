@@ -0,0 +1,38 @@
+package connections
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// closeTimeout bounds how long writing a close frame may take
+const closeTimeout = time.Second
+
+// Client wraps a websocket connection. gorilla/websocket supports only one
+// concurrent writer, so every write from the manager goes through writeMu.
+type Client struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	// roomCode is the room the connection joined, empty until it has joined one. It is guarded
+	// by the manager's mutex.
+	roomCode string
+}
+
+func NewClient(conn *websocket.Conn) *Client {
+	return &Client{conn: conn}
+}
+
+func (c *Client) WriteJSON(v interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteJSON(v)
+}
+
+// Close sends a close frame with the given code and reason and closes the connection
+func (c *Client) Close(code int, reason string) {
+	// WriteControl may be called concurrently with other writes
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(closeTimeout))
+	c.conn.Close()
+}
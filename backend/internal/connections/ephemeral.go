@@ -0,0 +1,75 @@
+package connections
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// ephemeralFlushInterval is how long ephemeral events are held so bursts can be coalesced
+const ephemeralFlushInterval = 100 * time.Millisecond
+
+// EphemeralEvent is a room event that is delivered once and never stored, like an emoji reaction
+type EphemeralEvent struct {
+	// Key identifies events that supersede each other, only the newest event with a key is delivered per flush
+	Key     string
+	Message map[string]interface{}
+	// Count is added up over the coalesced events and sent as "count" when non-zero
+	Count int
+}
+
+// ephemeralQueue holds the events of each room until their next flush
+type ephemeralQueue struct {
+	mu      sync.Mutex
+	pending map[string][]*EphemeralEvent
+}
+
+func newEphemeralQueue() *ephemeralQueue {
+	return &ephemeralQueue{pending: make(map[string][]*EphemeralEvent)}
+}
+
+// add queues an event and reports whether it is the room's first since the last flush
+func (q *ephemeralQueue) add(roomCode string, event *EphemeralEvent) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	events, ok := q.pending[roomCode]
+	for i, pending := range events {
+		if pending.Key == event.Key {
+			event.Count += pending.Count
+			events[i] = event
+			return false
+		}
+	}
+	q.pending[roomCode] = append(events, event)
+	return !ok
+}
+
+func (q *ephemeralQueue) take(roomCode string) []*EphemeralEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	events := q.pending[roomCode]
+	delete(q.pending, roomCode)
+	return events
+}
+
+// SendEphemeral queues an event for everyone in the room. Events are sent in
+// order of their first occurrence once the flush interval has passed.
+func (m *Manager) SendEphemeral(ctx context.Context, logger *log.Logger, roomCode string, event *EphemeralEvent) {
+	if !m.ephemeral.add(roomCode, event) {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	time.AfterFunc(ephemeralFlushInterval, func() {
+		for _, event := range m.ephemeral.take(roomCode) {
+			if event.Count > 0 {
+				event.Message["count"] = event.Count
+			}
+			if _, err := m.BroadcastToRoom(ctx, logger, roomCode, "", event.Message); err != nil {
+				logger.Printf("Failed to send %v to room %s: %v", event.Message["type"], roomCode, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package connections
+
+import "sync"
+
+// admissions holds the decision channels of the connections waiting in a lobby on this instance
+type admissions struct {
+	mu      sync.Mutex
+	waiting map[string]chan bool
+}
+
+func newAdmissions() *admissions {
+	return &admissions{waiting: make(map[string]chan bool)}
+}
+
+// AwaitAdmission registers a connection waiting in a lobby and returns the channel its decision is sent on
+func (m *Manager) AwaitAdmission(connID string) <-chan bool {
+	decision := make(chan bool, 1)
+	m.admissions.mu.Lock()
+	m.admissions.waiting[connID] = decision
+	m.admissions.mu.Unlock()
+	return decision
+}
+
+// DecideAdmission delivers a host's decision to a connection waiting on this instance
+// and reports whether the connection was waiting
+func (m *Manager) DecideAdmission(connID string, admitted bool) bool {
+	m.admissions.mu.Lock()
+	decision, ok := m.admissions.waiting[connID]
+	delete(m.admissions.waiting, connID)
+	m.admissions.mu.Unlock()
+
+	if ok {
+		decision <- admitted
+	}
+	return ok
+}
+
+// StopAwaitingAdmission forgets a connection that stopped waiting without a decision
+func (m *Manager) StopAwaitingAdmission(connID string) {
+	m.admissions.mu.Lock()
+	delete(m.admissions.waiting, connID)
+	m.admissions.mu.Unlock()
+}
+
+// RemoveConnection forgets a connection that never joined its room
+func (m *Manager) RemoveConnection(connID string) {
+	m.mu.Lock()
+	delete(m.connections, connID)
+	m.mu.Unlock()
+}
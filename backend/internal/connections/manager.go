@@ -3,8 +3,10 @@ package connections
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"sync"
 	"time"
 
@@ -17,24 +19,44 @@ import (
 
 type ConnManager interface {
 	RemoveConnectionFromRoom(ctx context.Context, logger *log.Logger, roomCode string, name string)
-	BroadcastToRoom(ctx context.Context, logger *log.Logger, roomCode string, senderName string, message map[string]interface{}) (string, error)
+	// BroadcastToRoom sends a message to every member connected to this manager but senderName, only to
+	// members with one of roles if any are given. It returns the members whose connections failed, the
+	// error joins the failure of every recipient.
+	BroadcastToRoom(ctx context.Context, logger *log.Logger, roomCode string, senderName string, message map[string]interface{}, roles ...string) ([]string, error)
 	SetConnection(conn *websocket.Conn) *rdsModels.ConnectionDetails
+	SendToConnection(connID string, message interface{}) error
+	CloseConnection(connID string, code int, reason string)
+	// CloseRoom closes the connections to the room held by this manager, reason tells members why
+	CloseRoom(ctx context.Context, logger *log.Logger, roomCode string, reason string)
+	// NotifyRoom sends a server event to the members of the room connected to this manager
+	NotifyRoom(ctx context.Context, logger *log.Logger, roomCode string, message map[string]interface{})
+	// LocalRooms returns the rooms members connected to this manager have joined
+	LocalRooms() []string
+	SendEphemeral(ctx context.Context, logger *log.Logger, roomCode string, event *EphemeralEvent)
+	AwaitAdmission(connID string) <-chan bool
+	DecideAdmission(connID string, admitted bool) bool
+	StopAwaitingAdmission(connID string)
+	RemoveConnection(connID string)
 	storage.Storage
 }
 
 type Manager struct {
 	rds         storage.Storage
 	mu          *sync.Mutex
-	connections map[string]*websocket.Conn
+	connections map[string]*Client
 	managerID   string
+	ephemeral   *ephemeralQueue
+	admissions  *admissions
 }
 
-func NewManager(rds storage.Storage, mu *sync.Mutex, conns map[string]*websocket.Conn, managerID string) *Manager {
+func NewManager(rds storage.Storage, mu *sync.Mutex, conns map[string]*Client, managerID string) *Manager {
 	return &Manager{
 		rds:         rds,
 		mu:          mu,
 		connections: conns,
 		managerID:   managerID,
+		ephemeral:   newEphemeralQueue(),
+		admissions:  newAdmissions(),
 	}
 }
 
@@ -76,6 +98,12 @@ func (c *Manager) RemoveConnectionFromRoom(ctx context.Context, logger *log.Logg
 		return
 	}
 
+	// persistent rooms outlive their members and are only removed by their owner
+	room, err := storage.GetRoom(ctx, roomCode)
+	if err == nil && keepWhenEmpty(room) {
+		return
+	}
+
 	const maxAttempts = 10
 	const sleepTime = 500
 	for i := 0; i < maxAttempts; i++ {
@@ -89,46 +117,211 @@ func (c *Manager) RemoveConnectionFromRoom(ctx context.Context, logger *log.Logg
 		time.Sleep(sleepTime * time.Millisecond)
 	}
 
+	// rooms whose members are in breakout rooms wait for them to come back
+	if c.hasOccupiedBreakouts(ctx, logger, roomCode) {
+		return
+	}
+
 	// If the room is still empty, delete it
-	err = storage.DeleteRoom(ctx, roomCode)
+	_, err = storage.DeleteRoom(ctx, roomCode)
 	if err != nil {
 		logger.Printf("Failed to remove room %s", roomCode)
+		return
+	}
+	c.deleteBreakouts(ctx, logger, roomCode)
+	if room != nil && room.ParentCode != "" {
+		c.removeBreakout(ctx, logger, room.ParentCode, roomCode)
 	}
 }
 
-func (m *Manager) BroadcastToRoom(ctx context.Context, logger *log.Logger, roomCode string, senderName string, message map[string]interface{}) (string, error) {
+// keepWhenEmpty reports whether a room stays once its last member leaves. Scheduled
+// rooms are kept until they end, when the scheduler removes them.
+func keepWhenEmpty(room *rdsModels.Room) bool {
+	return room.Flags.Persistent || room.EndsAt != nil && time.Now().Before(*room.EndsAt)
+}
+
+// hasOccupiedBreakouts reports whether anyone is in one of the room's breakout rooms
+func (c *Manager) hasOccupiedBreakouts(ctx context.Context, logger *log.Logger, roomCode string) bool {
+	breakouts, err := c.rds.GetBreakouts(ctx, roomCode)
+	if err != nil {
+		logger.Printf("Failed to get breakout rooms of room %s: %v", roomCode, err)
+		return false
+	}
+	for _, breakout := range breakouts {
+		if occupancy, err := c.rds.GetRoomOccupancy(ctx, breakout); err == nil && occupancy > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteBreakouts deletes the empty breakout rooms of a room that was deleted
+func (c *Manager) deleteBreakouts(ctx context.Context, logger *log.Logger, roomCode string) {
+	breakouts, err := c.rds.GetBreakouts(ctx, roomCode)
+	if err != nil {
+		logger.Printf("Failed to get breakout rooms of room %s: %v", roomCode, err)
+		return
+	}
+	for _, breakout := range breakouts {
+		if occupancy, err := c.rds.GetRoomOccupancy(ctx, breakout); err != nil || occupancy > 0 {
+			continue
+		}
+		if _, err := c.rds.DeleteRoom(ctx, breakout); err != nil {
+			logger.Printf("Failed to remove breakout room %s", breakout)
+		}
+	}
+}
+
+// removeBreakout unlinks a deleted breakout room from its parent, and deletes the parent
+// too if everyone left while they were in breakout rooms
+func (c *Manager) removeBreakout(ctx context.Context, logger *log.Logger, parentCode, roomCode string) {
+	if err := c.rds.RemoveBreakout(ctx, parentCode, roomCode); err != nil {
+		logger.Printf("Failed to unlink breakout room %s from room %s: %v", roomCode, parentCode, err)
+		return
+	}
+
+	active, err := c.rds.IsRoomActive(ctx, parentCode)
+	if err != nil || !active {
+		return
+	}
+	occupancy, err := c.rds.GetRoomOccupancy(ctx, parentCode)
+	if err != nil || occupancy > 0 {
+		return
+	}
+	parent, err := c.rds.GetRoom(ctx, parentCode)
+	if err != nil || keepWhenEmpty(parent) || c.hasOccupiedBreakouts(ctx, logger, parentCode) {
+		return
+	}
+	if _, err := c.rds.DeleteRoom(ctx, parentCode); err != nil {
+		logger.Printf("Failed to remove room %s", parentCode)
+		return
+	}
+	c.deleteBreakouts(ctx, logger, parentCode)
+}
+
+func (m *Manager) BroadcastToRoom(ctx context.Context, logger *log.Logger, roomCode string, senderName string, message map[string]interface{}, roles ...string) ([]string, error) {
 	storage := m.rds
 
 	names, err := storage.GetUserNamesFromRoom(ctx, roomCode)
 	if err != nil {
 		logger.Printf("Failed to get user names from room %s", roomCode)
-		return "", err
+		return nil, err
 	}
 
+	// one recipient failing must not keep the message from the rest
+	var faulty []string
+	var errs []error
 	for _, name := range names {
+		if name == senderName {
+			continue
+		}
 		connDetailsStr, err := storage.GetUserConnectionDetails(ctx, roomCode, name)
 		if err != nil {
-			return "", err
+			errs = append(errs, err)
+			continue
 		}
 
 		var connDetails rdsModels.ConnectionDetails
 		err = json.Unmarshal([]byte(connDetailsStr), &connDetails)
 		if err != nil {
 			logger.Printf("Failed to unmarshal connection details for %s in room %s", name, roomCode)
+			errs = append(errs, err)
+			continue
+		}
+		if len(roles) > 0 && !slices.Contains(roles, connDetails.Role) {
+			continue
+		}
+		// members connected to other instances are sent the message by their own manager
+		if connDetails.ManagerID != m.managerID {
+			continue
 		}
 
-		conn, ok := m.connections[connDetails.ConnectionID]
+		conn, ok := m.getClient(connDetails.ConnectionID)
 		if !ok {
-			return "", fmt.Errorf("connection not found for user %s in room %s", name, roomCode)
+			errs = append(errs, fmt.Errorf("connection not found for user %s in room %s", name, roomCode))
+			continue
+		}
+		if err := conn.WriteJSON(message); err != nil {
+			faulty = append(faulty, name)
+			errs = append(errs, fmt.Errorf("failed to send to user %s: %w", name, err))
 		}
-		if name != senderName {
-			err := conn.WriteJSON(message)
-			if err != nil {
-				return name, err
-			}
+	}
+	return faulty, errors.Join(errs...)
+}
+
+// CloseRoom tells the room's members connected to this manager that it was closed and closes their
+// connections. The members are removed from storage by their read loops once the connections drop.
+func (m *Manager) CloseRoom(ctx context.Context, logger *log.Logger, roomCode string, reason string) {
+	closed := map[string]interface{}{
+		"type":   "room-closed",
+		"reason": reason,
+	}
+	for _, connID := range m.localConnections(ctx, logger, roomCode) {
+		if err := m.SendToConnection(connID, closed); err != nil {
+			logger.Printf("Failed to notify connection %s of the closure of room %s: %v", connID, roomCode, err)
 		}
+		m.CloseConnection(connID, websocket.CloseNormalClosure, "room closed")
+	}
+}
+
+func (m *Manager) NotifyRoom(ctx context.Context, logger *log.Logger, roomCode string, message map[string]interface{}) {
+	for _, connID := range m.localConnections(ctx, logger, roomCode) {
+		if err := m.SendToConnection(connID, message); err != nil {
+			logger.Printf("Failed to send message to connection %s in room %s: %v", connID, roomCode, err)
+		}
+	}
+}
+
+// localConnections returns the IDs of the room's connections held by this manager
+func (m *Manager) localConnections(ctx context.Context, logger *log.Logger, roomCode string) []string {
+	names, err := m.rds.GetUserNamesFromRoom(ctx, roomCode)
+	if err != nil {
+		logger.Printf("Failed to get user names from room %s", roomCode)
+		return nil
+	}
+
+	var connIDs []string
+	for _, name := range names {
+		connDetailsStr, err := m.rds.GetUserConnectionDetails(ctx, roomCode, name)
+		if err != nil {
+			continue
+		}
+
+		var connDetails rdsModels.ConnectionDetails
+		if err := json.Unmarshal([]byte(connDetailsStr), &connDetails); err != nil {
+			logger.Printf("Failed to unmarshal connection details for %s in room %s", name, roomCode)
+			continue
+		}
+		if connDetails.ManagerID == m.managerID {
+			connIDs = append(connIDs, connDetails.ConnectionID)
+		}
+	}
+	return connIDs
+}
+
+func (m *Manager) getClient(connID string) (*Client, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	client, ok := m.connections[connID]
+	return client, ok
+}
+
+// SendToConnection writes a message to a single connection held by this manager
+func (m *Manager) SendToConnection(connID string, message interface{}) error {
+	client, ok := m.getClient(connID)
+	if !ok {
+		return fmt.Errorf("connection %s not found", connID)
+	}
+	return client.WriteJSON(message)
+}
+
+// CloseConnection closes a connection held by this manager with the given close code.
+// The connection's read loop is responsible for removing it from its room.
+func (m *Manager) CloseConnection(connID string, code int, reason string) {
+	client, ok := m.getClient(connID)
+	if ok {
+		client.Close(code, reason)
 	}
-	return "", nil
 }
 
 func (m *Manager) SetConnection(conn *websocket.Conn) *rdsModels.ConnectionDetails {
@@ -137,7 +330,7 @@ func (m *Manager) SetConnection(conn *websocket.Conn) *rdsModels.ConnectionDetai
 
 	// adding connection to in-memory map
 	m.mu.Lock()
-	m.connections[connID] = conn
+	m.connections[connID] = NewClient(conn)
 	m.mu.Unlock()
 
 	return &rdsModels.ConnectionDetails{
@@ -146,14 +339,22 @@ func (m *Manager) SetConnection(conn *websocket.Conn) *rdsModels.ConnectionDetai
 	}
 }
 
-func (m *Manager) CreateRoom(ctx context.Context, roomCode string) error {
-	return m.rds.CreateRoom(ctx, roomCode)
+func (m *Manager) CreateRoom(ctx context.Context, room *rdsModels.Room) (bool, error) {
+	return m.rds.CreateRoom(ctx, room)
 }
 
-func (m *Manager) DeleteRoom(ctx context.Context, roomCode string) error {
+func (m *Manager) DeleteRoom(ctx context.Context, roomCode string) (bool, error) {
 	return m.rds.DeleteRoom(ctx, roomCode)
 }
 
+func (m *Manager) GetRoom(ctx context.Context, roomCode string) (*rdsModels.Room, error) {
+	return m.rds.GetRoom(ctx, roomCode)
+}
+
+func (m *Manager) UpdateRoom(ctx context.Context, roomCode string, update func(room *rdsModels.Room) error) (*rdsModels.Room, error) {
+	return m.rds.UpdateRoom(ctx, roomCode, update)
+}
+
 func (m *Manager) IsRoomActive(ctx context.Context, roomCode string) (bool, error) {
 	return m.rds.IsRoomActive(ctx, roomCode)
 }
@@ -162,8 +363,34 @@ func (m *Manager) GetRoomOccupancy(ctx context.Context, roomCode string) (int, e
 	return m.rds.GetRoomOccupancy(ctx, roomCode)
 }
 
-func (m *Manager) AddUserToRoom(ctx context.Context, roomCode, username, connID string) error {
-	return m.rds.AddUserToRoom(ctx, roomCode, username, connID)
+func (m *Manager) AddUserToRoom(ctx context.Context, roomCode, memberID, role, connDetails string, moved bool) error {
+	if err := m.rds.AddUserToRoom(ctx, roomCode, memberID, role, connDetails, moved); err != nil {
+		return err
+	}
+
+	// remembering the room of local connections lets the manager find its rooms without storage
+	var details rdsModels.ConnectionDetails
+	if err := json.Unmarshal([]byte(connDetails), &details); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	if client, ok := m.connections[details.ConnectionID]; ok {
+		client.roomCode = roomCode
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Manager) LocalRooms() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rooms []string
+	for _, client := range m.connections {
+		if client.roomCode != "" && !slices.Contains(rooms, client.roomCode) {
+			rooms = append(rooms, client.roomCode)
+		}
+	}
+	return rooms
 }
 
 func (m *Manager) RemoveUserFromRoom(ctx context.Context, roomCode, username string) error {
@@ -178,6 +405,158 @@ func (m *Manager) GetUserConnectionDetails(ctx context.Context, roomCode, userna
 	return m.rds.GetUserConnectionDetails(ctx, roomCode, username)
 }
 
-func (m *Manager) CanUserJoinRoom(ctx context.Context, roomCode, name string) error {
-	return m.rds.CanUserJoinRoom(ctx, roomCode, name)
+func (m *Manager) GetMembers(ctx context.Context, roomCode string) (map[string]*rdsModels.ConnectionDetails, error) {
+	return m.rds.GetMembers(ctx, roomCode)
+}
+
+func (m *Manager) GetViewerCount(ctx context.Context, roomCode string) (int, error) {
+	return m.rds.GetViewerCount(ctx, roomCode)
+}
+
+func (m *Manager) CanUserJoinRoom(ctx context.Context, roomCode, name, role string, moved bool) error {
+	return m.rds.CanUserJoinRoom(ctx, roomCode, name, role, moved)
+}
+
+func (m *Manager) SetMediaState(ctx context.Context, roomCode, name string, state *rdsModels.MediaState) error {
+	return m.rds.SetMediaState(ctx, roomCode, name, state)
+}
+
+func (m *Manager) RemoveMediaState(ctx context.Context, roomCode, name string) error {
+	return m.rds.RemoveMediaState(ctx, roomCode, name)
+}
+
+func (m *Manager) GetMediaStates(ctx context.Context, roomCode string) (map[string]*rdsModels.MediaState, error) {
+	return m.rds.GetMediaStates(ctx, roomCode)
+}
+
+func (m *Manager) ClaimPresenter(ctx context.Context, roomCode, name string) (string, error) {
+	return m.rds.ClaimPresenter(ctx, roomCode, name)
+}
+
+func (m *Manager) ReleasePresenter(ctx context.Context, roomCode, name string) (bool, error) {
+	return m.rds.ReleasePresenter(ctx, roomCode, name)
+}
+
+func (m *Manager) GetPresenter(ctx context.Context, roomCode string) (string, error) {
+	return m.rds.GetPresenter(ctx, roomCode)
+}
+
+func (m *Manager) GrantPresenter(ctx context.Context, roomCode, name string) (string, error) {
+	return m.rds.GrantPresenter(ctx, roomCode, name)
+}
+
+func (m *Manager) EnqueuePresenter(ctx context.Context, roomCode, name string) (bool, error) {
+	return m.rds.EnqueuePresenter(ctx, roomCode, name)
+}
+
+func (m *Manager) DequeuePresenter(ctx context.Context, roomCode, name string) (bool, error) {
+	return m.rds.DequeuePresenter(ctx, roomCode, name)
+}
+
+func (m *Manager) AdvancePresenterQueue(ctx context.Context, roomCode string) (string, error) {
+	return m.rds.AdvancePresenterQueue(ctx, roomCode)
+}
+
+func (m *Manager) GetPresenterQueue(ctx context.Context, roomCode string) ([]string, error) {
+	return m.rds.GetPresenterQueue(ctx, roomCode)
+}
+
+func (m *Manager) GrantControl(ctx context.Context, roomCode, presenter, controller string) (string, error) {
+	return m.rds.GrantControl(ctx, roomCode, presenter, controller)
+}
+
+func (m *Manager) RevokeControl(ctx context.Context, roomCode, presenter string) (string, error) {
+	return m.rds.RevokeControl(ctx, roomCode, presenter)
+}
+
+func (m *Manager) ReleaseControl(ctx context.Context, roomCode, controller string) (string, error) {
+	return m.rds.ReleaseControl(ctx, roomCode, controller)
+}
+
+func (m *Manager) GetControlledPresenter(ctx context.Context, roomCode, controller string) (string, error) {
+	return m.rds.GetControlledPresenter(ctx, roomCode, controller)
+}
+
+func (m *Manager) AddChatMessage(ctx context.Context, roomCode string, message *rdsModels.ChatMessage, historySize int) error {
+	return m.rds.AddChatMessage(ctx, roomCode, message, historySize)
+}
+
+func (m *Manager) GetChatMessages(ctx context.Context, roomCode string, count int) ([]*rdsModels.ChatMessage, error) {
+	return m.rds.GetChatMessages(ctx, roomCode, count)
+}
+
+func (m *Manager) RaiseHand(ctx context.Context, roomCode, name string, raisedAt time.Time) error {
+	return m.rds.RaiseHand(ctx, roomCode, name, raisedAt)
+}
+
+func (m *Manager) LowerHand(ctx context.Context, roomCode, name string) (bool, error) {
+	return m.rds.LowerHand(ctx, roomCode, name)
+}
+
+func (m *Manager) GetRaisedHands(ctx context.Context, roomCode string) (map[string]time.Time, error) {
+	return m.rds.GetRaisedHands(ctx, roomCode)
+}
+
+func (m *Manager) BanFromRoom(ctx context.Context, roomCode, name string, until time.Time) error {
+	return m.rds.BanFromRoom(ctx, roomCode, name, until)
+}
+
+func (m *Manager) AddKnock(ctx context.Context, roomCode string, knock *rdsModels.Knock) (bool, error) {
+	return m.rds.AddKnock(ctx, roomCode, knock)
+}
+
+func (m *Manager) RemoveKnock(ctx context.Context, roomCode, name string) (*rdsModels.Knock, error) {
+	return m.rds.RemoveKnock(ctx, roomCode, name)
+}
+
+func (m *Manager) GetKnocks(ctx context.Context, roomCode string) ([]*rdsModels.Knock, error) {
+	return m.rds.GetKnocks(ctx, roomCode)
+}
+
+func (m *Manager) AddBreakout(ctx context.Context, parentCode, roomCode string) error {
+	return m.rds.AddBreakout(ctx, parentCode, roomCode)
+}
+
+func (m *Manager) RemoveBreakout(ctx context.Context, parentCode, roomCode string) error {
+	return m.rds.RemoveBreakout(ctx, parentCode, roomCode)
+}
+
+func (m *Manager) GetBreakouts(ctx context.Context, parentCode string) ([]string, error) {
+	return m.rds.GetBreakouts(ctx, parentCode)
+}
+
+func (m *Manager) SetJoinPass(ctx context.Context, roomCode, name, tokenHash string, ttl time.Duration) error {
+	return m.rds.SetJoinPass(ctx, roomCode, name, tokenHash, ttl)
+}
+
+func (m *Manager) ConsumeJoinPass(ctx context.Context, roomCode, name, tokenHash string) (bool, error) {
+	return m.rds.ConsumeJoinPass(ctx, roomCode, name, tokenHash)
+}
+
+func (m *Manager) AppendAnnotation(ctx context.Context, roomCode string, annotation *rdsModels.Annotation, maxAnnotations int) (int64, error) {
+	return m.rds.AppendAnnotation(ctx, roomCode, annotation, maxAnnotations)
+}
+
+func (m *Manager) GetAnnotations(ctx context.Context, roomCode string, afterSeq int64) ([]*rdsModels.Annotation, error) {
+	return m.rds.GetAnnotations(ctx, roomCode, afterSeq)
+}
+
+func (m *Manager) ScheduleRoomEvent(ctx context.Context, event *rdsModels.RoomEvent) error {
+	return m.rds.ScheduleRoomEvent(ctx, event)
+}
+
+func (m *Manager) ClaimRoomEvents(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*rdsModels.RoomEvent, error) {
+	return m.rds.ClaimRoomEvents(ctx, now, lease, limit)
+}
+
+func (m *Manager) CompleteRoomEvent(ctx context.Context, event *rdsModels.RoomEvent) error {
+	return m.rds.CompleteRoomEvent(ctx, event)
+}
+
+func (m *Manager) PublishRoomEvent(ctx context.Context, event *rdsModels.RoomEvent) error {
+	return m.rds.PublishRoomEvent(ctx, event)
+}
+
+func (m *Manager) SubscribeRoomEvents(ctx context.Context) (<-chan *rdsModels.RoomEvent, error) {
+	return m.rds.SubscribeRoomEvents(ctx)
 }
@@ -0,0 +1,98 @@
+package connections
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/storage"
+	rdsModels "github.com/AnishG-git/streamify/internal/storage/models"
+	"github.com/gorilla/websocket"
+)
+
+// fakeStorage keeps the members of a single room in memory, in the order they joined. Methods
+// the tests don't need are left to the embedded nil interface and panic if called.
+type fakeStorage struct {
+	storage.Storage
+	names   []string
+	members map[string]*rdsModels.ConnectionDetails
+}
+
+func (s *fakeStorage) join(name string, details *rdsModels.ConnectionDetails) {
+	s.names = append(s.names, name)
+	s.members[name] = details
+}
+
+func (s *fakeStorage) GetUserNamesFromRoom(ctx context.Context, roomCode string) ([]string, error) {
+	return s.names, nil
+}
+
+func (s *fakeStorage) GetUserConnectionDetails(ctx context.Context, roomCode, username string) (string, error) {
+	details, ok := s.members[username]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", storage.ErrMemberNotFound, username)
+	}
+	b, err := json.Marshal(details)
+	return string(b), err
+}
+
+// connect opens a websocket to a test server, adds the server side to the manager and returns
+// the client side
+func connect(t *testing.T, m *Manager) (*websocket.Conn, *rdsModels.ConnectionDetails) {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	serverConns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		serverConns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, m.SetConnection(<-serverConns)
+}
+
+func TestBroadcastToRoomSkipsOtherInstances(t *testing.T) {
+	rds := &fakeStorage{members: make(map[string]*rdsModels.ConnectionDetails)}
+	m := NewManager(rds, &sync.Mutex{}, make(map[string]*Client), "manager-a")
+	logger := log.New(io.Discard, "", 0)
+
+	// members on another instance and a stale local entry come before the local member
+	rds.join("remote", &rdsModels.ConnectionDetails{ManagerID: "manager-b", ConnectionID: "elsewhere"})
+	rds.join("stale", &rdsModels.ConnectionDetails{ManagerID: "manager-a", ConnectionID: "gone"})
+	conn, details := connect(t, m)
+	rds.join("local", details)
+
+	faulty, err := m.BroadcastToRoom(context.Background(), logger, "ABC123", "", map[string]interface{}{"type": "chat"})
+	if err == nil || !strings.Contains(err.Error(), "stale") {
+		t.Errorf("err = %v, want the stale member's missing connection", err)
+	}
+	if len(faulty) != 0 {
+		t.Errorf("faulty = %v, want none", faulty)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var got map[string]interface{}
+	if err := conn.ReadJSON(&got); err != nil {
+		t.Fatalf("local member got no message: %v", err)
+	}
+	if got["type"] != "chat" {
+		t.Errorf("local member got %v, want the chat message", got)
+	}
+}
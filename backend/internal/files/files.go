@@ -0,0 +1,399 @@
+// Package files relays files between the members of a room over their WebSockets.
+// A sender offers a file, recipients accept it and the sender streams it in
+// numbered chunks that are passed on to everyone who accepted. When spooling
+// is enabled the chunks are also written to local disk, so the completed file
+// can be downloaded over HTTP until it expires. Transfers are held in memory,
+// so sender and recipients must be connected to the same backend instance.
+package files
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTooLarge         = errors.New("file is too large")
+	ErrQuotaExceeded    = errors.New("room file quota exceeded")
+	ErrTransferNotFound = errors.New("file transfer not found")
+	ErrNotAllowed       = errors.New("not a party to this file transfer")
+	ErrOutOfOrder       = errors.New("chunk out of order")
+	ErrSizeMismatch     = errors.New("chunks do not add up to the offered size")
+	ErrInvalidFileName  = errors.New("invalid file name")
+)
+
+const (
+	maxFileNameLength = 255
+	// cleanupInterval is how often expired spooled files are removed
+	cleanupInterval = time.Minute
+)
+
+type Config struct {
+	// MaxFileSize is the largest file in bytes that can be offered
+	MaxFileSize int64
+	// RoomQuota is how many bytes of files a room can have in flight or spooled at once
+	RoomQuota int64
+	// SpoolDir keeps completed files for download, spooling is disabled when empty
+	SpoolDir string
+	// Instance names this process's subdirectory of SpoolDir, so instances sharing the
+	// directory keep their files apart. It should stay the same across restarts.
+	Instance string
+	// SpoolTTL is how long spooled files can be downloaded after they complete
+	SpoolTTL time.Duration
+}
+
+// Transfer describes a file offered to a room
+type Transfer struct {
+	ID       string `json:"id"`
+	From     string `json:"from"`
+	FileName string `json:"name"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mime"`
+	// To is the only recipient, everyone but the sender can accept when empty
+	To          string     `json:"to,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	// ExpiresAt is when a spooled file stops being downloadable
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// transfer must only be used with Manager.mu held
+type transfer struct {
+	Transfer
+	roomCode string
+	// token authorizes downloading the spooled file
+	token    string
+	accepted map[string]bool
+	received int64
+	nextSeq  int
+	spool    *os.File
+	done     bool
+}
+
+type Manager struct {
+	config Config
+	logger *log.Logger
+	// spoolDir is this instance's subdirectory of the configured spool directory
+	spoolDir string
+
+	mu        sync.Mutex
+	transfers map[string]*transfer
+	// usage is the bytes reserved by each room's transfers
+	usage map[string]int64
+}
+
+// New creates this instance's spool directory if spooling is enabled, dropping files
+// left behind by its previous run since their transfers are gone. The configured
+// directory itself and the other instances' files are left alone.
+func New(config Config, logger *log.Logger) (*Manager, error) {
+	var spoolDir string
+	if config.SpoolDir != "" {
+		instance := filepath.Base(config.Instance)
+		if instance == "." || instance == "/" || instance == ".." {
+			return nil, fmt.Errorf("invalid file spool instance %q", config.Instance)
+		}
+		spoolDir = filepath.Join(config.SpoolDir, instance)
+		if err := os.RemoveAll(spoolDir); err != nil {
+			return nil, fmt.Errorf("failed to clear file spool: %w", err)
+		}
+		if err := os.MkdirAll(spoolDir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create file spool: %w", err)
+		}
+	}
+
+	m := &Manager{
+		config:    config,
+		spoolDir:  spoolDir,
+		logger:    logger,
+		transfers: make(map[string]*transfer),
+		usage:     make(map[string]int64),
+	}
+	if config.SpoolDir != "" {
+		go m.removeExpired()
+	}
+	return m, nil
+}
+
+// Spooling reports whether completed files can be downloaded over HTTP
+func (m *Manager) Spooling() bool {
+	return m.config.SpoolDir != ""
+}
+
+// Offer registers a file a member wants to send and reserves its size in the room's quota
+func (m *Manager) Offer(roomCode, from, fileName, mimeType string, size int64, to string) (*Transfer, error) {
+	fileName = filepath.Base(strings.ReplaceAll(fileName, "\\", "/"))
+	if fileName == "." || fileName == "/" || len(fileName) > maxFileNameLength {
+		return nil, ErrInvalidFileName
+	}
+	if size <= 0 || size > m.config.MaxFileSize {
+		return nil, fmt.Errorf("%w, the limit is %d bytes", ErrTooLarge, m.config.MaxFileSize)
+	}
+
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	token, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.usage[roomCode]+size > m.config.RoomQuota {
+		return nil, fmt.Errorf("%w, %d of %d bytes are in use", ErrQuotaExceeded, m.usage[roomCode], m.config.RoomQuota)
+	}
+
+	t := &transfer{
+		Transfer: Transfer{
+			ID:        id,
+			From:      from,
+			FileName:  fileName,
+			Size:      size,
+			MimeType:  mimeType,
+			To:        to,
+			CreatedAt: time.Now().UTC(),
+		},
+		roomCode: roomCode,
+		token:    token,
+		accepted: make(map[string]bool),
+	}
+	if m.Spooling() {
+		t.spool, err = os.Create(m.spoolPath(id))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create spool file: %w", err)
+		}
+	}
+
+	m.transfers[id] = t
+	m.usage[roomCode] += size
+	return t.info(), nil
+}
+
+// Accept adds a recipient, who receives every chunk sent from now on
+func (m *Manager) Accept(roomCode, id, name string) (*Transfer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, err := m.get(roomCode, id)
+	if err != nil {
+		return nil, err
+	}
+	if !t.isRecipient(name) {
+		return nil, ErrNotAllowed
+	}
+	t.accepted[name] = true
+	return t.info(), nil
+}
+
+// Chunk records the next chunk from the sender and returns the recipients it should be relayed to
+func (m *Manager) Chunk(roomCode, id, from string, seq int, data []byte) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, err := m.get(roomCode, id)
+	if err != nil {
+		return nil, err
+	}
+	if t.From != from || t.done {
+		return nil, ErrNotAllowed
+	}
+	if seq != t.nextSeq {
+		return nil, fmt.Errorf("%w, expected %d", ErrOutOfOrder, t.nextSeq)
+	}
+	if t.received+int64(len(data)) > t.Size {
+		return nil, ErrSizeMismatch
+	}
+
+	if t.spool != nil {
+		if _, err := t.spool.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to spool chunk: %w", err)
+		}
+	}
+	t.received += int64(len(data))
+	t.nextSeq++
+
+	recipients := make([]string, 0, len(t.accepted))
+	for name := range t.accepted {
+		recipients = append(recipients, name)
+	}
+	return recipients, nil
+}
+
+// Complete ends a transfer once every byte was sent. Spooled files stay
+// downloadable with the returned token until they expire, other transfers
+// are forgotten right away and have no token.
+func (m *Manager) Complete(roomCode, id, from string) (*Transfer, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, err := m.get(roomCode, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if t.From != from || t.done {
+		return nil, "", ErrNotAllowed
+	}
+	if t.received != t.Size {
+		return nil, "", fmt.Errorf("%w, received %d of %d bytes", ErrSizeMismatch, t.received, t.Size)
+	}
+
+	now := time.Now().UTC()
+	t.done = true
+	t.CompletedAt = &now
+	if t.spool == nil {
+		m.remove(t)
+		return t.info(), "", nil
+	}
+
+	if err := t.spool.Close(); err != nil {
+		m.remove(t)
+		return nil, "", fmt.Errorf("failed to close spool file: %w", err)
+	}
+	t.spool = nil
+	expiresAt := now.Add(m.config.SpoolTTL)
+	t.ExpiresAt = &expiresAt
+	return t.info(), t.token, nil
+}
+
+// Cancel stops a transfer. The sender cancels it for everyone and reports all as
+// true, a recipient only stops receiving it.
+func (m *Manager) Cancel(roomCode, id, name string) (*Transfer, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, err := m.get(roomCode, id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch {
+	case t.From == name:
+		m.remove(t)
+		return t.info(), true, nil
+	case t.accepted[name]:
+		delete(t.accepted, name)
+		return t.info(), false, nil
+	default:
+		return nil, false, ErrNotAllowed
+	}
+}
+
+// RemoveMember cancels the unfinished transfers of a member who left and returns them
+func (m *Manager) RemoveMember(roomCode, name string) []*Transfer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var cancelled []*Transfer
+	for _, t := range m.transfers {
+		if t.roomCode != roomCode {
+			continue
+		}
+		delete(t.accepted, name)
+		if t.From == name && !t.done {
+			m.remove(t)
+			cancelled = append(cancelled, t.info())
+		}
+	}
+	return cancelled
+}
+
+// CloseRoom removes every transfer and spooled file of a room that was deleted
+func (m *Manager) CloseRoom(roomCode string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range m.transfers {
+		if t.roomCode == roomCode {
+			m.remove(t)
+		}
+	}
+}
+
+// Open returns a completed spooled file for download. The caller closes it.
+func (m *Manager) Open(roomCode, id, token string) (*os.File, *Transfer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, err := m.get(roomCode, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !t.done || t.ExpiresAt == nil || subtle.ConstantTimeCompare([]byte(token), []byte(t.token)) != 1 {
+		return nil, nil, ErrTransferNotFound
+	}
+
+	f, err := os.Open(m.spoolPath(id))
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, t.info(), nil
+}
+
+// get must be called with m.mu held
+func (m *Manager) get(roomCode, id string) (*transfer, error) {
+	t, ok := m.transfers[id]
+	if !ok || t.roomCode != roomCode {
+		return nil, ErrTransferNotFound
+	}
+	return t, nil
+}
+
+// remove must be called with m.mu held. It drops a transfer, its spool file and its quota.
+func (m *Manager) remove(t *transfer) {
+	delete(m.transfers, t.ID)
+	m.usage[t.roomCode] -= t.Size
+	if m.usage[t.roomCode] <= 0 {
+		delete(m.usage, t.roomCode)
+	}
+
+	if !m.Spooling() {
+		return
+	}
+	if t.spool != nil {
+		t.spool.Close()
+		t.spool = nil
+	}
+	if err := os.Remove(m.spoolPath(t.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		m.logger.Printf("Failed to remove spooled file %s: %v", t.ID, err)
+	}
+}
+
+func (m *Manager) spoolPath(id string) string {
+	return filepath.Join(m.spoolDir, id)
+}
+
+func (m *Manager) removeExpired() {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		m.mu.Lock()
+		for _, t := range m.transfers {
+			if t.ExpiresAt != nil && now.After(*t.ExpiresAt) {
+				m.remove(t)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// info returns a copy of the transfer's description that is safe to use without the lock
+func (t *transfer) info() *Transfer {
+	info := t.Transfer
+	return &info
+}
+
+// isRecipient reports whether name may accept the transfer
+func (t *transfer) isRecipient(name string) bool {
+	return name != t.From && (t.To == "" || t.To == name)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,110 @@
+package files
+
+import (
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+func testManager(t *testing.T) *Manager {
+	t.Helper()
+	m, err := New(Config{
+		MaxFileSize: 10,
+		RoomQuota:   15,
+		SpoolDir:    t.TempDir(),
+		Instance:    "test",
+		SpoolTTL:    time.Hour,
+	}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	return m
+}
+
+func TestTransfer(t *testing.T) {
+	m := testManager(t)
+
+	offered, err := m.Offer("ABC123", "alice", "../../notes.txt", "text/plain", 6, "bob")
+	if err != nil {
+		t.Fatalf("Offer() = %v", err)
+	}
+	if offered.FileName != "notes.txt" {
+		t.Errorf("FileName = %q, want the path stripped", offered.FileName)
+	}
+
+	// only the addressed recipient may accept
+	if _, err := m.Accept("ABC123", offered.ID, "carol"); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("Accept(carol) = %v, want ErrNotAllowed", err)
+	}
+	if _, err := m.Accept("XYZ789", offered.ID, "bob"); !errors.Is(err, ErrTransferNotFound) {
+		t.Errorf("Accept() from another room = %v, want ErrTransferNotFound", err)
+	}
+	if _, err := m.Accept("ABC123", offered.ID, "bob"); err != nil {
+		t.Fatalf("Accept(bob) = %v", err)
+	}
+
+	if _, err := m.Chunk("ABC123", offered.ID, "bob", 0, []byte("abc")); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("Chunk() from a recipient = %v, want ErrNotAllowed", err)
+	}
+	if _, err := m.Chunk("ABC123", offered.ID, "alice", 1, []byte("abc")); !errors.Is(err, ErrOutOfOrder) {
+		t.Errorf("Chunk(1) before chunk 0 = %v, want ErrOutOfOrder", err)
+	}
+	recipients, err := m.Chunk("ABC123", offered.ID, "alice", 0, []byte("abc"))
+	if err != nil || len(recipients) != 1 || recipients[0] != "bob" {
+		t.Fatalf("Chunk(0) = %v, %v, want [bob]", recipients, err)
+	}
+	if _, _, err := m.Complete("ABC123", offered.ID, "alice"); !errors.Is(err, ErrSizeMismatch) {
+		t.Errorf("Complete() with bytes missing = %v, want ErrSizeMismatch", err)
+	}
+	if _, err := m.Chunk("ABC123", offered.ID, "alice", 1, []byte("defg")); !errors.Is(err, ErrSizeMismatch) {
+		t.Errorf("Chunk() past the offered size = %v, want ErrSizeMismatch", err)
+	}
+	if _, err := m.Chunk("ABC123", offered.ID, "alice", 1, []byte("def")); err != nil {
+		t.Fatalf("Chunk(1) = %v", err)
+	}
+
+	completed, token, err := m.Complete("ABC123", offered.ID, "alice")
+	if err != nil || completed.ExpiresAt == nil || token == "" {
+		t.Fatalf("Complete() = %+v, %q, %v, want a downloadable file", completed, token, err)
+	}
+	if _, _, err := m.Open("ABC123", offered.ID, "wrong"); !errors.Is(err, ErrTransferNotFound) {
+		t.Errorf("Open() with the wrong token = %v, want ErrTransferNotFound", err)
+	}
+	f, _, err := m.Open("ABC123", offered.ID, token)
+	if err != nil {
+		t.Fatalf("Open() = %v", err)
+	}
+	defer f.Close()
+	if data, err := io.ReadAll(f); err != nil || string(data) != "abcdef" {
+		t.Errorf("spooled file = %q, %v, want abcdef", data, err)
+	}
+}
+
+func TestRoomQuota(t *testing.T) {
+	m := testManager(t)
+
+	if _, err := m.Offer("ABC123", "alice", "big.bin", "", 11, ""); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Offer() over the file size limit = %v, want ErrTooLarge", err)
+	}
+	first, err := m.Offer("ABC123", "alice", "a.bin", "", 10, "")
+	if err != nil {
+		t.Fatalf("Offer() = %v", err)
+	}
+	if _, err := m.Offer("ABC123", "bob", "b.bin", "", 10, ""); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Offer() over the room quota = %v, want ErrQuotaExceeded", err)
+	}
+	// every room has a quota of its own
+	if _, err := m.Offer("XYZ789", "bob", "b.bin", "", 10, ""); err != nil {
+		t.Errorf("Offer() in another room = %v, want nil", err)
+	}
+
+	// a sender leaving gives the quota back
+	if cancelled := m.RemoveMember("ABC123", "alice"); len(cancelled) != 1 || cancelled[0].ID != first.ID {
+		t.Errorf("RemoveMember() = %+v, want alice's transfer cancelled", cancelled)
+	}
+	if _, err := m.Offer("ABC123", "bob", "b.bin", "", 10, ""); err != nil {
+		t.Errorf("Offer() after the quota was freed = %v, want nil", err)
+	}
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/AnishG-git/streamify/internal/logic"
+	"github.com/AnishG-git/streamify/internal/ratelimit"
+
+	rdsModels "github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type externalLoginRequest struct {
+	// Assertion is the JWT the identity provider issued
+	Assertion string `json:"assertion"`
+}
+
+// authToken reads the session token from the Authorization header
+func authToken(r *http.Request) string {
+	return ownerToken(r)
+}
+
+// signedInUser authenticates the request and writes the error response if that fails
+func (h *Handlers) signedInUser(w http.ResponseWriter, r *http.Request) (*rdsModels.User, bool) {
+	user, err := logic.AuthenticateLogic(r.Context(), &h.config.Accounts, authToken(r))
+	if err != nil {
+		writeRoomError(w, err)
+		return nil, false
+	}
+	return user, true
+}
+
+func writeSignIn(w http.ResponseWriter, signIn *logic.SignIn, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(signIn)
+}
+
+func (h *Handlers) RegisterHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		h.logger.Print("/auth/register endpoint called")
+
+		var registration logic.Registration
+		if err := json.NewDecoder(r.Body).Decode(&registration); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		signIn, err := logic.RegisterLogic(ctx, h.logger, &h.config.Accounts, registration)
+		if err != nil {
+			writeRoomError(w, err)
+			return
+		}
+
+		writeSignIn(w, signIn, http.StatusCreated)
+	}
+}
+
+func (h *Handlers) LoginHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		h.logger.Print("/auth/login endpoint called")
+
+		var login loginRequest
+		if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		signIn, err := logic.LoginLogic(ctx, h.logger, &h.config.Accounts, login.Email, login.Password)
+		if err != nil {
+			writeRoomError(w, err)
+			return
+		}
+
+		writeSignIn(w, signIn, http.StatusOK)
+	}
+}
+
+func (h *Handlers) ExternalLoginHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		h.logger.Print("/auth/external endpoint called")
+
+		var login externalLoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		signIn, err := logic.ExternalLoginLogic(ctx, h.logger, &h.config.Accounts, login.Assertion)
+		if err != nil {
+			writeRoomError(w, err)
+			return
+		}
+
+		writeSignIn(w, signIn, http.StatusOK)
+	}
+}
+
+func (h *Handlers) LogoutHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if err := logic.LogoutLogic(ctx, &h.config.Accounts, authToken(r)); err != nil {
+			writeRoomError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *Handlers) GetProfileHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := h.signedInUser(w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(user)
+	}
+}
+
+func (h *Handlers) UpdateProfileHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		user, ok := h.signedInUser(w, r)
+		if !ok {
+			return
+		}
+
+		var update logic.ProfileUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		user, err := logic.UpdateProfileLogic(ctx, h.logger, &h.config.Accounts, user, authToken(r), update)
+		if err != nil {
+			writeRoomError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(user)
+	}
+}
+
+func (h *Handlers) MyRoomsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		user, ok := h.signedInUser(w, r)
+		if !ok {
+			return
+		}
+
+		rooms, err := logic.MyRoomsLogic(ctx, h.logger, h.manager, &h.config.Accounts, user)
+		if err != nil {
+			writeRoomError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(rooms)
+	}
+}
+
+// UserKey keys rate limits by the signed-in user, whose session token is read from the query
+// parameter queryParam or, when it is empty, from the Authorization header. Requests without a
+// valid session aren't keyed, so nobody can spend someone else's limit.
+func (h *Handlers) UserKey(queryParam string) ratelimit.KeyFunc {
+	return func(r *http.Request) string {
+		if h.config.Accounts.Users == nil {
+			return ""
+		}
+		token := authToken(r)
+		if queryParam != "" {
+			token = r.URL.Query().Get(queryParam)
+		}
+		if token == "" {
+			return ""
+		}
+		user, err := logic.AuthenticateLogic(r.Context(), &h.config.Accounts, token)
+		if err != nil {
+			return ""
+		}
+		return user.ID
+	}
+}
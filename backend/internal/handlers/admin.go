@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/codegen"
+	"github.com/AnishG-git/streamify/internal/logic"
+)
+
+// adminAuthorized checks the admin token. Without a configured token the admin endpoints
+// answer 404 as if they didn't exist.
+func (h *Handlers) adminAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	if h.config.AdminToken == "" {
+		http.NotFound(w, r)
+		return false
+	}
+	token := ownerToken(r)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.config.AdminToken)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (h *Handlers) AuditLogHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if !h.adminAuthorized(w, r) {
+			return
+		}
+
+		params := r.URL.Query()
+		query := logic.AuditQuery{RoomCode: codegen.Normalize(params.Get("room")), After: params.Get("after")}
+		if from := params.Get("from"); from != "" {
+			var err error
+			query.From, err = time.Parse(time.RFC3339, from)
+			if err != nil {
+				http.Error(w, "from must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+		}
+		if to := params.Get("to"); to != "" {
+			var err error
+			query.To, err = time.Parse(time.RFC3339, to)
+			if err != nil {
+				http.Error(w, "to must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+		}
+		if limit := params.Get("limit"); limit != "" {
+			var err error
+			query.Limit, err = strconv.Atoi(limit)
+			if err != nil {
+				http.Error(w, "limit must be a number", http.StatusBadRequest)
+				return
+			}
+		}
+
+		page, err := logic.QueryAuditLogic(ctx, h.config.Connect.Audit, query)
+		if err != nil {
+			h.logger.Printf("Failed to query audit log: %v", err)
+			writeRoomError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(page)
+	}
+}
+
+func (h *Handlers) ChatHistoryHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if !h.adminAuthorized(w, r) {
+			return
+		}
+
+		params := r.URL.Query()
+		var before time.Time
+		if value := params.Get("before"); value != "" {
+			var err error
+			before, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				http.Error(w, "before must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+		}
+		var limit int
+		if value := params.Get("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil {
+				http.Error(w, "limit must be a number", http.StatusBadRequest)
+				return
+			}
+		}
+
+		messages, err := logic.ChatHistoryLogic(ctx, h.config.ChatHistory, codegen.Normalize(params.Get("room")), before, limit)
+		if err != nil {
+			h.logger.Printf("Failed to read chat history: %v", err)
+			writeRoomError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(messages)
+	}
+}
+
+// DebugVarsHandler serves the expvar counters, which include the process's command line and
+// configuration, to admins only
+func (h *Handlers) DebugVarsHandler() http.HandlerFunc {
+	vars := expvar.Handler()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.adminAuthorized(w, r) {
+			return
+		}
+		vars.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/AnishG-git/streamify/internal/logic"
+	"github.com/gorilla/mux"
+)
+
+func (h *Handlers) DownloadFileHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		roomCode, transferID := pathRoomCode(r), mux.Vars(r)["id"]
+		query := r.URL.Query()
+
+		// the member token proves the name, the file token comes from the file-complete message
+		f, transfer, err := logic.DownloadFileLogic(ctx, h.manager, h.config.Connect.Files, roomCode, transferID, query.Get("name"), query.Get("memberToken"), query.Get("token"))
+		if err != nil {
+			h.logger.Printf("Failed to download file %s from room %s: %v", transferID, roomCode, err)
+			writeRoomError(w, err)
+			return
+		}
+		defer f.Close()
+
+		// the browser must not render what members upload
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": transfer.FileName}))
+		http.ServeContent(w, r, "", *transfer.CompletedAt, f)
+	}
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/AnishG-git/streamify/internal/logic"
+)
+
+func (h *Handlers) ICEServersHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		w.Header().Set("Content-Type", "application/json")
+		// credentials must not be reused past their TTL
+		w.Header().Set("Cache-Control", "no-store")
+
+		roomCode := pathRoomCode(r)
+		name := r.URL.Query().Get("name")
+		// the member token is sent to each member when they join
+		token := r.URL.Query().Get("token")
+
+		servers, err := logic.GetICEServersLogic(ctx, h.manager, &h.config.ICE, roomCode, name, token)
+		if err != nil {
+			writeRoomError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(servers)
+	}
+}
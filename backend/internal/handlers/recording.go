@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/AnishG-git/streamify/internal/logic"
+)
+
+func (h *Handlers) ListRecordingsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		w.Header().Set("Content-Type", "application/json")
+
+		roomCode := pathRoomCode(r)
+		recordings, err := logic.ListRecordingsLogic(ctx, h.manager, h.config.Connect.Recorder, roomCode, ownerToken(r))
+		if err != nil {
+			h.logger.Printf("Failed to list recordings for room %s: %v", roomCode, err)
+			writeRoomError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(recordings)
+	}
+}
@@ -2,11 +2,20 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/AnishG-git/streamify/internal/codegen"
 	"github.com/AnishG-git/streamify/internal/connections"
+	"github.com/AnishG-git/streamify/internal/files"
+	"github.com/AnishG-git/streamify/internal/ice"
 	"github.com/AnishG-git/streamify/internal/logic"
+	"github.com/AnishG-git/streamify/internal/ratelimit"
+	"github.com/AnishG-git/streamify/internal/storage"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 )
@@ -16,29 +25,191 @@ type Handlers struct {
 	logger *log.Logger
 	// these should belong to a connection manager
 	manager connections.ConnManager
+	config  Config
 }
 
-func New(logger *log.Logger, manager connections.ConnManager) *Handlers {
+// Config holds the tunables the handlers pass down to the room logic
+type Config struct {
+	Rooms   logic.RoomPolicy
+	Connect logic.ConnectConfig
+	ICE     ice.Config
+	// ClientIP reads the caller's address for the audit log
+	ClientIP ratelimit.KeyFunc
+	// AdminToken authorizes the admin endpoints, they are disabled while it is empty
+	AdminToken string
+	// ChatHistory keeps every chat message, nil when chat history isn't stored
+	ChatHistory storage.ChatStore
+	// Accounts signs users in, its stores are nil when accounts are disabled
+	Accounts logic.AccountConfig
+}
+
+func New(logger *log.Logger, manager connections.ConnManager, config Config) *Handlers {
 	return &Handlers{
 		logger:  logger,
 		manager: manager,
+		config:  config,
+	}
+}
+
+// writeRoomError maps errors returned by the room logic to HTTP responses
+func writeRoomError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, logic.ErrInvalidOptions), errors.Is(err, logic.ErrOwnerRequired), errors.Is(err, logic.ErrSFUDisabled),
+		errors.Is(err, logic.ErrInvalidProfile):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, logic.ErrUnauthenticated), errors.Is(err, logic.ErrInvalidCredentials):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, logic.ErrNotRoomOwner), errors.Is(err, logic.ErrNotRoomMember):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, logic.ErrRoomNotFound), errors.Is(err, logic.ErrRecordingDisabled),
+		errors.Is(err, logic.ErrFileTransferDisabled), errors.Is(err, files.ErrTransferNotFound),
+		errors.Is(err, logic.ErrAuditDisabled), errors.Is(err, logic.ErrChatHistoryDisabled),
+		errors.Is(err, logic.ErrAccountsDisabled), errors.Is(err, logic.ErrExternalLoginDisabled):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, logic.ErrRoomCodeTaken), errors.Is(err, logic.ErrEmailTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, codegen.ErrCodeSpaceExhausted):
+		http.Error(w, "No room codes available", http.StatusServiceUnavailable)
+	default:
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	}
 }
 
+// ownerToken reads the room owner token from the Authorization header, which holds the session
+// token of signed-in users on the account endpoints
+func ownerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// pathRoomCode reads the room code from the path. Codes are stored upper-cased, so members
+// can type them in any case.
+func pathRoomCode(r *http.Request) string {
+	return codegen.Normalize(mux.Vars(r)["code"])
+}
+
 func (h *Handlers) GenerateRoomHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		h.logger.Print("/room/generate endpoint called")
 		w.Header().Set("Content-Type", "application/json")
 
-		roomCode, err := logic.GenerateRoomLogic(ctx, h.logger, h.manager)
+		query := r.URL.Query()
+		opts := logic.RoomOptions{
+			Code:       query.Get("code"),
+			Title:      query.Get("title"),
+			Mode:       query.Get("mode"),
+			Persistent: query.Get("persistent") == "true",
+			Owner:      query.Get("owner"),
+
+			SinglePresenter:    query.Get("singlePresenter") == "true",
+			AutoGrantPresenter: query.Get("autoGrantPresenter") == "true",
+			WaitingRoom:        query.Get("waitingRoom") == "true",
+		}
+		// rooms created signed in belong to the user, the header is ignored without accounts
+		if authToken(r) != "" && h.config.Accounts.Users != nil {
+			user, ok := h.signedInUser(w, r)
+			if !ok {
+				return
+			}
+			opts.OwnerID = user.ID
+			if opts.Owner == "" {
+				opts.Owner = user.DisplayName
+			}
+		}
+		if capacity := query.Get("capacity"); capacity != "" {
+			var err error
+			opts.Capacity, err = strconv.Atoi(capacity)
+			if err != nil {
+				http.Error(w, "capacity must be a number", http.StatusBadRequest)
+				return
+			}
+		}
+		if viewerCapacity := query.Get("viewerCapacity"); viewerCapacity != "" {
+			var err error
+			opts.ViewerCapacity, err = strconv.Atoi(viewerCapacity)
+			if err != nil {
+				http.Error(w, "viewerCapacity must be a number", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if startsAt := query.Get("startsAt"); startsAt != "" {
+			t, err := time.Parse(time.RFC3339, startsAt)
+			if err != nil {
+				http.Error(w, "startsAt must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			opts.StartsAt = &t
+		}
+		if duration := query.Get("duration"); duration != "" {
+			var err error
+			opts.Duration, err = time.ParseDuration(duration)
+			if err != nil {
+				http.Error(w, "duration must be a duration such as 90m", http.StatusBadRequest)
+				return
+			}
+		}
+
+		room, err := logic.GenerateRoomLogic(ctx, h.logger, h.manager, &h.config.Rooms, opts)
 		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			writeRoomError(w, err)
 			return
 		}
 
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"code": roomCode})
+		json.NewEncoder(w).Encode(room)
+	}
+}
+
+func (h *Handlers) GetRoomHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		w.Header().Set("Content-Type", "application/json")
+
+		room, err := logic.GetRoomLogic(ctx, h.manager, pathRoomCode(r))
+		if err != nil {
+			writeRoomError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(room)
+	}
+}
+
+func (h *Handlers) UpdateRoomHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		h.logger.Print("PATCH /room endpoint called")
+
+		var update logic.RoomUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		err := logic.UpdateRoomLogic(ctx, h.logger, h.manager, &h.config.Rooms, h.config.Connect.Audit, pathRoomCode(r), ownerToken(r), h.config.ClientIP(r), update)
+		if err != nil {
+			writeRoomError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (h *Handlers) DeleteRoomHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		h.logger.Print("DELETE /room endpoint called")
+
+		err := logic.DeleteRoomLogic(ctx, h.logger, h.manager, h.config.Connect.Audit, pathRoomCode(r), ownerToken(r), h.config.ClientIP(r))
+		if err != nil {
+			writeRoomError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
 
@@ -48,9 +219,17 @@ func (h *Handlers) ConnectRoomHandler() http.HandlerFunc {
 		h.logger.Print("/connect endpoint called")
 
 		// getting room code and name from URL
-		vars := mux.Vars(r)
-		roomCode := vars["code"]
+		roomCode := pathRoomCode(r)
 		name := r.URL.Query().Get("name")
+		// the owner token is optional and makes the member the room's host
+		ownerToken := r.URL.Query().Get("ownerToken")
+		// signed-in members join as their user instead of by name, browsers can't set headers on WebSockets
+		authToken := r.URL.Query().Get("authToken")
+		// members join as participants unless they ask to be viewers
+		role := r.URL.Query().Get("role")
+		// members moved to a breakout room reconnect with the token they were sent
+		joinToken := r.URL.Query().Get("joinToken")
+		ip := h.config.ClientIP(r)
 
 		// attempting to upgrade to WebSocket connection
 		upgrader := websocket.Upgrader{
@@ -68,14 +247,28 @@ func (h *Handlers) ConnectRoomHandler() http.HandlerFunc {
 
 		defer conn.Close()
 
+		member, err := logic.ResolveMemberLogic(ctx, &h.config.Accounts, name, authToken)
+		if err != nil {
+			h.logger.Printf("Failed at ResolveMemberLogic: %v", err)
+			conn.WriteJSON(map[string]string{
+				"type":  "error",
+				"error": err.Error(),
+			})
+			return
+		}
+
 		// Executing the logic to connect to the room
-		errMsg, err := logic.ConnectToRoomLogic(ctx, h.logger, h.manager, roomCode, name, conn)
+		errMsg, err := logic.ConnectToRoomLogic(ctx, h.logger, h.manager, &h.config.Connect, roomCode, member, ownerToken, role, joinToken, ip, conn)
 		if err != nil {
 			h.logger.Printf("Failed at ConnectToRoomLogic: %v", err)
-			conn.WriteJSON(map[string]string{
+			message := map[string]string{
 				"type":  "error",
 				"error": errMsg,
-			})
+			}
+			if code := logic.ConnectErrorCode(err); code != "" {
+				message["code"] = code
+			}
+			conn.WriteJSON(message)
 		}
 	}
 }
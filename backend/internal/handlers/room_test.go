@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestPathRoomCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{code: "ABC12", want: "ABC12"},
+		{code: "abc12", want: "ABC12"},
+		{code: "team-standup", want: "TEAM-STANDUP"},
+		{code: "Amber-Falcon-River", want: "AMBER-FALCON-RIVER"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/room/"+tt.code, nil), map[string]string{"code": tt.code})
+			if got := pathRoomCode(r); got != tt.want {
+				t.Fatalf("pathRoomCode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Package ice hands out STUN/TURN server configuration for WebRTC peers.
+// TURN credentials follow the TURN REST API scheme (draft-uberti-behave-turn-rest):
+// the username is "<expiry unix time>:<user id>" and the password is
+// base64(HMAC-SHA1(shared secret, username)), which coturn and pion/turn can verify
+// without the signaling server and TURN server sharing any state but the secret.
+package ice
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformedUsername  = errors.New("malformed TURN username")
+	ErrCredentialsExpired = errors.New("TURN credentials expired")
+)
+
+// Server mirrors the browser's RTCIceServer dictionary
+type Server struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+type Config struct {
+	STUNURLs []string
+	TURNURLs []string
+	// Secret is shared with the TURN server, TURN servers are left out when it is empty
+	Secret string
+	// TTL is how long issued TURN credentials stay valid
+	TTL time.Duration
+}
+
+// Servers returns the ICE servers for a member of a room, with TURN credentials valid from now until now+TTL
+func (c *Config) Servers(roomCode, name string, now time.Time) []Server {
+	servers := make([]Server, 0, 2)
+	if len(c.STUNURLs) > 0 {
+		servers = append(servers, Server{URLs: c.STUNURLs})
+	}
+	if len(c.TURNURLs) > 0 && c.Secret != "" {
+		username, credential := Credentials(c.Secret, UserID(roomCode, name), now.Add(c.TTL))
+		servers = append(servers, Server{
+			URLs:       c.TURNURLs,
+			Username:   username,
+			Credential: credential,
+		})
+	}
+	return servers
+}
+
+// UserID is the user part of the TURN username. The room code comes first so
+// the TURN server can attribute allocations to rooms.
+func UserID(roomCode, name string) string {
+	return roomCode + ":" + name
+}
+
+// Credentials builds a TURN REST username and password valid until expires
+func Credentials(secret, userID string, expires time.Time) (username string, credential string) {
+	username = strconv.FormatInt(expires.Unix(), 10) + ":" + userID
+	return username, Password(secret, username)
+}
+
+// Password derives the TURN password for a username
+func Password(secret, username string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ParseUsername splits a username issued by Credentials and checks that it has not expired
+func ParseUsername(username string, now time.Time) (roomCode string, name string, err error) {
+	parts := strings.SplitN(username, ":", 3)
+	if len(parts) != 3 {
+		return "", "", ErrMalformedUsername
+	}
+
+	expires, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %w", ErrMalformedUsername, err)
+	}
+	if now.Unix() > expires {
+		return "", "", ErrCredentialsExpired
+	}
+	return parts[1], parts[2], nil
+}
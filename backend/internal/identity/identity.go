@@ -0,0 +1,132 @@
+// Package identity verifies the assertions members sign in with through an external identity
+// provider. An assertion is a JWT signed with HS256 using a secret shared with the provider, or
+// with the bridge that verified the provider's own token, and names the account it was issued for.
+package identity
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// leeway tolerates the clocks of the provider and the server differing slightly
+const leeway = time.Minute
+
+var (
+	ErrInvalidAssertion = errors.New("invalid identity assertion")
+	ErrExpired          = errors.New("identity assertion has expired")
+)
+
+// Identity is the account an assertion was issued for
+type Identity struct {
+	// Issuer and Subject identify the account, the subject is only unique per issuer
+	Issuer  string
+	Subject string
+	Name    string
+	Email   string
+	Picture string
+}
+
+type header struct {
+	Alg string `json:"alg"`
+}
+
+type claims struct {
+	Issuer    string  `json:"iss"`
+	Subject   string  `json:"sub"`
+	ExpiresAt float64 `json:"exp"`
+	NotBefore float64 `json:"nbf"`
+	Name      string  `json:"name"`
+	Email     string  `json:"email"`
+	Picture   string  `json:"picture"`
+}
+
+type Verifier struct {
+	secret []byte
+	// issuers are the accepted issuers, any issuer is accepted when empty
+	issuers []string
+}
+
+func NewVerifier(secret []byte, issuers []string) *Verifier {
+	return &Verifier{
+		secret:  secret,
+		issuers: issuers,
+	}
+}
+
+// Verify checks the assertion's signature and lifetime and returns the identity it asserts.
+// Assertions must expire.
+func (v *Verifier) Verify(assertion string, now time.Time) (*Identity, error) {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: not a JWT", ErrInvalidAssertion)
+	}
+
+	var h header
+	if err := decodePart(parts[0], &h); err != nil {
+		return nil, err
+	}
+	// the algorithm is fixed, so an assertion can't pick a weaker one or none at all
+	if h.Alg != "HS256" {
+		return nil, fmt.Errorf("%w: algorithm must be HS256", ErrInvalidAssertion)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidAssertion)
+	}
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidAssertion)
+	}
+
+	var c claims
+	if err := decodePart(parts[1], &c); err != nil {
+		return nil, err
+	}
+	if c.Issuer == "" || c.Subject == "" {
+		return nil, fmt.Errorf("%w: iss and sub are required", ErrInvalidAssertion)
+	}
+	if len(v.issuers) > 0 && !slices.Contains(v.issuers, c.Issuer) {
+		return nil, fmt.Errorf("%w: issuer %q is not accepted", ErrInvalidAssertion, c.Issuer)
+	}
+	if c.ExpiresAt == 0 {
+		return nil, fmt.Errorf("%w: exp is required", ErrInvalidAssertion)
+	}
+	if now.After(unixTime(c.ExpiresAt).Add(leeway)) {
+		return nil, ErrExpired
+	}
+	if c.NotBefore != 0 && now.Before(unixTime(c.NotBefore).Add(-leeway)) {
+		return nil, fmt.Errorf("%w: not valid yet", ErrInvalidAssertion)
+	}
+
+	return &Identity{
+		Issuer:  c.Issuer,
+		Subject: c.Subject,
+		Name:    c.Name,
+		Email:   c.Email,
+		Picture: c.Picture,
+	}, nil
+}
+
+func decodePart(part string, v interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("%w: malformed encoding", ErrInvalidAssertion)
+	}
+	if err := json.Unmarshal(decoded, v); err != nil {
+		return fmt.Errorf("%w: malformed JSON", ErrInvalidAssertion)
+	}
+	return nil
+}
+
+// unixTime converts a JWT NumericDate, which may have a fraction of a second
+func unixTime(seconds float64) time.Time {
+	return time.UnixMilli(int64(seconds * 1000))
+}
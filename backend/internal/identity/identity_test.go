@@ -0,0 +1,108 @@
+package identity
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sign builds a JWT with the given header and claims signed with HS256
+func sign(t *testing.T, secret string, header, claims map[string]interface{}) string {
+	t.Helper()
+	encode := func(v map[string]interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("failed to marshal: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	unsigned := encode(header) + "." + encode(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	hs256 := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":   "https://idp.example.com",
+			"sub":   "user-1",
+			"exp":   now.Add(time.Hour).Unix(),
+			"name":  "Ada",
+			"email": "ada@example.com",
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	tests := []struct {
+		name      string
+		issuers   []string
+		assertion string
+		want      error
+	}{
+		{name: "valid", assertion: sign(t, "secret", hs256, claims(nil))},
+		{name: "accepted issuer", issuers: []string{"https://idp.example.com"}, assertion: sign(t, "secret", hs256, claims(nil))},
+		{name: "issuer not accepted", issuers: []string{"https://other.example.com"}, assertion: sign(t, "secret", hs256, claims(nil)), want: ErrInvalidAssertion},
+		{name: "not a JWT", assertion: "abc.def", want: ErrInvalidAssertion},
+		{name: "alg none", assertion: sign(t, "secret", map[string]interface{}{"alg": "none"}, claims(nil)), want: ErrInvalidAssertion},
+		{name: "alg HS512", assertion: sign(t, "secret", map[string]interface{}{"alg": "HS512"}, claims(nil)), want: ErrInvalidAssertion},
+		{name: "wrong secret", assertion: sign(t, "other", hs256, claims(nil)), want: ErrInvalidAssertion},
+		{name: "missing issuer", assertion: sign(t, "secret", hs256, claims(map[string]interface{}{"iss": nil})), want: ErrInvalidAssertion},
+		{name: "missing subject", assertion: sign(t, "secret", hs256, claims(map[string]interface{}{"sub": nil})), want: ErrInvalidAssertion},
+		{name: "missing exp", assertion: sign(t, "secret", hs256, claims(map[string]interface{}{"exp": nil})), want: ErrInvalidAssertion},
+		{name: "expired", assertion: sign(t, "secret", hs256, claims(map[string]interface{}{"exp": now.Add(-2 * time.Minute).Unix()})), want: ErrExpired},
+		{name: "expired within leeway", assertion: sign(t, "secret", hs256, claims(map[string]interface{}{"exp": now.Add(-30 * time.Second).Unix()}))},
+		{name: "fractional exp", assertion: sign(t, "secret", hs256, claims(map[string]interface{}{"exp": float64(now.Unix()) + 0.5}))},
+		{name: "not valid yet", assertion: sign(t, "secret", hs256, claims(map[string]interface{}{"nbf": now.Add(2 * time.Minute).Unix()})), want: ErrInvalidAssertion},
+		{name: "not valid yet within leeway", assertion: sign(t, "secret", hs256, claims(map[string]interface{}{"nbf": now.Add(30 * time.Second).Unix()}))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := NewVerifier([]byte("secret"), tt.issuers).Verify(tt.assertion, now)
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("Verify() = %v, want %v", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() = %v", err)
+			}
+			if identity.Issuer != "https://idp.example.com" || identity.Subject != "user-1" || identity.Email != "ada@example.com" {
+				t.Fatalf("Verify() = %+v", identity)
+			}
+		})
+	}
+}
+
+func TestVerifyTamperedClaims(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	assertion := sign(t, "secret", map[string]interface{}{"alg": "HS256"}, map[string]interface{}{
+		"iss": "https://idp.example.com", "sub": "user-1", "exp": now.Add(time.Hour).Unix(),
+	})
+	forged := sign(t, "secret", map[string]interface{}{"alg": "HS256"}, map[string]interface{}{
+		"iss": "https://idp.example.com", "sub": "admin", "exp": now.Add(time.Hour).Unix(),
+	})
+
+	// the claims of one assertion with the signature of another
+	a, f := strings.Split(assertion, "."), strings.Split(forged, ".")
+	tampered := a[0] + "." + f[1] + "." + a[2]
+
+	if _, err := NewVerifier([]byte("secret"), nil).Verify(tampered, now); !errors.Is(err, ErrInvalidAssertion) {
+		t.Fatalf("Verify() = %v, want ErrInvalidAssertion", err)
+	}
+}
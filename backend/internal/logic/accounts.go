@@ -0,0 +1,416 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/AnishG-git/streamify/internal/connections"
+	"github.com/AnishG-git/streamify/internal/identity"
+	"github.com/AnishG-git/streamify/internal/storage"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	rdsModels "github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+var (
+	ErrAccountsDisabled      = errors.New("accounts are not enabled on this server")
+	ErrExternalLoginDisabled = errors.New("external sign-in is not enabled on this server")
+	ErrInvalidCredentials    = errors.New("invalid email or password")
+	ErrEmailTaken            = errors.New("email is already registered")
+	ErrUnauthenticated       = errors.New("not signed in")
+	ErrInvalidProfile        = errors.New("invalid profile")
+	// ErrAccountRequired is returned when a guest joins a room on a server that requires signing in
+	ErrAccountRequired = errors.New("signing in is required to join rooms")
+)
+
+const (
+	minPasswordLength = 8
+	// bcrypt ignores everything past 72 bytes
+	maxPasswordLength    = 72
+	maxDisplayNameLength = 64
+	maxAvatarURLLength   = 2048
+	// defaultDisplayName names external users whose identity has no name
+	defaultDisplayName = "Member"
+)
+
+// AccountConfig enables user accounts, which are kept in Postgres
+type AccountConfig struct {
+	// Users keeps the accounts and their sessions, nil when accounts are disabled
+	Users storage.UserStore
+	// Rooms keeps the rooms of signed-in users for MyRoomsLogic
+	Rooms storage.RoomStore
+	// SessionTTL is how long a sign-in lasts
+	SessionTTL time.Duration
+	// External verifies identity assertions, nil when external sign-in is disabled
+	External *identity.Verifier
+	// RequireAccount turns away guests, who join with just a name
+	RequireAccount bool
+}
+
+// Registration is a new account with a password
+type Registration struct {
+	Email       string `json:"email"`
+	Password    string `json:"password"`
+	DisplayName string `json:"displayName"`
+	AvatarURL   string `json:"avatarUrl"`
+}
+
+// ProfileUpdate lists the fields a user can change, nil fields are left untouched
+type ProfileUpdate struct {
+	DisplayName *string `json:"displayName"`
+	AvatarURL   *string `json:"avatarUrl"`
+	// Password needs CurrentPassword when the user already has one
+	Password        *string `json:"password"`
+	CurrentPassword string  `json:"currentPassword"`
+}
+
+// SignIn is returned when a user signs in, Token authenticates them until ExpiresAt
+type SignIn struct {
+	Token     string          `json:"token"`
+	ExpiresAt time.Time       `json:"expiresAt"`
+	User      *rdsModels.User `json:"user"`
+}
+
+// Member is who joins a room. Signed-in members are keyed by their user ID and guests by the
+// name they gave, so two members with the same display name can be in a room together as long
+// as at most one of them is a guest.
+type Member struct {
+	// ID is the member's key in the room
+	ID string
+	// UserID is empty for guests
+	UserID      string
+	DisplayName string
+	AvatarURL   string
+}
+
+// MemberProfile is how a member is shown to the rest of the room
+type MemberProfile struct {
+	UserID      string `json:"userId,omitempty"`
+	DisplayName string `json:"displayName"`
+	AvatarURL   string `json:"avatarUrl,omitempty"`
+	Role        string `json:"role"`
+}
+
+func (a *AccountConfig) enabled() bool {
+	return a != nil && a.Users != nil
+}
+
+// dummyHash is compared against when signing in with an unknown email, so unknown emails take
+// as long to reject as wrong passwords
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("streamify-dummy-password"), bcrypt.DefaultCost)
+	return hash
+})
+
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", fmt.Errorf("%w: email is not a valid address", ErrInvalidProfile)
+	}
+	return email, nil
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return fmt.Errorf("%w: password must be between %d and %d bytes", ErrInvalidProfile, minPasswordLength, maxPasswordLength)
+	}
+	return nil
+}
+
+func validateDisplayName(displayName string) (string, error) {
+	displayName = strings.TrimSpace(displayName)
+	if displayName == "" || !utf8.ValidString(displayName) || utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+		return "", fmt.Errorf("%w: display name must be between 1 and %d characters", ErrInvalidProfile, maxDisplayNameLength)
+	}
+	return displayName, nil
+}
+
+// validateAvatarURL accepts empty URLs, which remove the avatar
+func validateAvatarURL(avatarURL string) error {
+	if avatarURL == "" {
+		return nil
+	}
+	parsed, err := url.Parse(avatarURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || len(avatarURL) > maxAvatarURLLength {
+		return fmt.Errorf("%w: avatar URL must be an http or https URL of at most %d characters", ErrInvalidProfile, maxAvatarURLLength)
+	}
+	return nil
+}
+
+// signIn starts a session for the user
+func signIn(ctx context.Context, logger *log.Logger, accounts *AccountConfig, user *rdsModels.User) (*SignIn, error) {
+	token, err := generateToken()
+	if err != nil {
+		logger.Printf("Failed to generate session token: %v", err)
+		return nil, err
+	}
+	expiresAt := time.Now().UTC().Add(accounts.SessionTTL)
+	if err := accounts.Users.CreateAuthSession(ctx, hashToken(token), user.ID, expiresAt); err != nil {
+		logger.Printf("Failed to create session for user %s: %v", user.ID, err)
+		return nil, err
+	}
+	return &SignIn{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		User:      user,
+	}, nil
+}
+
+// RegisterLogic creates an account with a password and signs it in
+func RegisterLogic(ctx context.Context, logger *log.Logger, accounts *AccountConfig, registration Registration) (*SignIn, error) {
+	if !accounts.enabled() {
+		return nil, ErrAccountsDisabled
+	}
+	email, err := normalizeEmail(registration.Email)
+	if err != nil {
+		return nil, err
+	}
+	if err := validatePassword(registration.Password); err != nil {
+		return nil, err
+	}
+	displayName, err := validateDisplayName(registration.DisplayName)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateAvatarURL(registration.AvatarURL); err != nil {
+		return nil, err
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(registration.Password), bcrypt.DefaultCost)
+	if err != nil {
+		logger.Printf("Failed to hash password: %v", err)
+		return nil, err
+	}
+	user := &rdsModels.User{
+		Email:        email,
+		DisplayName:  displayName,
+		AvatarURL:    registration.AvatarURL,
+		PasswordHash: string(passwordHash),
+	}
+	err = accounts.Users.CreateUser(ctx, user)
+	if errors.Is(err, storage.ErrUserExists) {
+		return nil, ErrEmailTaken
+	}
+	if err != nil {
+		logger.Printf("Failed to create user: %v", err)
+		return nil, err
+	}
+
+	logger.Printf("User %s registered", user.ID)
+	return signIn(ctx, logger, accounts, user)
+}
+
+// LoginLogic signs in with an email and password
+func LoginLogic(ctx context.Context, logger *log.Logger, accounts *AccountConfig, email string, password string) (*SignIn, error) {
+	if !accounts.enabled() {
+		return nil, ErrAccountsDisabled
+	}
+	user, err := accounts.Users.GetUserByEmail(ctx, strings.ToLower(strings.TrimSpace(email)))
+	if errors.Is(err, storage.ErrUserNotFound) {
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		logger.Printf("Failed to get user by email: %v", err)
+		return nil, err
+	}
+	// users who signed up through an identity provider have no password
+	if user.PasswordHash == "" || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return signIn(ctx, logger, accounts, user)
+}
+
+// ExternalLoginLogic signs in with an identity provider's assertion. The account linked to the
+// identity is created on first sign-in, it never takes over an existing account with the same email.
+func ExternalLoginLogic(ctx context.Context, logger *log.Logger, accounts *AccountConfig, assertion string) (*SignIn, error) {
+	if !accounts.enabled() {
+		return nil, ErrAccountsDisabled
+	}
+	if accounts.External == nil {
+		return nil, ErrExternalLoginDisabled
+	}
+	id, err := accounts.External.Verify(assertion, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+	}
+
+	user, err := accounts.Users.GetUserByIdentity(ctx, id.Issuer, id.Subject)
+	if errors.Is(err, storage.ErrUserNotFound) {
+		user, err = createExternalUser(ctx, accounts, id)
+	}
+	if err != nil {
+		logger.Printf("Failed to get user of identity %s from %s: %v", id.Subject, id.Issuer, err)
+		return nil, err
+	}
+	return signIn(ctx, logger, accounts, user)
+}
+
+// createExternalUser creates the account of an identity, with as much of its profile as is valid
+func createExternalUser(ctx context.Context, accounts *AccountConfig, id *identity.Identity) (*rdsModels.User, error) {
+	displayName, err := validateDisplayName(id.Name)
+	if err != nil {
+		displayName = defaultDisplayName
+	}
+	user := &rdsModels.User{DisplayName: displayName}
+	if validateAvatarURL(id.Picture) == nil {
+		user.AvatarURL = id.Picture
+	}
+	// the email stays with the provider, so it can't be used to sign in with a password
+	err = accounts.Users.CreateUserWithIdentity(ctx, user, id.Issuer, id.Subject)
+	if errors.Is(err, storage.ErrUserExists) {
+		// the same identity signed in concurrently
+		return accounts.Users.GetUserByIdentity(ctx, id.Issuer, id.Subject)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// LogoutLogic ends the session of token
+func LogoutLogic(ctx context.Context, accounts *AccountConfig, token string) error {
+	if !accounts.enabled() {
+		return ErrAccountsDisabled
+	}
+	if token == "" {
+		return ErrUnauthenticated
+	}
+	return accounts.Users.DeleteAuthSession(ctx, hashToken(token))
+}
+
+// AuthenticateLogic returns the user signed in with token
+func AuthenticateLogic(ctx context.Context, accounts *AccountConfig, token string) (*rdsModels.User, error) {
+	if !accounts.enabled() {
+		return nil, ErrAccountsDisabled
+	}
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+	user, err := accounts.Users.GetAuthSession(ctx, hashToken(token))
+	if errors.Is(err, storage.ErrSessionNotFound) {
+		return nil, ErrUnauthenticated
+	}
+	return user, err
+}
+
+// UpdateProfileLogic changes the profile of the signed-in user, authToken is the session they
+// are signed in with. Changing the password signs them out of every other session. Members
+// already in a room keep the profile they joined with.
+func UpdateProfileLogic(ctx context.Context, logger *log.Logger, accounts *AccountConfig, user *rdsModels.User, authToken string, update ProfileUpdate) (*rdsModels.User, error) {
+	if update.DisplayName != nil {
+		displayName, err := validateDisplayName(*update.DisplayName)
+		if err != nil {
+			return nil, err
+		}
+		user.DisplayName = displayName
+	}
+	if update.AvatarURL != nil {
+		if err := validateAvatarURL(*update.AvatarURL); err != nil {
+			return nil, err
+		}
+		user.AvatarURL = *update.AvatarURL
+	}
+	if update.Password != nil {
+		if err := validatePassword(*update.Password); err != nil {
+			return nil, err
+		}
+		if user.PasswordHash != "" && bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(update.CurrentPassword)) != nil {
+			return nil, ErrInvalidCredentials
+		}
+		passwordHash, err := bcrypt.GenerateFromPassword([]byte(*update.Password), bcrypt.DefaultCost)
+		if err != nil {
+			logger.Printf("Failed to hash password: %v", err)
+			return nil, err
+		}
+		user.PasswordHash = string(passwordHash)
+	}
+
+	if err := accounts.Users.UpdateUser(ctx, user); err != nil {
+		logger.Printf("Failed to update user %s: %v", user.ID, err)
+		return nil, err
+	}
+	// whoever knew the old password may be signed in elsewhere
+	if update.Password != nil {
+		if err := accounts.Users.DeleteOtherAuthSessions(ctx, user.ID, hashToken(authToken)); err != nil {
+			logger.Printf("Failed to sign user %s out of their other sessions: %v", user.ID, err)
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// MyRoomsLogic lists the live rooms the user created, newest first. Breakout rooms are left out.
+func MyRoomsLogic(ctx context.Context, logger *log.Logger, manager connections.ConnManager, accounts *AccountConfig, user *rdsModels.User) ([]*RoomInfo, error) {
+	saved, err := accounts.Rooms.ListOwnedRooms(ctx, user.ID)
+	if err != nil {
+		logger.Printf("Failed to list rooms of user %s: %v", user.ID, err)
+		return nil, err
+	}
+
+	rooms := []*RoomInfo{}
+	for _, savedRoom := range saved {
+		if savedRoom.ParentCode != "" {
+			continue
+		}
+		room, err := manager.GetRoom(ctx, savedRoom.Code)
+		// rooms that expired without being deleted are dropped from the list
+		if errors.Is(err, storage.ErrRoomNotFound) || (err == nil && room.OwnerID != user.ID) {
+			if err := accounts.Rooms.DeleteSavedRoom(ctx, savedRoom.Code); err != nil {
+				logger.Printf("Failed to remove expired room %s: %v", savedRoom.Code, err)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		info, err := getRoomInfo(ctx, manager, room)
+		if err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, info)
+	}
+	return rooms, nil
+}
+
+// ResolveMemberLogic works out who is joining a room. Members who present a session token join
+// as their user, everyone else joins as a guest under name.
+func ResolveMemberLogic(ctx context.Context, accounts *AccountConfig, name string, authToken string) (*Member, error) {
+	if authToken != "" {
+		user, err := AuthenticateLogic(ctx, accounts, authToken)
+		if err != nil {
+			return nil, err
+		}
+		return &Member{
+			ID:          user.ID,
+			UserID:      user.ID,
+			DisplayName: user.DisplayName,
+			AvatarURL:   user.AvatarURL,
+		}, nil
+	}
+
+	if accounts.enabled() && accounts.RequireAccount {
+		return nil, ErrAccountRequired
+	}
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidProfile)
+	}
+	// user IDs are reserved for the users they belong to
+	if _, err := uuid.Parse(name); err == nil {
+		return nil, fmt.Errorf("%w: name can't be a user ID", ErrInvalidProfile)
+	}
+	return &Member{
+		ID:          name,
+		DisplayName: name,
+	}, nil
+}
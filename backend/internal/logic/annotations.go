@@ -0,0 +1,181 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/storage"
+	rdsModels "github.com/AnishG-git/streamify/internal/storage/models"
+	"github.com/google/uuid"
+)
+
+const (
+	messageAnnotation         = "annotation"
+	messageAnnotationClear    = "annotation-clear"
+	messageAnnotationSync     = "annotation-sync"
+	messageAnnotationSnapshot = "annotation-snapshot"
+)
+
+const maxAnnotationWidth = 50
+
+var (
+	annotationShapes = []string{"line", "arrow", "rect", "ellipse"}
+	annotationColor  = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// AnnotationConfig bounds the annotation log kept for each room
+type AnnotationConfig struct {
+	// LogSize is how many annotations a room can hold before it has to be cleared
+	LogSize int `json:"logSize"`
+	// MaxPoints is the most points a single stroke can have
+	MaxPoints int `json:"maxPoints"`
+}
+
+// annotationBody is the body of an annotation message sent by a client
+type annotationBody struct {
+	Kind   string       `json:"kind"`
+	Points [][2]float64 `json:"points"`
+	Shape  string       `json:"shape"`
+	Color  string       `json:"color"`
+	Width  float64      `json:"width"`
+}
+
+func (b *annotationBody) validate(maxPoints int) error {
+	switch b.Kind {
+	case rdsModels.AnnotationStroke:
+		if len(b.Points) < 1 || len(b.Points) > maxPoints {
+			return fmt.Errorf("strokes must have between 1 and %d points", maxPoints)
+		}
+		if b.Shape != "" {
+			return errors.New("strokes have no shape")
+		}
+	case rdsModels.AnnotationShape:
+		if len(b.Points) != 2 {
+			return errors.New("shapes must have a start and an end point")
+		}
+		if !slices.Contains(annotationShapes, b.Shape) {
+			return fmt.Errorf("shape must be one of %v", annotationShapes)
+		}
+	default:
+		return fmt.Errorf("kind must be %s or %s", rdsModels.AnnotationStroke, rdsModels.AnnotationShape)
+	}
+	for _, point := range b.Points {
+		if point[0] < 0 || point[0] > 1 || point[1] < 0 || point[1] > 1 {
+			return errors.New("points must be between 0 and 1 on both axes")
+		}
+	}
+	if !annotationColor.MatchString(b.Color) {
+		return errors.New("color must be of the form #rrggbb")
+	}
+	if b.Width <= 0 || b.Width > maxAnnotationWidth {
+		return fmt.Errorf("width must be above 0 and at most %d", maxAnnotationWidth)
+	}
+	return nil
+}
+
+// annotationSync is the body of annotation-sync
+type annotationSync struct {
+	// Since is the last sequence number the client has, the whole log is sent if it is 0
+	Since int64 `json:"since"`
+}
+
+// addAnnotation appends a stroke or shape to the room's log and delivers it to the
+// whole room, the sender included so they learn its sequence number
+func (s *session) addAnnotation(ctx context.Context, message map[string]interface{}) {
+	var body annotationBody
+	if err := decodeMessage(message, &body); err != nil {
+		s.sendError("invalid annotation message")
+		return
+	}
+	if err := body.validate(s.cfg.Annotations.MaxPoints); err != nil {
+		s.sendError(err.Error())
+		return
+	}
+
+	s.appendAnnotation(ctx, &rdsModels.Annotation{
+		ID:        uuid.NewString(),
+		Kind:      body.Kind,
+		Author:    s.name,
+		Points:    body.Points,
+		Shape:     body.Shape,
+		Color:     body.Color,
+		Width:     body.Width,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// clearAnnotations handles annotation-clear, which only the presenter and the host can send
+func (s *session) clearAnnotations(ctx context.Context) {
+	if !s.isHost() {
+		presenting, err := s.isPresenting(ctx, s.name)
+		if err != nil {
+			s.logger.Printf("Failed to check whether %s presents in room %s: %v", s.name, s.roomCode, err)
+			s.sendError("failed to clear annotations")
+			return
+		}
+		if !presenting {
+			s.sendError("only the presenter can clear annotations")
+			return
+		}
+	}
+
+	s.appendAnnotation(ctx, &rdsModels.Annotation{
+		ID:        uuid.NewString(),
+		Kind:      rdsModels.AnnotationClear,
+		Author:    s.name,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+func (s *session) appendAnnotation(ctx context.Context, annotation *rdsModels.Annotation) {
+	seq, err := s.manager.AppendAnnotation(ctx, s.roomCode, annotation, s.cfg.Annotations.LogSize)
+	if errors.Is(err, storage.ErrAnnotationLogFull) {
+		s.sendError(err.Error())
+		return
+	}
+	if err != nil {
+		s.logger.Printf("Failed to store annotation from %s in room %s: %v", s.name, s.roomCode, err)
+		s.sendError("failed to add annotation")
+		return
+	}
+	annotation.Seq = seq
+
+	s.announce(ctx, map[string]interface{}{
+		"type":       messageAnnotation,
+		"annotation": annotation,
+	})
+}
+
+// syncAnnotations handles annotation-sync, which clients send when they notice a gap in the sequence numbers
+func (s *session) syncAnnotations(ctx context.Context, message map[string]interface{}) {
+	var body annotationSync
+	if err := decodeMessage(message, &body); err != nil || body.Since < 0 {
+		s.sendError("invalid annotation-sync message")
+		return
+	}
+	s.sendAnnotations(ctx, body.Since)
+}
+
+// sendAnnotations sends the annotations after since, the whole log to members who just joined
+func (s *session) sendAnnotations(ctx context.Context, since int64) {
+	annotations, err := s.manager.GetAnnotations(ctx, s.roomCode, since)
+	if err != nil {
+		s.logger.Printf("Failed to get annotations of room %s: %v", s.roomCode, err)
+		return
+	}
+
+	seq := since
+	if len(annotations) > 0 {
+		seq = annotations[len(annotations)-1].Seq
+	}
+	s.send(map[string]interface{}{
+		"type":        messageAnnotationSnapshot,
+		"since":       since,
+		"seq":         seq,
+		"annotations": annotations,
+	})
+}
@@ -0,0 +1,48 @@
+package logic
+
+import (
+	"testing"
+
+	rdsModels "github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+func TestAnnotationBodyValidate(t *testing.T) {
+	const maxPoints = 3
+	stroke := func(points ...[2]float64) annotationBody {
+		return annotationBody{Kind: rdsModels.AnnotationStroke, Points: points, Color: "#ff0000", Width: 2}
+	}
+	shape := func(shape string, points ...[2]float64) annotationBody {
+		return annotationBody{Kind: rdsModels.AnnotationShape, Shape: shape, Points: points, Color: "#00FF00", Width: 4}
+	}
+
+	tests := []struct {
+		name    string
+		body    annotationBody
+		wantErr bool
+	}{
+		{name: "stroke", body: stroke([2]float64{0, 0}, [2]float64{0.5, 0.5}, [2]float64{1, 1})},
+		{name: "single point stroke", body: stroke([2]float64{0.2, 0.3})},
+		{name: "rect", body: shape("rect", [2]float64{0.1, 0.1}, [2]float64{0.9, 0.9})},
+		{name: "arrow", body: shape("arrow", [2]float64{0.1, 0.1}, [2]float64{0.9, 0.9})},
+		{name: "unknown kind", body: annotationBody{Kind: "text", Points: [][2]float64{{0, 0}}, Color: "#ffffff", Width: 1}, wantErr: true},
+		{name: "empty stroke", body: stroke(), wantErr: true},
+		{name: "stroke with too many points", body: stroke([2]float64{0, 0}, [2]float64{0, 0}, [2]float64{0, 0}, [2]float64{0, 0}), wantErr: true},
+		{name: "stroke with a shape", body: annotationBody{Kind: rdsModels.AnnotationStroke, Shape: "rect", Points: [][2]float64{{0, 0}}, Color: "#ffffff", Width: 1}, wantErr: true},
+		{name: "shape with one point", body: shape("rect", [2]float64{0.1, 0.1}), wantErr: true},
+		{name: "unknown shape", body: shape("star", [2]float64{0.1, 0.1}, [2]float64{0.9, 0.9}), wantErr: true},
+		{name: "point off screen", body: stroke([2]float64{1.5, 0.5}), wantErr: true},
+		{name: "negative point", body: stroke([2]float64{0.5, -0.1}), wantErr: true},
+		{name: "named color", body: annotationBody{Kind: rdsModels.AnnotationStroke, Points: [][2]float64{{0, 0}}, Color: "red", Width: 1}, wantErr: true},
+		{name: "short color", body: annotationBody{Kind: rdsModels.AnnotationStroke, Points: [][2]float64{{0, 0}}, Color: "#fff", Width: 1}, wantErr: true},
+		{name: "zero width", body: annotationBody{Kind: rdsModels.AnnotationStroke, Points: [][2]float64{{0, 0}}, Color: "#ffffff"}, wantErr: true},
+		{name: "width too large", body: annotationBody{Kind: rdsModels.AnnotationStroke, Points: [][2]float64{{0, 0}}, Color: "#ffffff", Width: maxAnnotationWidth + 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.body.validate(maxPoints)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package logic
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/audit"
+)
+
+var ErrAuditDisabled = errors.New("audit log is not queryable on this server")
+
+// AuditQuery selects the entries returned by QueryAuditLogic
+type AuditQuery struct {
+	RoomCode string
+	From     time.Time
+	To       time.Time
+	Limit    int
+	// After is the Next of the previous page
+	After string
+}
+
+type AuditPage struct {
+	Entries []*audit.Entry `json:"entries"`
+	// More is set when entries past the limit match too
+	More bool `json:"more"`
+	// Next is the cursor the next page is queried after, it is set along with More
+	Next string `json:"next,omitempty"`
+}
+
+// QueryAuditLogic reads back the audit log, oldest entries first
+func QueryAuditLogic(ctx context.Context, auditLog *audit.Log, query AuditQuery) (*AuditPage, error) {
+	if query.Limit < 0 {
+		return nil, fmt.Errorf("%w: limit must not be negative", ErrInvalidOptions)
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && query.To.Before(query.From) {
+		return nil, fmt.Errorf("%w: to must not be before from", ErrInvalidOptions)
+	}
+
+	// cursors are opaque to clients, they differ between sinks
+	var after []byte
+	if query.After != "" {
+		var err error
+		after, err = base64.RawURLEncoding.DecodeString(query.After)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidOptions)
+		}
+	}
+
+	entries, more, err := auditLog.Query(ctx, audit.Filter{
+		RoomCode: query.RoomCode,
+		From:     query.From,
+		To:       query.To,
+		Limit:    query.Limit,
+		After:    string(after),
+	})
+	if errors.Is(err, audit.ErrNotQueryable) {
+		return nil, ErrAuditDisabled
+	}
+	if errors.Is(err, audit.ErrInvalidCursor) {
+		return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidOptions)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = []*audit.Entry{}
+	}
+	page := &AuditPage{Entries: entries, More: more}
+	if more {
+		page.Next = base64.RawURLEncoding.EncodeToString([]byte(entries[len(entries)-1].Cursor))
+	}
+	return page, nil
+}
+
+// audit records an action the member took, target is the member it was taken on
+func (s *session) audit(ctx context.Context, action, target string, details map[string]interface{}) {
+	s.cfg.Audit.Record(ctx, &audit.Entry{
+		Action:   action,
+		RoomCode: s.roomCode,
+		Actor:    s.name,
+		Target:   target,
+		Role:     s.role,
+		IP:       s.ip,
+		Details:  details,
+	})
+}
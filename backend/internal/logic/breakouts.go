@@ -0,0 +1,344 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/audit"
+	rdsModels "github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+const (
+	messageBreakoutOpen   = "breakout-open"
+	messageBreakoutMove   = "breakout-move"
+	messageBreakoutRecall = "breakout-recall"
+	messageBreakoutRooms  = "breakout-rooms"
+	messageBreakoutJoin   = "breakout-join"
+)
+
+const (
+	maxBreakoutRooms = 20
+	// joinPassTTL is how long a moved member has to reconnect with their join token
+	joinPassTTL = 2 * time.Minute
+)
+
+// breakoutOpen is the body of breakout-open
+type breakoutOpen struct {
+	Rooms []struct {
+		Title string `json:"title"`
+		// Members are moved to the breakout room once it is open
+		Members []string `json:"members"`
+	} `json:"rooms"`
+}
+
+// breakoutMove is the body of breakout-move
+type breakoutMove struct {
+	Name string `json:"name"`
+	// Code is one of the room's breakout rooms, or the room itself to bring the member back
+	Code string `json:"code"`
+}
+
+// breakoutRoom describes a breakout room to clients
+type breakoutRoom struct {
+	Code  string `json:"code"`
+	Title string `json:"title"`
+}
+
+// openBreakouts handles breakout-open, which lets the host create breakout rooms and fill them
+func (s *session) openBreakouts(ctx context.Context, message map[string]interface{}) {
+	if !s.canManageBreakouts() {
+		return
+	}
+	var body breakoutOpen
+	if err := decodeMessage(message, &body); err != nil || len(body.Rooms) == 0 {
+		s.sendError("breakout-open requires at least one room")
+		return
+	}
+	for _, room := range body.Rooms {
+		if err := validateTitle(room.Title); err != nil {
+			s.sendError(err.Error())
+			return
+		}
+	}
+
+	breakouts, err := s.manager.GetBreakouts(ctx, s.roomCode)
+	if err != nil {
+		s.logger.Printf("Failed to get breakout rooms of room %s: %v", s.roomCode, err)
+		s.sendError("failed to open breakout rooms")
+		return
+	}
+	if len(breakouts)+len(body.Rooms) > maxBreakoutRooms {
+		s.sendError(fmt.Sprintf("a room can have at most %d breakout rooms", maxBreakoutRooms))
+		return
+	}
+	// breakout rooms take the current settings of the room
+	parent, err := s.manager.GetRoom(ctx, s.roomCode)
+	if err != nil {
+		s.logger.Printf("Failed to get room %s: %v", s.roomCode, err)
+		s.sendError("failed to open breakout rooms")
+		return
+	}
+
+	for i, room := range body.Rooms {
+		title := room.Title
+		if title == "" {
+			title = fmt.Sprintf("Breakout room %d", len(breakouts)+i+1)
+		}
+		code, err := s.createBreakout(ctx, parent, title)
+		if err != nil {
+			s.logger.Printf("Failed to create breakout room of room %s: %v", s.roomCode, err)
+			s.sendError("failed to open breakout rooms")
+			break
+		}
+		s.logger.Printf("User %s opened breakout room %s of room %s", s.name, code, s.roomCode)
+		for _, name := range room.Members {
+			if err := s.moveMember(ctx, name, code); err != nil {
+				s.sendError(err.Error())
+			}
+		}
+	}
+	s.announceBreakouts(ctx)
+}
+
+// createBreakout creates a breakout room with the parent's owner and settings and links it to the parent
+func (s *session) createBreakout(ctx context.Context, parent *rdsModels.Room, title string) (string, error) {
+	settings := parent.Settings
+	// moved members could not get in otherwise
+	settings.Locked = false
+
+	room := &rdsModels.Room{
+		Title:          title,
+		Capacity:       parent.Capacity,
+		CreatedAt:      time.Now().UTC(),
+		CreatedBy:      parent.CreatedBy,
+		ViewerCapacity: parent.ViewerCapacity,
+		ParentCode:     parent.Code,
+		OwnerTokenHash: parent.OwnerTokenHash,
+		OwnerID:        parent.OwnerID,
+		Settings:       settings,
+	}
+	reserve := func(ctx context.Context, code string) (bool, error) {
+		room.Code = code
+		return s.manager.CreateRoom(ctx, room)
+	}
+	code, err := s.cfg.Codes.Reserve(ctx, reserve)
+	if err != nil {
+		return "", err
+	}
+	if err := s.manager.AddBreakout(ctx, parent.Code, code); err != nil {
+		s.manager.DeleteRoom(ctx, code)
+		return "", err
+	}
+	return code, nil
+}
+
+// moveBreakoutMember handles breakout-move, which lets the host move a member between the
+// room and its breakout rooms
+func (s *session) moveBreakoutMember(ctx context.Context, message map[string]interface{}) {
+	if !s.canManageBreakouts() {
+		return
+	}
+	var body breakoutMove
+	if err := decodeMessage(message, &body); err != nil || body.Name == "" || body.Code == "" {
+		s.sendError("breakout-move requires a name and a code")
+		return
+	}
+
+	if body.Code != s.roomCode {
+		breakouts, err := s.manager.GetBreakouts(ctx, s.roomCode)
+		if err != nil {
+			s.logger.Printf("Failed to get breakout rooms of room %s: %v", s.roomCode, err)
+			s.sendError("failed to move member")
+			return
+		}
+		if !slices.Contains(breakouts, body.Code) {
+			s.sendError(fmt.Sprintf("%s is not a breakout room of this room", body.Code))
+			return
+		}
+	}
+	if err := s.moveMember(ctx, body.Name, body.Code); err != nil {
+		s.sendError(err.Error())
+	}
+}
+
+// recallBreakouts handles breakout-recall, which brings everyone in a breakout room back to the room.
+// The breakout rooms are deleted once the last member has left them. Those nobody is in, because
+// nobody ever joined them or everyone already left, are deleted right away.
+func (s *session) recallBreakouts(ctx context.Context) {
+	if !s.canManageBreakouts() {
+		return
+	}
+	breakouts, err := s.manager.GetBreakouts(ctx, s.roomCode)
+	if err != nil {
+		s.logger.Printf("Failed to get breakout rooms of room %s: %v", s.roomCode, err)
+		s.sendError("failed to recall breakout rooms")
+		return
+	}
+	if len(breakouts) == 0 {
+		s.sendError("there are no breakout rooms")
+		return
+	}
+
+	for _, code := range breakouts {
+		names, err := s.manager.GetUserNamesFromRoom(ctx, code)
+		if err != nil {
+			s.logger.Printf("Failed to get user names from room %s: %v", code, err)
+			continue
+		}
+		for _, name := range names {
+			if err := s.moveMemberFrom(ctx, code, name, s.roomCode); err != nil {
+				s.logger.Printf("Failed to recall %s from breakout room %s: %v", name, code, err)
+			}
+		}
+		// members may have left while they were recalled, leaving nobody to delete the room
+		occupancy, err := s.manager.GetRoomOccupancy(ctx, code)
+		if err != nil {
+			s.logger.Printf("Failed to get room occupancy for room %s: %v", code, err)
+			continue
+		}
+		if occupancy == 0 {
+			s.closeBreakout(ctx, code)
+		}
+	}
+	s.logger.Printf("User %s recalled the breakout rooms of room %s", s.name, s.roomCode)
+	s.announceBreakouts(ctx)
+}
+
+// closeBreakout deletes a breakout room nobody is in
+func (s *session) closeBreakout(ctx context.Context, code string) {
+	if _, err := s.manager.DeleteRoom(ctx, code); err != nil {
+		s.logger.Printf("Failed to remove breakout room %s: %v", code, err)
+		return
+	}
+	if err := s.manager.RemoveBreakout(ctx, s.roomCode, code); err != nil {
+		s.logger.Printf("Failed to unlink breakout room %s from room %s: %v", code, s.roomCode, err)
+	}
+}
+
+// moveMember finds name in the room or one of its breakout rooms and moves them to target
+func (s *session) moveMember(ctx context.Context, name, target string) error {
+	rooms, err := s.manager.GetBreakouts(ctx, s.roomCode)
+	if err != nil {
+		s.logger.Printf("Failed to get breakout rooms of room %s: %v", s.roomCode, err)
+		return fmt.Errorf("failed to move %s", name)
+	}
+	for _, code := range append([]string{s.roomCode}, rooms...) {
+		names, err := s.manager.GetUserNamesFromRoom(ctx, code)
+		if err != nil {
+			s.logger.Printf("Failed to get user names from room %s: %v", code, err)
+			return fmt.Errorf("failed to move %s", name)
+		}
+		if !slices.Contains(names, name) {
+			continue
+		}
+		if code == target {
+			return fmt.Errorf("%s is already in %s", name, target)
+		}
+		if err := s.moveMemberFrom(ctx, code, name, target); err != nil {
+			s.logger.Printf("Failed to move %s from room %s to %s: %v", name, code, target, err)
+			return fmt.Errorf("failed to move %s", name)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s is not in the room or its breakout rooms", name)
+}
+
+// moveMemberFrom gives name a single use pass to target and tells them to reconnect there.
+// Clients close their current connection and connect to target with the join token.
+func (s *session) moveMemberFrom(ctx context.Context, from, name, target string) error {
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+	if err := s.manager.SetJoinPass(ctx, target, name, hashToken(token), joinPassTTL); err != nil {
+		return err
+	}
+	room, err := s.manager.GetRoom(ctx, target)
+	if err != nil {
+		return err
+	}
+
+	s.logger.Printf("User %s is moved from room %s to %s", name, from, target)
+	err = sendToRoomMember(ctx, s.manager, from, name, map[string]interface{}{
+		"type":      messageBreakoutJoin,
+		"code":      target,
+		"title":     room.Title,
+		"joinToken": token,
+		"parent":    s.roomCode,
+	})
+	if err != nil {
+		return err
+	}
+	s.audit(ctx, audit.ActionBreakoutMove, name, map[string]interface{}{
+		"from": from,
+		"to":   target,
+	})
+	return nil
+}
+
+// canManageBreakouts reports whether the member may run breakout commands, telling them if not
+func (s *session) canManageBreakouts() bool {
+	if !s.isHost() {
+		s.sendError("only the host can manage breakout rooms")
+		return false
+	}
+	if s.room.ParentCode != "" {
+		s.sendError("breakout rooms are managed from the main room")
+		return false
+	}
+	if s.cfg.Codes == nil {
+		s.sendError("breakout rooms are not enabled on this server")
+		return false
+	}
+	return true
+}
+
+// announceBreakouts tells the room which breakout rooms are open
+func (s *session) announceBreakouts(ctx context.Context) {
+	rooms, err := s.getBreakoutRooms(ctx)
+	if err != nil {
+		s.logger.Printf("Failed to get breakout rooms of room %s: %v", s.roomCode, err)
+		return
+	}
+	s.announce(ctx, map[string]interface{}{
+		"type":  messageBreakoutRooms,
+		"rooms": rooms,
+	})
+}
+
+// sendBreakouts tells a new member which breakout rooms are open, if any
+func (s *session) sendBreakouts(ctx context.Context) {
+	rooms, err := s.getBreakoutRooms(ctx)
+	if err != nil {
+		s.logger.Printf("Failed to get breakout rooms of room %s: %v", s.roomCode, err)
+		return
+	}
+	if len(rooms) == 0 {
+		return
+	}
+	s.send(map[string]interface{}{
+		"type":  messageBreakoutRooms,
+		"rooms": rooms,
+	})
+}
+
+func (s *session) getBreakoutRooms(ctx context.Context) ([]breakoutRoom, error) {
+	codes, err := s.manager.GetBreakouts(ctx, s.roomCode)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(codes)
+
+	rooms := make([]breakoutRoom, 0, len(codes))
+	for _, code := range codes {
+		room, err := s.manager.GetRoom(ctx, code)
+		if err != nil {
+			// the breakout room was deleted in the meantime
+			continue
+		}
+		rooms = append(rooms, breakoutRoom{Code: code, Title: room.Title})
+	}
+	return rooms, nil
+}
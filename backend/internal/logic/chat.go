@@ -0,0 +1,111 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/AnishG-git/streamify/internal/storage"
+	rdsModels "github.com/AnishG-git/streamify/internal/storage/models"
+	"github.com/google/uuid"
+)
+
+const (
+	messageChat        = "chat"
+	messageChatHistory = "chat-history"
+)
+
+// ChatConfig bounds the chat history kept for each room
+type ChatConfig struct {
+	// HistorySize is how many messages are kept per room, older ones are dropped
+	HistorySize int `json:"historySize"`
+	// ReplayCount is how many of the most recent messages are sent to members when they join
+	ReplayCount int `json:"replayCount"`
+	// MaxLength is the longest message in characters
+	MaxLength int `json:"maxLength"`
+}
+
+// maxChatHistoryPage bounds how many messages ChatHistoryLogic returns
+const maxChatHistoryPage = 500
+
+var ErrChatHistoryDisabled = errors.New("chat history is not stored on this server")
+
+// ChatHistoryLogic reads up to limit messages of a room sent before before from the durable chat
+// history, oldest first. A zero before returns the latest messages.
+func ChatHistoryLogic(ctx context.Context, chatStore storage.ChatStore, roomCode string, before time.Time, limit int) ([]*rdsModels.ChatMessage, error) {
+	if chatStore == nil {
+		return nil, ErrChatHistoryDisabled
+	}
+	if roomCode == "" {
+		return nil, fmt.Errorf("%w: room is required", ErrInvalidOptions)
+	}
+	if limit == 0 {
+		limit = 100
+	}
+	if limit < 0 || limit > maxChatHistoryPage {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidOptions, maxChatHistoryPage)
+	}
+	return chatStore.GetChatHistory(ctx, roomCode, before, limit)
+}
+
+// chatBody is the body of a chat message sent by a client
+type chatBody struct {
+	Text string `json:"text"`
+}
+
+// handleChat stores a chat message and delivers it to the whole room, the sender
+// included so they learn its ID and timestamp
+func (s *session) handleChat(ctx context.Context, message map[string]interface{}) {
+	var body chatBody
+	if err := decodeMessage(message, &body); err != nil {
+		s.sendError("invalid chat message")
+		return
+	}
+	text := strings.TrimSpace(body.Text)
+	if text == "" || !utf8.ValidString(text) {
+		s.sendError("chat messages must be non-empty UTF-8 text")
+		return
+	}
+	if utf8.RuneCountInString(text) > s.cfg.Chat.MaxLength {
+		s.sendError(fmt.Sprintf("chat messages must be at most %d characters", s.cfg.Chat.MaxLength))
+		return
+	}
+
+	chatMessage := &rdsModels.ChatMessage{
+		ID:          uuid.NewString(),
+		Name:        s.name,
+		DisplayName: s.member.DisplayName,
+		Text:        text,
+		SentAt:      time.Now().UTC(),
+	}
+	if err := s.manager.AddChatMessage(ctx, s.roomCode, chatMessage, s.cfg.Chat.HistorySize); err != nil {
+		s.logger.Printf("Failed to store chat message from %s in room %s: %v", s.name, s.roomCode, err)
+		s.sendError("failed to send chat message")
+		return
+	}
+
+	s.announce(ctx, map[string]interface{}{
+		"type":    messageChat,
+		"message": chatMessage,
+	})
+}
+
+// sendChatHistory replays the most recent chat messages to a member who just joined
+func (s *session) sendChatHistory(ctx context.Context) {
+	if s.cfg.Chat.ReplayCount <= 0 {
+		return
+	}
+	messages, err := s.manager.GetChatMessages(ctx, s.roomCode, s.cfg.Chat.ReplayCount)
+	if err != nil {
+		s.logger.Printf("Failed to get chat history of room %s: %v", s.roomCode, err)
+		return
+	}
+
+	s.send(map[string]interface{}{
+		"type":     messageChatHistory,
+		"messages": messages,
+	})
+}
@@ -0,0 +1,327 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/AnishG-git/streamify/internal/connections"
+	"github.com/AnishG-git/streamify/internal/storage"
+	rdsModels "github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+const (
+	messageControlRequest = "control-request"
+	messageControlGrant   = "control-grant"
+	messageControlDeny    = "control-deny"
+	messageControlRevoke  = "control-revoke"
+	messageControlGranted = "control-granted"
+	messageControlDenied  = "control-denied"
+	messageControlRevoked = "control-revoked"
+	messageInputEvent     = "input-event"
+)
+
+// input event kinds, kept short since mouse moves are sent many times a second
+const (
+	inputMouseMove = "mm"
+	inputMouseDown = "md"
+	inputMouseUp   = "mu"
+	inputWheel     = "wh"
+	inputKeyDown   = "kd"
+	inputKeyUp     = "ku"
+)
+
+const (
+	maxInputButton    = 4
+	maxInputKeyLength = 32
+	// maxInputModifiers has a bit set for each of shift, ctrl, alt and meta
+	maxInputModifiers = 15
+	maxInputWheel     = 10000
+)
+
+// inputEvent is the compact schema of input-event messages. Pointer positions
+// are relative to the shared screen, from 0 to 1 on both axes.
+type inputEvent struct {
+	Type   string  `json:"type"`
+	Event  string  `json:"e"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Button int     `json:"b,omitempty"`
+	Key    string  `json:"k,omitempty"`
+	Mods   int     `json:"m,omitempty"`
+	DX     float64 `json:"dx,omitempty"`
+	DY     float64 `json:"dy,omitempty"`
+}
+
+func (e *inputEvent) validate() error {
+	switch e.Event {
+	case inputMouseMove, inputMouseDown, inputMouseUp, inputWheel:
+	case inputKeyDown, inputKeyUp:
+		if e.Key == "" {
+			return errors.New("key events require k")
+		}
+	default:
+		return fmt.Errorf("unknown input event %q", e.Event)
+	}
+	if e.X < 0 || e.X > 1 || e.Y < 0 || e.Y > 1 {
+		return errors.New("x and y must be between 0 and 1")
+	}
+	if e.Button < 0 || e.Button > maxInputButton {
+		return fmt.Errorf("b must be between 0 and %d", maxInputButton)
+	}
+	if len(e.Key) > maxInputKeyLength {
+		return fmt.Errorf("k must be at most %d bytes", maxInputKeyLength)
+	}
+	if e.Mods < 0 || e.Mods > maxInputModifiers {
+		return fmt.Errorf("m must be between 0 and %d", maxInputModifiers)
+	}
+	if math.Abs(e.DX) > maxInputWheel || math.Abs(e.DY) > maxInputWheel {
+		return fmt.Errorf("dx and dy must be between -%d and %d", maxInputWheel, maxInputWheel)
+	}
+	return nil
+}
+
+// controlTarget is the body of the control-* messages
+type controlTarget struct {
+	// Presenter is who control is requested from, the room's presenter if empty
+	Presenter string `json:"presenter"`
+	// Name is the member control is granted to or denied
+	Name string `json:"name"`
+}
+
+// requestControl handles control-request by passing the request on to the presenter
+func (s *session) requestControl(ctx context.Context, message map[string]interface{}) {
+	var target controlTarget
+	if err := decodeMessage(message, &target); err != nil {
+		s.sendError("invalid control-request message")
+		return
+	}
+
+	presenter := target.Presenter
+	if presenter == "" {
+		var err error
+		presenter, err = s.manager.GetPresenter(ctx, s.roomCode)
+		if err != nil {
+			s.logger.Printf("Failed to get presenter of room %s: %v", s.roomCode, err)
+			s.sendError("failed to request control")
+			return
+		}
+	}
+	if presenter == "" || presenter == s.name {
+		s.sendError("control-request requires the name of another presenter")
+		return
+	}
+	if presenting, err := s.isPresenting(ctx, presenter); err != nil || !presenting {
+		s.sendError(fmt.Sprintf("%s is not presenting", presenter))
+		return
+	}
+
+	err := s.sendToMember(ctx, presenter, map[string]interface{}{
+		"type": messageControlRequest,
+		"name": s.name,
+	})
+	if err != nil {
+		s.logger.Printf("Failed to send control request from %s to %s in room %s: %v", s.name, presenter, s.roomCode, err)
+		s.sendError("failed to request control")
+	}
+}
+
+// grantControl handles control-grant, which only a presenter can send
+func (s *session) grantControl(ctx context.Context, message map[string]interface{}) {
+	var target controlTarget
+	if err := decodeMessage(message, &target); err != nil || target.Name == "" || target.Name == s.name {
+		s.sendError("control-grant requires the name of another member")
+		return
+	}
+	if !s.canGrantControl(ctx) {
+		return
+	}
+
+	names, err := s.manager.GetUserNamesFromRoom(ctx, s.roomCode)
+	if err != nil {
+		s.logger.Printf("Failed to get user names from room %s: %v", s.roomCode, err)
+		s.sendError("failed to grant control")
+		return
+	}
+	if !slices.Contains(names, target.Name) {
+		s.sendError(fmt.Sprintf("%s is not in the room", target.Name))
+		return
+	}
+
+	previous, err := s.manager.GrantControl(ctx, s.roomCode, s.name, target.Name)
+	if errors.Is(err, storage.ErrAlreadyControlling) {
+		s.sendError(fmt.Sprintf("%s is %s", target.Name, err))
+		return
+	}
+	if err != nil {
+		s.logger.Printf("Failed to grant control of %s to %s in room %s: %v", s.name, target.Name, s.roomCode, err)
+		s.sendError("failed to grant control")
+		return
+	}
+
+	if previous != "" {
+		s.announceControlRevoked(ctx, s.name, previous)
+	}
+	s.logger.Printf("User %s granted control to %s in room %s", s.name, target.Name, s.roomCode)
+	s.announce(ctx, map[string]interface{}{
+		"type":       messageControlGranted,
+		"presenter":  s.name,
+		"controller": target.Name,
+	})
+}
+
+// denyControl handles control-deny by telling the member their request was turned down
+func (s *session) denyControl(ctx context.Context, message map[string]interface{}) {
+	var target controlTarget
+	if err := decodeMessage(message, &target); err != nil || target.Name == "" {
+		s.sendError("control-deny requires a name")
+		return
+	}
+
+	err := s.sendToMember(ctx, target.Name, map[string]interface{}{
+		"type":      messageControlDenied,
+		"presenter": s.name,
+	})
+	if err != nil {
+		s.sendError(fmt.Sprintf("%s is not in the room", target.Name))
+	}
+}
+
+// revokeControl handles control-revoke. Presenters take control back from their
+// controller, controllers hand it back to the presenter.
+func (s *session) revokeControl(ctx context.Context) {
+	if s.dropControl(ctx) == 0 {
+		s.sendError("nobody controls your screen and you control nobody")
+	}
+}
+
+// dropControl ends every control grant the member is part of and returns how many it ended
+func (s *session) dropControl(ctx context.Context) int {
+	dropped := 0
+	if s.revokeScreenControl(ctx) {
+		dropped++
+	}
+	if s.releaseHeldControl(ctx) {
+		dropped++
+	}
+	return dropped
+}
+
+// revokeScreenControl takes control of the member's screen away from whoever has it
+func (s *session) revokeScreenControl(ctx context.Context) bool {
+	controller, err := s.manager.RevokeControl(ctx, s.roomCode, s.name)
+	if err != nil {
+		s.logger.Printf("Failed to revoke control of %s in room %s: %v", s.name, s.roomCode, err)
+		return false
+	}
+	if controller == "" {
+		return false
+	}
+	s.announceControlRevoked(ctx, s.name, controller)
+	return true
+}
+
+// releaseHeldControl hands back the control the member was granted
+func (s *session) releaseHeldControl(ctx context.Context) bool {
+	presenter, err := s.manager.ReleaseControl(ctx, s.roomCode, s.name)
+	if err != nil {
+		s.logger.Printf("Failed to release control held by %s in room %s: %v", s.name, s.roomCode, err)
+		return false
+	}
+	if presenter == "" {
+		return false
+	}
+	s.announceControlRevoked(ctx, presenter, s.name)
+	return true
+}
+
+func (s *session) announceControlRevoked(ctx context.Context, presenter, controller string) {
+	s.logger.Printf("Control of %s by %s ended in room %s", presenter, controller, s.roomCode)
+	s.announce(ctx, map[string]interface{}{
+		"type":       messageControlRevoked,
+		"presenter":  presenter,
+		"controller": controller,
+	})
+}
+
+// relayInputEvent sends an input-event to the presenter the member was granted control of
+func (s *session) relayInputEvent(ctx context.Context, message map[string]interface{}) {
+	presenter, err := s.manager.GetControlledPresenter(ctx, s.roomCode, s.name)
+	if err != nil {
+		s.logger.Printf("Failed to get presenter controlled by %s in room %s: %v", s.name, s.roomCode, err)
+		return
+	}
+	if presenter == "" {
+		s.sendError("you have not been granted control")
+		return
+	}
+
+	var event inputEvent
+	if err := decodeMessage(message, &event); err != nil {
+		s.sendError("invalid input-event message")
+		return
+	}
+	if err := event.validate(); err != nil {
+		s.sendError(err.Error())
+		return
+	}
+
+	// only the validated fields are passed on
+	event.Type = messageInputEvent
+	if err := s.sendToMember(ctx, presenter, event); err != nil {
+		s.logger.Printf("Failed to relay input event from %s to %s in room %s: %v", s.name, presenter, s.roomCode, err)
+	}
+}
+
+// canGrantControl reports whether the member is presenting, telling them if not
+func (s *session) canGrantControl(ctx context.Context) bool {
+	presenting, err := s.isPresenting(ctx, s.name)
+	if err != nil {
+		s.logger.Printf("Failed to check whether %s presents in room %s: %v", s.name, s.roomCode, err)
+		s.sendError("failed to grant control")
+		return false
+	}
+	if !presenting {
+		s.sendError("only the presenter can grant control")
+		return false
+	}
+	return true
+}
+
+// isPresenting reports whether name holds the presenter slot or shares their screen
+func (s *session) isPresenting(ctx context.Context, name string) (bool, error) {
+	presenter, err := s.manager.GetPresenter(ctx, s.roomCode)
+	if err != nil {
+		return false, err
+	}
+	if presenter == name {
+		return true, nil
+	}
+	states, err := s.manager.GetMediaStates(ctx, s.roomCode)
+	if err != nil {
+		return false, err
+	}
+	state, ok := states[name]
+	return ok && state.Screen, nil
+}
+
+// sendToMember sends a message to a single member of the room
+func (s *session) sendToMember(ctx context.Context, name string, message interface{}) error {
+	return sendToRoomMember(ctx, s.manager, s.roomCode, name, message)
+}
+
+// sendToRoomMember sends a message to a single member of any room
+func sendToRoomMember(ctx context.Context, manager connections.ConnManager, roomCode, name string, message interface{}) error {
+	connDetailsStr, err := manager.GetUserConnectionDetails(ctx, roomCode, name)
+	if err != nil {
+		return err
+	}
+	var connDetails rdsModels.ConnectionDetails
+	if err := json.Unmarshal([]byte(connDetailsStr), &connDetails); err != nil {
+		return err
+	}
+	return manager.SendToConnection(connDetails.ConnectionID, message)
+}
@@ -0,0 +1,40 @@
+package logic
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInputEventValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   inputEvent
+		wantErr bool
+	}{
+		{name: "mouse move", event: inputEvent{Event: inputMouseMove, X: 0.5, Y: 0.5}},
+		{name: "mouse down at corner", event: inputEvent{Event: inputMouseDown, X: 1, Y: 0, Button: 2}},
+		{name: "wheel", event: inputEvent{Event: inputWheel, X: 0.1, Y: 0.9, DX: -120, DY: 240}},
+		{name: "key down", event: inputEvent{Event: inputKeyDown, Key: "Enter", Mods: 3}},
+		{name: "key up", event: inputEvent{Event: inputKeyUp, Key: "a"}},
+		{name: "unknown event", event: inputEvent{Event: "click"}, wantErr: true},
+		{name: "empty event", event: inputEvent{}, wantErr: true},
+		{name: "key without k", event: inputEvent{Event: inputKeyDown}, wantErr: true},
+		{name: "x below 0", event: inputEvent{Event: inputMouseMove, X: -0.1, Y: 0.5}, wantErr: true},
+		{name: "y above 1", event: inputEvent{Event: inputMouseMove, X: 0.5, Y: 1.1}, wantErr: true},
+		{name: "negative button", event: inputEvent{Event: inputMouseDown, Button: -1}, wantErr: true},
+		{name: "button too high", event: inputEvent{Event: inputMouseDown, Button: maxInputButton + 1}, wantErr: true},
+		{name: "key too long", event: inputEvent{Event: inputKeyDown, Key: strings.Repeat("a", maxInputKeyLength+1)}, wantErr: true},
+		{name: "negative modifiers", event: inputEvent{Event: inputKeyDown, Key: "a", Mods: -1}, wantErr: true},
+		{name: "unknown modifier", event: inputEvent{Event: inputKeyDown, Key: "a", Mods: maxInputModifiers + 1}, wantErr: true},
+		{name: "wheel too far", event: inputEvent{Event: inputWheel, DY: maxInputWheel + 1}, wantErr: true},
+		{name: "wheel too far back", event: inputEvent{Event: inputWheel, DX: -maxInputWheel - 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.event.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
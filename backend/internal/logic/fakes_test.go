@@ -0,0 +1,53 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/AnishG-git/streamify/internal/connections"
+	"github.com/AnishG-git/streamify/internal/storage"
+	rdsModels "github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+// fakeManager keeps the members of rooms in memory. Methods the tests don't need are
+// left to the embedded nil interface and panic if called.
+type fakeManager struct {
+	connections.ConnManager
+	// members maps room codes to member names to their connection details
+	members map[string]map[string]*rdsModels.ConnectionDetails
+}
+
+func newFakeManager() *fakeManager {
+	return &fakeManager{members: make(map[string]map[string]*rdsModels.ConnectionDetails)}
+}
+
+// join adds a member with the given member token to a room
+func (m *fakeManager) join(roomCode, name, memberToken string) {
+	if m.members[roomCode] == nil {
+		m.members[roomCode] = make(map[string]*rdsModels.ConnectionDetails)
+	}
+	m.members[roomCode][name] = &rdsModels.ConnectionDetails{ConnectionID: name, TokenHash: hashToken(memberToken)}
+}
+
+func (m *fakeManager) GetUserConnectionDetails(ctx context.Context, roomCode, username string) (string, error) {
+	details, ok := m.members[roomCode][username]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", storage.ErrMemberNotFound, username)
+	}
+	b, err := json.Marshal(details)
+	return string(b), err
+}
+
+func (m *fakeManager) GetUserNamesFromRoom(ctx context.Context, roomCode string) ([]string, error) {
+	names := make([]string, 0, len(m.members[roomCode]))
+	for name := range m.members[roomCode] {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (m *fakeManager) IsRoomActive(ctx context.Context, roomCode string) (bool, error) {
+	_, ok := m.members[roomCode]
+	return ok, nil
+}
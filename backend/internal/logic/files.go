@@ -0,0 +1,245 @@
+package logic
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+
+	"github.com/AnishG-git/streamify/internal/connections"
+	"github.com/AnishG-git/streamify/internal/files"
+)
+
+const (
+	messageFileOffer    = "file-offer"
+	messageFileOffered  = "file-offered"
+	messageFileAccept   = "file-accept"
+	messageFileChunk    = "file-chunk"
+	messageFileComplete = "file-complete"
+	messageFileCancel   = "file-cancel"
+)
+
+var (
+	ErrFileTransferDisabled = errors.New("file transfer is not enabled on this server")
+	ErrNotRoomMember        = errors.New("not a member of this room")
+)
+
+// fileMessage is the body of the file-* messages, each uses a subset of the fields
+type fileMessage struct {
+	ID string `json:"id"`
+	// Ref is chosen by the sender of a file-offer and echoed back with the transfer's ID
+	Ref      string `json:"ref"`
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mime"`
+	To       string `json:"to"`
+	Seq      int    `json:"seq"`
+	Data     string `json:"data"`
+}
+
+// DownloadFileLogic opens a spooled file for a member of its room, name is their key and
+// memberToken the token they were sent when they joined. The caller closes the file.
+func DownloadFileLogic(ctx context.Context, manager connections.ConnManager, fileManager *files.Manager, roomCode, transferID, name, memberToken, token string) (*os.File, *files.Transfer, error) {
+	if fileManager == nil || !fileManager.Spooling() {
+		return nil, nil, ErrFileTransferDisabled
+	}
+	if err := checkMemberToken(ctx, manager, roomCode, name, memberToken); err != nil {
+		return nil, nil, err
+	}
+	return fileManager.Open(roomCode, transferID, token)
+}
+
+// handleFileMessage routes the file transfer messages
+func (s *session) handleFileMessage(ctx context.Context, message map[string]interface{}) {
+	if s.cfg.Files == nil {
+		s.sendError(ErrFileTransferDisabled.Error())
+		return
+	}
+	var body fileMessage
+	if err := decodeMessage(message, &body); err != nil {
+		s.sendError(fmt.Sprintf("invalid %s message", message["type"]))
+		return
+	}
+
+	switch message["type"] {
+	case messageFileOffer:
+		s.offerFile(ctx, &body)
+	case messageFileAccept:
+		s.acceptFile(ctx, &body)
+	case messageFileChunk:
+		s.relayFileChunk(ctx, &body)
+	case messageFileComplete:
+		s.completeFile(ctx, &body)
+	case messageFileCancel:
+		s.cancelFile(ctx, &body)
+	}
+}
+
+func (s *session) offerFile(ctx context.Context, body *fileMessage) {
+	if body.To != "" {
+		names, err := s.manager.GetUserNamesFromRoom(ctx, s.roomCode)
+		if err != nil {
+			s.logger.Printf("Failed to get user names from room %s: %v", s.roomCode, err)
+			s.sendError("failed to offer file")
+			return
+		}
+		if body.To == s.name || !slices.Contains(names, body.To) {
+			s.sendError(fmt.Sprintf("%s is not in the room", body.To))
+			return
+		}
+	}
+
+	transfer, err := s.cfg.Files.Offer(s.roomCode, s.name, body.Name, body.MimeType, body.Size, body.To)
+	if err != nil {
+		s.rejectFileMessage(body, err)
+		return
+	}
+	s.logger.Printf("User %s offered file %s (%d bytes) in room %s", s.name, transfer.ID, transfer.Size, s.roomCode)
+
+	s.send(map[string]interface{}{
+		"type":     messageFileOffered,
+		"ref":      body.Ref,
+		"transfer": transfer,
+	})
+	s.sendToRecipients(ctx, transfer, map[string]interface{}{
+		"type":     messageFileOffer,
+		"transfer": transfer,
+	})
+}
+
+func (s *session) acceptFile(ctx context.Context, body *fileMessage) {
+	transfer, err := s.cfg.Files.Accept(s.roomCode, body.ID, s.name)
+	if err != nil {
+		s.rejectFileMessage(body, err)
+		return
+	}
+	s.sendToMember(ctx, transfer.From, map[string]interface{}{
+		"type": messageFileAccept,
+		"id":   transfer.ID,
+		"name": s.name,
+	})
+}
+
+// relayFileChunk passes a base64 encoded chunk on to everyone who accepted the file
+func (s *session) relayFileChunk(ctx context.Context, body *fileMessage) {
+	data, err := base64.StdEncoding.DecodeString(body.Data)
+	if err != nil || len(data) == 0 {
+		s.sendError("file-chunk data must be non-empty base64")
+		return
+	}
+
+	recipients, err := s.cfg.Files.Chunk(s.roomCode, body.ID, s.name, body.Seq, data)
+	if err != nil {
+		s.rejectFileMessage(body, err)
+		return
+	}
+	chunk := map[string]interface{}{
+		"type": messageFileChunk,
+		"id":   body.ID,
+		"seq":  body.Seq,
+		"data": body.Data,
+	}
+	for _, name := range recipients {
+		if err := s.sendToMember(ctx, name, chunk); err != nil {
+			s.logger.Printf("Failed to relay chunk of file %s to %s in room %s: %v", body.ID, name, s.roomCode, err)
+		}
+	}
+}
+
+func (s *session) completeFile(ctx context.Context, body *fileMessage) {
+	transfer, token, err := s.cfg.Files.Complete(s.roomCode, body.ID, s.name)
+	if err != nil {
+		s.rejectFileMessage(body, err)
+		return
+	}
+	s.logger.Printf("User %s completed file %s in room %s", s.name, transfer.ID, s.roomCode)
+
+	complete := map[string]interface{}{
+		"type":     messageFileComplete,
+		"transfer": transfer,
+	}
+	if token != "" {
+		complete["url"] = fmt.Sprintf("/room/%s/files/%s?token=%s", url.PathEscape(s.roomCode), transfer.ID, token)
+	}
+	s.send(complete)
+	s.sendToRecipients(ctx, transfer, complete)
+}
+
+// cancelFile stops a transfer for everyone when the sender cancels it, and
+// tells the sender when a recipient stops receiving it
+func (s *session) cancelFile(ctx context.Context, body *fileMessage) {
+	transfer, all, err := s.cfg.Files.Cancel(s.roomCode, body.ID, s.name)
+	if err != nil {
+		s.rejectFileMessage(body, err)
+		return
+	}
+
+	cancel := map[string]interface{}{
+		"type": messageFileCancel,
+		"id":   transfer.ID,
+		"by":   s.name,
+	}
+	if all {
+		s.sendToRecipients(ctx, transfer, cancel)
+		return
+	}
+	s.sendToMember(ctx, transfer.From, cancel)
+}
+
+// cancelMemberFiles stops the unfinished transfers of a member who left
+func (s *session) cancelMemberFiles(ctx context.Context) {
+	if s.cfg.Files == nil {
+		return
+	}
+	for _, transfer := range s.cfg.Files.RemoveMember(s.roomCode, s.name) {
+		s.sendToRecipients(ctx, transfer, map[string]interface{}{
+			"type": messageFileCancel,
+			"id":   transfer.ID,
+			"by":   s.name,
+		})
+	}
+
+	// spooled files go with the room
+	active, err := s.manager.IsRoomActive(ctx, s.roomCode)
+	if err != nil {
+		s.logger.Printf("Failed to check whether room %s is active: %v", s.roomCode, err)
+		return
+	}
+	if !active {
+		s.cfg.Files.CloseRoom(s.roomCode)
+	}
+}
+
+// sendToRecipients sends a message about a transfer to everyone it was offered to
+func (s *session) sendToRecipients(ctx context.Context, transfer *files.Transfer, message map[string]interface{}) {
+	if transfer.To == "" {
+		s.broadcastFrom(ctx, transfer.From, message)
+		return
+	}
+	if err := s.sendToMember(ctx, transfer.To, message); err != nil {
+		s.logger.Printf("Failed to send %s to %s in room %s: %v", message["type"], transfer.To, s.roomCode, err)
+	}
+}
+
+// rejectFileMessage is sendError with the transfer's ID and ref, so clients know which transfer failed
+func (s *session) rejectFileMessage(body *fileMessage, err error) {
+	message := err.Error()
+	if !errors.Is(err, files.ErrTooLarge) && !errors.Is(err, files.ErrQuotaExceeded) &&
+		!errors.Is(err, files.ErrTransferNotFound) && !errors.Is(err, files.ErrNotAllowed) &&
+		!errors.Is(err, files.ErrOutOfOrder) && !errors.Is(err, files.ErrSizeMismatch) &&
+		!errors.Is(err, files.ErrInvalidFileName) {
+		s.logger.Printf("Failed to handle file transfer %s from %s in room %s: %v", body.ID, s.name, s.roomCode, err)
+		message = "file transfer failed"
+	}
+
+	s.logger.Printf("Rejected message from %s in room %s: %s", s.name, s.roomCode, message)
+	s.send(map[string]interface{}{
+		"type":  "message-error",
+		"error": message,
+		"id":    body.ID,
+		"ref":   body.Ref,
+	})
+}
@@ -0,0 +1,74 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/files"
+)
+
+func TestDownloadFileLogic(t *testing.T) {
+	ctx := context.Background()
+	fileManager, err := files.New(files.Config{
+		MaxFileSize: 1024,
+		RoomQuota:   1024,
+		SpoolDir:    t.TempDir(),
+		Instance:    "test",
+		SpoolTTL:    time.Minute,
+	}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("files.New() = %v", err)
+	}
+	transfer, err := fileManager.Offer("ROOM1", "alice", "notes.txt", "text/plain", 5, "")
+	if err != nil {
+		t.Fatalf("Offer() = %v", err)
+	}
+	if _, err := fileManager.Chunk("ROOM1", transfer.ID, "alice", 0, []byte("hello")); err != nil {
+		t.Fatalf("Chunk() = %v", err)
+	}
+	_, fileToken, err := fileManager.Complete("ROOM1", transfer.ID, "alice")
+	if err != nil {
+		t.Fatalf("Complete() = %v", err)
+	}
+
+	manager := newFakeManager()
+	manager.join("ROOM1", "alice", "alice-token")
+	manager.join("ROOM1", "bob", "bob-token")
+
+	tests := []struct {
+		name        string
+		member      string
+		memberToken string
+		fileToken   string
+		want        error
+	}{
+		{name: "member", member: "bob", memberToken: "bob-token", fileToken: fileToken},
+		{name: "bare name", member: "bob", memberToken: "", fileToken: fileToken, want: ErrNotRoomMember},
+		{name: "someone else's member token", member: "bob", memberToken: "alice-token", fileToken: fileToken, want: ErrNotRoomMember},
+		{name: "not a member", member: "mallory", memberToken: "bob-token", fileToken: fileToken, want: ErrNotRoomMember},
+		{name: "wrong file token", member: "bob", memberToken: "bob-token", fileToken: "guess", want: files.ErrTransferNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, _, err := DownloadFileLogic(ctx, manager, fileManager, "ROOM1", transfer.ID, tt.member, tt.memberToken, tt.fileToken)
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("DownloadFileLogic() = %v, want %v", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DownloadFileLogic() = %v", err)
+			}
+			defer f.Close()
+			content, err := io.ReadAll(f)
+			if err != nil || string(content) != "hello" {
+				t.Fatalf("downloaded %q, %v, want \"hello\"", content, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/connections"
+	"github.com/AnishG-git/streamify/internal/ice"
+	"github.com/AnishG-git/streamify/internal/storage"
+
+	rdsModels "github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+type ICEServers struct {
+	IceServers []ice.Server `json:"iceServers"`
+	// TTL is how many seconds the TURN credentials stay valid
+	TTL int `json:"ttl"`
+}
+
+// GetICEServersLogic returns the ICE servers a member of an active room should use. Only
+// members who are in the room get TURN credentials, name is their key and memberToken the token
+// they were sent when they joined.
+func GetICEServersLogic(ctx context.Context, manager connections.ConnManager, config *ice.Config, roomCode string, name string, memberToken string) (*ICEServers, error) {
+	active, err := manager.IsRoomActive(ctx, roomCode)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, ErrRoomNotFound
+	}
+	if err := checkMemberToken(ctx, manager, roomCode, name, memberToken); err != nil {
+		return nil, err
+	}
+
+	return &ICEServers{
+		IceServers: config.Servers(roomCode, name, time.Now()),
+		TTL:        int(config.TTL.Seconds()),
+	}, nil
+}
+
+// checkMemberToken returns ErrNotRoomMember unless name is in the room and memberToken is theirs
+func checkMemberToken(ctx context.Context, manager connections.ConnManager, roomCode, name, memberToken string) error {
+	connDetailsStr, err := manager.GetUserConnectionDetails(ctx, roomCode, name)
+	if errors.Is(err, storage.ErrMemberNotFound) {
+		return ErrNotRoomMember
+	}
+	if err != nil {
+		return err
+	}
+	var connDetails rdsModels.ConnectionDetails
+	if err := json.Unmarshal([]byte(connDetailsStr), &connDetails); err != nil {
+		return err
+	}
+	if !tokenMatches(memberToken, connDetails.TokenHash) {
+		return ErrNotRoomMember
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/audit"
+	rdsModels "github.com/AnishG-git/streamify/internal/storage/models"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// messageKick is sent by a host to remove a member
+	messageKick = "kick"
+	// messageKicked tells the member they were removed, right before their connection is closed
+	messageKicked = "kicked"
+)
+
+type kickTarget struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// kickMember handles kick, which lets the host remove a member from the room. The member is
+// told who removed them and why before their connection is closed, and can't rejoin under the
+// same key for KickBan. Hosts can't be removed.
+func (s *session) kickMember(ctx context.Context, message map[string]interface{}) {
+	if !s.isHost() {
+		s.sendError("only the host can remove members")
+		return
+	}
+	var target kickTarget
+	if err := decodeMessage(message, &target); err != nil || target.Name == "" {
+		s.sendError("kick requires a name")
+		return
+	}
+	if target.Name == s.name {
+		s.sendError("you can't remove yourself")
+		return
+	}
+
+	connDetailsStr, err := s.manager.GetUserConnectionDetails(ctx, s.roomCode, target.Name)
+	if err != nil {
+		s.sendError(fmt.Sprintf("%s is not in the room", target.Name))
+		return
+	}
+	var connDetails rdsModels.ConnectionDetails
+	if err := json.Unmarshal([]byte(connDetailsStr), &connDetails); err != nil {
+		s.logger.Printf("Failed to unmarshal connection details of %s in room %s: %v", target.Name, s.roomCode, err)
+		s.sendError("failed to remove member")
+		return
+	}
+	if connDetails.Role == rdsModels.RoleHost {
+		s.sendError("hosts can't be removed")
+		return
+	}
+
+	// banning first means the member can't rejoin before their connection is closed
+	if err := s.manager.BanFromRoom(ctx, s.roomCode, target.Name, time.Now().Add(s.cfg.KickBan)); err != nil {
+		s.logger.Printf("Failed to ban %s from room %s: %v", target.Name, s.roomCode, err)
+		s.sendError(fmt.Sprintf("failed to remove %s", target.Name))
+		return
+	}
+
+	err = s.manager.SendToConnection(connDetails.ConnectionID, map[string]interface{}{
+		"type":   messageKicked,
+		"by":     s.name,
+		"reason": target.Reason,
+	})
+	if err != nil {
+		s.logger.Printf("Failed to tell %s in room %s they were removed: %v", target.Name, s.roomCode, err)
+		s.sendError(fmt.Sprintf("failed to remove %s", target.Name))
+		return
+	}
+	// closing the connection ends the member's session, which removes them from the room
+	s.manager.CloseConnection(connDetails.ConnectionID, websocket.CloseNormalClosure, "removed by the host")
+
+	s.logger.Printf("User %s removed %s from room %s", s.name, target.Name, s.roomCode)
+	var details map[string]interface{}
+	if target.Reason != "" {
+		details = map[string]interface{}{"reason": target.Reason}
+	}
+	s.audit(ctx, audit.ActionMemberKicked, target.Name, details)
+}
@@ -0,0 +1,211 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/audit"
+	"github.com/AnishG-git/streamify/internal/connections"
+	rdsModels "github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+const (
+	messageKnock         = "knock"
+	messageKnocks        = "knocks"
+	messageKnockAdmit    = "knock-admit"
+	messageKnockDeny     = "knock-deny"
+	messageKnockResolved = "knock-resolved"
+	messageKnockPending  = "knock-pending"
+	messageKnockAdmitted = "knock-admitted"
+	messageKnockDenied   = "knock-denied"
+	messageKnockTimeout  = "knock-timeout"
+)
+
+// how a knock was resolved, sent to the hosts in knock-resolved
+const (
+	knockAdmitted = "admitted"
+	knockDenied   = "denied"
+	knockTimedOut = "timeout"
+	knockLeft     = "left"
+)
+
+// decisionGrace is how long a timed out member keeps waiting for a decision a host made just before the timeout
+const decisionGrace = 5 * time.Second
+
+var (
+	ErrAlreadyKnocking = errors.New("someone with this name is already waiting to join")
+	errNotKnocking     = errors.New("not waiting to join")
+)
+
+// waitInLobby puts a member in the room's lobby, tells the hosts and waits until a host
+// decides, the member gives up or the wait times out. It reports whether the member was admitted.
+func waitInLobby(ctx context.Context, logger *log.Logger, manager connections.ConnManager, cfg *ConnectConfig, roomCode, name string, connDetails *rdsModels.ConnectionDetails, messages <-chan readResult) (bool, error) {
+	knock := &rdsModels.Knock{
+		Name:         name,
+		DisplayName:  connDetails.DisplayName,
+		AvatarURL:    connDetails.AvatarURL,
+		Role:         connDetails.Role,
+		ManagerID:    connDetails.ManagerID,
+		ConnectionID: connDetails.ConnectionID,
+		KnockedAt:    time.Now().UTC(),
+	}
+	decision := manager.AwaitAdmission(connDetails.ConnectionID)
+	defer manager.StopAwaitingAdmission(connDetails.ConnectionID)
+
+	added, err := manager.AddKnock(ctx, roomCode, knock)
+	if err != nil {
+		return false, err
+	}
+	if !added {
+		return false, ErrAlreadyKnocking
+	}
+
+	logger.Printf("User %s is waiting to join room %s", name, roomCode)
+	send := func(messageType string) {
+		manager.SendToConnection(connDetails.ConnectionID, map[string]interface{}{
+			"type":    messageType,
+			"timeout": cfg.LobbyTimeout.Seconds(),
+		})
+	}
+	send(messageKnockPending)
+	broadcastToRoom(ctx, logger, manager, roomCode, "", map[string]interface{}{
+		"type":  messageKnock,
+		"knock": knock,
+	}, rdsModels.RoleHost)
+
+	timeout := time.NewTimer(cfg.LobbyTimeout)
+	defer timeout.Stop()
+	claimed := false
+	for {
+		select {
+		case admitted := <-decision:
+			if !admitted {
+				send(messageKnockDenied)
+				return false, nil
+			}
+			send(messageKnockAdmitted)
+			return true, nil
+		case result := <-messages:
+			if result.err == nil {
+				// messages sent while waiting are dropped
+				continue
+			}
+			if knock, err := manager.RemoveKnock(ctx, roomCode, name); err == nil && knock != nil {
+				announceKnockResolved(ctx, logger, manager, roomCode, name, knockLeft, "")
+			}
+			return false, nil
+		case <-timeout.C:
+			if claimed {
+				send(messageKnockTimeout)
+				return false, nil
+			}
+			knock, err := manager.RemoveKnock(ctx, roomCode, name)
+			if err != nil {
+				return false, err
+			}
+			if knock != nil {
+				send(messageKnockTimeout)
+				announceKnockResolved(ctx, logger, manager, roomCode, name, knockTimedOut, "")
+				return false, nil
+			}
+			// a host took the knock just now and their decision is on its way
+			claimed = true
+			timeout.Reset(decisionGrace)
+		}
+	}
+}
+
+// resolveKnock takes a member out of the lobby and admits or denies them on behalf of by
+func resolveKnock(ctx context.Context, logger *log.Logger, manager connections.ConnManager, roomCode, name string, admitted bool, by string) error {
+	knock, err := manager.RemoveKnock(ctx, roomCode, name)
+	if err != nil {
+		return err
+	}
+	if knock == nil {
+		return errNotKnocking
+	}
+	// waiting connections are only reachable on the instance holding them
+	if !manager.DecideAdmission(knock.ConnectionID, admitted) {
+		return errNotKnocking
+	}
+
+	result := knockDenied
+	if admitted {
+		result = knockAdmitted
+	}
+	logger.Printf("User %s was %s to room %s by %s", name, result, roomCode, by)
+	announceKnockResolved(ctx, logger, manager, roomCode, name, result, by)
+	return nil
+}
+
+// admitAllKnocks lets everyone waiting in the lobby in, once the waiting room is turned off
+func admitAllKnocks(ctx context.Context, logger *log.Logger, manager connections.ConnManager, roomCode string) {
+	knocks, err := manager.GetKnocks(ctx, roomCode)
+	if err != nil {
+		logger.Printf("Failed to get knocks of room %s: %v", roomCode, err)
+		return
+	}
+	for _, knock := range knocks {
+		if err := resolveKnock(ctx, logger, manager, roomCode, knock.Name, true, ""); err != nil && !errors.Is(err, errNotKnocking) {
+			logger.Printf("Failed to admit %s to room %s: %v", knock.Name, roomCode, err)
+		}
+	}
+}
+
+// announceKnockResolved tells the hosts a member left the lobby so they can update their list
+func announceKnockResolved(ctx context.Context, logger *log.Logger, manager connections.ConnManager, roomCode, name, result, by string) {
+	broadcastToRoom(ctx, logger, manager, roomCode, "", map[string]interface{}{
+		"type":   messageKnockResolved,
+		"name":   name,
+		"result": result,
+		"by":     by,
+	}, rdsModels.RoleHost)
+}
+
+// decideKnock handles knock-admit and knock-deny, which only hosts can send
+func (s *session) decideKnock(ctx context.Context, message map[string]interface{}, admitted bool) {
+	if !s.isHost() {
+		s.sendError("only the host can admit or deny members")
+		return
+	}
+	var target presentTarget
+	if err := decodeMessage(message, &target); err != nil || target.Name == "" {
+		s.sendError(fmt.Sprintf("%s requires a name", message["type"]))
+		return
+	}
+
+	err := resolveKnock(ctx, s.logger, s.manager, s.roomCode, target.Name, admitted, s.name)
+	if errors.Is(err, errNotKnocking) {
+		s.sendError(fmt.Sprintf("%s is not waiting to join", target.Name))
+		return
+	}
+	if err != nil {
+		s.logger.Printf("Failed to resolve knock of %s in room %s: %v", target.Name, s.roomCode, err)
+		s.sendError("failed to resolve knock")
+		return
+	}
+	action := audit.ActionKnockDenied
+	if admitted {
+		action = audit.ActionKnockAdmitted
+	}
+	s.audit(ctx, action, target.Name, nil)
+}
+
+// sendKnocks sends a host who just joined who is waiting in the lobby
+func (s *session) sendKnocks(ctx context.Context) {
+	if !s.isHost() {
+		return
+	}
+	knocks, err := s.manager.GetKnocks(ctx, s.roomCode)
+	if err != nil {
+		s.logger.Printf("Failed to get knocks of room %s: %v", s.roomCode, err)
+		return
+	}
+	s.send(map[string]interface{}{
+		"type":   messageKnocks,
+		"knocks": knocks,
+	})
+}
@@ -0,0 +1,251 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	rdsModels "github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+const (
+	messageScreenShareStart  = "screen-share-start"
+	messageScreenShareStop   = "screen-share-stop"
+	messageMediaState        = "media-state"
+	messageScreenShareDenied = "screen-share-denied"
+	messageRoomState         = "room-state"
+)
+
+const (
+	maxScreenDimension = 7680
+	maxScreenFPS       = 240
+)
+
+// mediaUpdate is the body of screen-share-start, screen-share-stop and media-state
+// messages. Fields that are left out keep their current value.
+type mediaUpdate struct {
+	Mic    *bool `json:"mic"`
+	Camera *bool `json:"camera"`
+	Screen *bool `json:"screen"`
+	Width  *int  `json:"width"`
+	Height *int  `json:"height"`
+	FPS    *int  `json:"fps"`
+}
+
+func (u *mediaUpdate) validate() error {
+	for _, dimension := range []*int{u.Width, u.Height} {
+		if dimension != nil && (*dimension < 0 || *dimension > maxScreenDimension) {
+			return fmt.Errorf("width and height must be between 0 and %d", maxScreenDimension)
+		}
+	}
+	if u.FPS != nil && (*u.FPS < 0 || *u.FPS > maxScreenFPS) {
+		return fmt.Errorf("fps must be between 0 and %d", maxScreenFPS)
+	}
+	return nil
+}
+
+func (u *mediaUpdate) apply(state *rdsModels.MediaState) {
+	if u.Mic != nil {
+		state.Mic = *u.Mic
+	}
+	if u.Camera != nil {
+		state.Camera = *u.Camera
+	}
+	if u.Screen != nil {
+		state.Screen = *u.Screen
+	}
+	if u.Width != nil {
+		state.Width = *u.Width
+	}
+	if u.Height != nil {
+		state.Height = *u.Height
+	}
+	if u.FPS != nil {
+		state.FPS = *u.FPS
+	}
+	// resolution and frame rate only describe a live screen share
+	if !state.Screen {
+		state.Width, state.Height, state.FPS = 0, 0, 0
+	}
+}
+
+// handleMediaState stores a change to what the member is publishing and tells the room.
+// In single presenter rooms a screen share only starts if nobody else is presenting.
+func (s *session) handleMediaState(ctx context.Context, message map[string]interface{}) {
+	var update mediaUpdate
+	if err := decodeMessage(message, &update); err != nil {
+		s.sendError("invalid media state")
+		return
+	}
+	if err := update.validate(); err != nil {
+		s.sendError(err.Error())
+		return
+	}
+	switch message["type"] {
+	case messageScreenShareStart:
+		update.Screen = boolPtr(true)
+	case messageScreenShareStop:
+		update.Screen = boolPtr(false)
+	}
+
+	state := s.media
+	update.apply(&state)
+	state.UpdatedAt = time.Now().UTC()
+
+	started := state.Screen && !s.media.Screen
+	stopped := !state.Screen && s.media.Screen
+	if started {
+		if ok := s.claimPresenter(ctx); !ok {
+			return
+		}
+	}
+	if err := s.manager.SetMediaState(ctx, s.roomCode, s.name, &state); err != nil {
+		s.logger.Printf("Failed to store media state of %s in room %s: %v", s.name, s.roomCode, err)
+		s.sendError("failed to update media state")
+		return
+	}
+	s.media = state
+	if stopped {
+		// presenters are done once they stop sharing
+		s.releasePresenterSlot(ctx, s.name)
+		s.revokeScreenControl(ctx)
+	}
+
+	s.announce(ctx, map[string]interface{}{
+		"type":  messageMediaState,
+		"name":  s.name,
+		"state": state,
+	})
+	if started {
+		s.announce(ctx, map[string]interface{}{
+			"type":   messageScreenShareStart,
+			"name":   s.name,
+			"width":  state.Width,
+			"height": state.Height,
+			"fps":    state.FPS,
+		})
+	}
+	if stopped {
+		s.announce(ctx, map[string]interface{}{
+			"type": messageScreenShareStop,
+			"name": s.name,
+		})
+	}
+	if started || stopped {
+		s.syncViewerTracks(ctx)
+	}
+}
+
+// claimPresenter takes the presenter slot in single presenter rooms and reports whether the share may start
+func (s *session) claimPresenter(ctx context.Context) bool {
+	// the setting can change while the member is connected
+	room, err := s.manager.GetRoom(ctx, s.roomCode)
+	if err != nil {
+		s.logger.Printf("Failed to get room %s: %v", s.roomCode, err)
+		s.sendError("failed to start screen share")
+		return false
+	}
+	if !room.Settings.SinglePresenter {
+		return true
+	}
+
+	presenter, err := s.manager.ClaimPresenter(ctx, s.roomCode, s.name)
+	if err != nil {
+		s.logger.Printf("Failed to claim presenter in room %s: %v", s.roomCode, err)
+		s.sendError("failed to start screen share")
+		return false
+	}
+	if presenter == "" {
+		s.send(map[string]interface{}{
+			"type":  messageScreenShareDenied,
+			"error": "other members are waiting to present, send request-present to join the queue",
+		})
+		return false
+	}
+	if presenter != s.name {
+		s.send(map[string]interface{}{
+			"type":      messageScreenShareDenied,
+			"error":     "only one member can present at a time",
+			"presenter": presenter,
+		})
+		return false
+	}
+	announcePresenterQueue(ctx, s.logger, s.manager, s.roomCode)
+	return true
+}
+
+// clearMediaState removes the member's media state once they leave and tells the room they stopped sharing.
+// Their presenter slot is given up by leavePresenterQueue.
+func (s *session) clearMediaState(ctx context.Context) {
+	if s.media == (rdsModels.MediaState{}) {
+		return
+	}
+	if err := s.manager.RemoveMediaState(ctx, s.roomCode, s.name); err != nil {
+		s.logger.Printf("Failed to remove media state of %s in room %s: %v", s.name, s.roomCode, err)
+	}
+	if s.media.Screen {
+		s.announce(ctx, map[string]interface{}{
+			"type": messageScreenShareStop,
+			"name": s.name,
+		})
+		s.syncViewerTracks(ctx)
+	}
+	s.announce(ctx, map[string]interface{}{
+		"type":  messageMediaState,
+		"name":  s.name,
+		"state": nil,
+	})
+}
+
+// sendRoomState sends a new member what everyone in the room is currently publishing, who presents
+// and whose hand is raised
+func (s *session) sendRoomState(ctx context.Context) {
+	states, err := s.manager.GetMediaStates(ctx, s.roomCode)
+	if err != nil {
+		s.logger.Printf("Failed to get media states of room %s: %v", s.roomCode, err)
+		return
+	}
+	presenter, err := s.manager.GetPresenter(ctx, s.roomCode)
+	if err != nil {
+		s.logger.Printf("Failed to get presenter of room %s: %v", s.roomCode, err)
+		return
+	}
+	queue, err := s.manager.GetPresenterQueue(ctx, s.roomCode)
+	if err != nil {
+		s.logger.Printf("Failed to get presenter queue of room %s: %v", s.roomCode, err)
+		return
+	}
+	hands, err := s.manager.GetRaisedHands(ctx, s.roomCode)
+	if err != nil {
+		s.logger.Printf("Failed to get raised hands of room %s: %v", s.roomCode, err)
+		return
+	}
+	members, err := s.manager.GetMembers(ctx, s.roomCode)
+	if err != nil {
+		s.logger.Printf("Failed to get members of room %s: %v", s.roomCode, err)
+		return
+	}
+	// profiles are keyed like every other map, by the members' keys
+	profiles := make(map[string]*MemberProfile, len(members))
+	for name, connDetails := range members {
+		profiles[name] = &MemberProfile{
+			UserID:      connDetails.UserID,
+			DisplayName: connDetails.DisplayName,
+			AvatarURL:   connDetails.AvatarURL,
+			Role:        connDetails.Role,
+		}
+	}
+
+	s.send(map[string]interface{}{
+		"type":      messageRoomState,
+		"members":   profiles,
+		"media":     states,
+		"presenter": presenter,
+		"queue":     queue,
+		"hands":     hands,
+	})
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,251 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/AnishG-git/streamify/internal/audit"
+	"github.com/AnishG-git/streamify/internal/connections"
+)
+
+const (
+	messageRequestPresent = "request-present"
+	messageCancelPresent  = "cancel-present"
+	messageGrantPresent   = "grant-present"
+	messageDenyPresent    = "deny-present"
+	messageReleasePresent = "release-present"
+	messagePresenterQueue = "presenter-queue"
+	messagePresentDenied  = "present-denied"
+	messageMemberJoined   = "member-joined"
+	// messageJoined tells a member they joined, with their key and member token
+	messageJoined     = "joined"
+	messageMemberLeft = "member-left"
+)
+
+// presentTarget is the body of grant-present, deny-present and release-present
+type presentTarget struct {
+	Name string `json:"name"`
+}
+
+// announcePresenterQueue tells the room who is presenting and who is waiting
+func announcePresenterQueue(ctx context.Context, logger *log.Logger, manager connections.ConnManager, roomCode string) {
+	presenter, err := manager.GetPresenter(ctx, roomCode)
+	if err != nil {
+		logger.Printf("Failed to get presenter of room %s: %v", roomCode, err)
+		return
+	}
+	queue, err := manager.GetPresenterQueue(ctx, roomCode)
+	if err != nil {
+		logger.Printf("Failed to get presenter queue of room %s: %v", roomCode, err)
+		return
+	}
+
+	broadcastToRoom(ctx, logger, manager, roomCode, "", map[string]interface{}{
+		"type":      messagePresenterQueue,
+		"presenter": presenter,
+		"queue":     queue,
+	})
+}
+
+// advancePresenterQueue hands a free presenter slot to the first queued member and reports whether it did.
+// The room is told when the slot changes hands.
+func advancePresenterQueue(ctx context.Context, logger *log.Logger, manager connections.ConnManager, roomCode string) bool {
+	presenter, err := manager.AdvancePresenterQueue(ctx, roomCode)
+	if err != nil {
+		logger.Printf("Failed to advance presenter queue of room %s: %v", roomCode, err)
+		return false
+	}
+	if presenter == "" {
+		return false
+	}
+
+	logger.Printf("User %s is now presenting in room %s", presenter, roomCode)
+	announcePresenterQueue(ctx, logger, manager, roomCode)
+	return true
+}
+
+// requestPresent handles request-present by queueing the member for the presenter slot
+func (s *session) requestPresent(ctx context.Context) {
+	added, err := s.manager.EnqueuePresenter(ctx, s.roomCode, s.name)
+	if err != nil {
+		s.logger.Printf("Failed to queue %s to present in room %s: %v", s.name, s.roomCode, err)
+		s.sendError("failed to request to present")
+		return
+	}
+	if !added {
+		s.sendError("already presenting or waiting to present")
+		return
+	}
+
+	if s.autoGrantPresenter(ctx) && advancePresenterQueue(ctx, s.logger, s.manager, s.roomCode) {
+		s.syncViewerTracks(ctx)
+		return
+	}
+	announcePresenterQueue(ctx, s.logger, s.manager, s.roomCode)
+}
+
+// cancelPresent handles cancel-present by taking the member out of the queue
+func (s *session) cancelPresent(ctx context.Context) {
+	removed, err := s.manager.DequeuePresenter(ctx, s.roomCode, s.name)
+	if err != nil {
+		s.logger.Printf("Failed to remove %s from the presenter queue of room %s: %v", s.name, s.roomCode, err)
+		s.sendError("failed to cancel request to present")
+		return
+	}
+	if !removed {
+		s.sendError("not waiting to present")
+		return
+	}
+	announcePresenterQueue(ctx, s.logger, s.manager, s.roomCode)
+}
+
+// grantPresent handles grant-present, which lets the host hand the slot to any member,
+// the first queued one if no name is given. The previous presenter loses the slot.
+func (s *session) grantPresent(ctx context.Context, message map[string]interface{}) {
+	if !s.isHost() {
+		s.sendError("only the host can grant the presenter slot")
+		return
+	}
+	var target presentTarget
+	if err := decodeMessage(message, &target); err != nil {
+		s.sendError("invalid grant-present message")
+		return
+	}
+
+	name := target.Name
+	if name == "" {
+		queue, err := s.manager.GetPresenterQueue(ctx, s.roomCode)
+		if err != nil {
+			s.logger.Printf("Failed to get presenter queue of room %s: %v", s.roomCode, err)
+			s.sendError("failed to grant the presenter slot")
+			return
+		}
+		if len(queue) == 0 {
+			s.sendError("nobody is waiting to present")
+			return
+		}
+		name = queue[0]
+	}
+
+	names, err := s.manager.GetUserNamesFromRoom(ctx, s.roomCode)
+	if err != nil {
+		s.logger.Printf("Failed to get user names from room %s: %v", s.roomCode, err)
+		s.sendError("failed to grant the presenter slot")
+		return
+	}
+	if !slices.Contains(names, name) {
+		s.sendError(fmt.Sprintf("%s is not in the room", name))
+		return
+	}
+
+	if _, err := s.manager.GrantPresenter(ctx, s.roomCode, name); err != nil {
+		s.logger.Printf("Failed to grant presenter to %s in room %s: %v", name, s.roomCode, err)
+		s.sendError("failed to grant the presenter slot")
+		return
+	}
+	s.logger.Printf("User %s is now presenting in room %s", name, s.roomCode)
+	s.audit(ctx, audit.ActionPresenterGrant, name, nil)
+	announcePresenterQueue(ctx, s.logger, s.manager, s.roomCode)
+	s.syncViewerTracks(ctx)
+}
+
+// denyPresent handles deny-present, which lets the host turn down a queued member
+func (s *session) denyPresent(ctx context.Context, message map[string]interface{}) {
+	if !s.isHost() {
+		s.sendError("only the host can deny requests to present")
+		return
+	}
+	var target presentTarget
+	if err := decodeMessage(message, &target); err != nil || target.Name == "" {
+		s.sendError("deny-present requires a name")
+		return
+	}
+
+	removed, err := s.manager.DequeuePresenter(ctx, s.roomCode, target.Name)
+	if err != nil {
+		s.logger.Printf("Failed to remove %s from the presenter queue of room %s: %v", target.Name, s.roomCode, err)
+		s.sendError("failed to deny request to present")
+		return
+	}
+	if !removed {
+		s.sendError(fmt.Sprintf("%s is not waiting to present", target.Name))
+		return
+	}
+
+	s.announce(ctx, map[string]interface{}{
+		"type": messagePresentDenied,
+		"name": target.Name,
+	})
+	s.audit(ctx, audit.ActionPresenterDeny, target.Name, nil)
+	announcePresenterQueue(ctx, s.logger, s.manager, s.roomCode)
+}
+
+// releasePresent handles release-present. Presenters release their own slot,
+// the host can take it from anyone by naming them.
+func (s *session) releasePresent(ctx context.Context, message map[string]interface{}) {
+	var target presentTarget
+	if err := decodeMessage(message, &target); err != nil {
+		s.sendError("invalid release-present message")
+		return
+	}
+
+	name := s.name
+	if target.Name != "" && target.Name != s.name {
+		if !s.isHost() {
+			s.sendError("only the host can take the presenter slot from someone else")
+			return
+		}
+		name = target.Name
+	}
+
+	if !s.releasePresenterSlot(ctx, name) {
+		s.sendError(fmt.Sprintf("%s is not presenting", name))
+		return
+	}
+	if name != s.name {
+		s.audit(ctx, audit.ActionPresenterRevoke, name, nil)
+	}
+}
+
+// releasePresenterSlot frees the slot if name holds it and passes it on to the
+// next queued member in auto-grant rooms. It reports whether name held the slot.
+func (s *session) releasePresenterSlot(ctx context.Context, name string) bool {
+	released, err := s.manager.ReleasePresenter(ctx, s.roomCode, name)
+	if err != nil {
+		s.logger.Printf("Failed to release presenter in room %s: %v", s.roomCode, err)
+		return false
+	}
+	if !released {
+		return false
+	}
+	defer s.syncViewerTracks(ctx)
+
+	if s.autoGrantPresenter(ctx) && advancePresenterQueue(ctx, s.logger, s.manager, s.roomCode) {
+		return true
+	}
+	announcePresenterQueue(ctx, s.logger, s.manager, s.roomCode)
+	return true
+}
+
+// leavePresenterQueue gives up the member's place in the queue and the slot once they leave
+func (s *session) leavePresenterQueue(ctx context.Context) {
+	removed, err := s.manager.DequeuePresenter(ctx, s.roomCode, s.name)
+	if err != nil {
+		s.logger.Printf("Failed to remove %s from the presenter queue of room %s: %v", s.name, s.roomCode, err)
+	}
+	if !s.releasePresenterSlot(ctx, s.name) && removed {
+		announcePresenterQueue(ctx, s.logger, s.manager, s.roomCode)
+	}
+}
+
+// autoGrantPresenter reads the setting from storage since the host can change it at any time
+func (s *session) autoGrantPresenter(ctx context.Context) bool {
+	room, err := s.manager.GetRoom(ctx, s.roomCode)
+	if err != nil {
+		s.logger.Printf("Failed to get room %s: %v", s.roomCode, err)
+		return false
+	}
+	return room.Settings.AutoGrantPresenter
+}
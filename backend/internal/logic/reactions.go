@@ -0,0 +1,122 @@
+package logic
+
+import (
+	"context"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/AnishG-git/streamify/internal/connections"
+)
+
+const (
+	messageReaction    = "reaction"
+	messageRaiseHand   = "raise-hand"
+	messageLowerHand   = "lower-hand"
+	messagePointerPing = "pointer-ping"
+	messageHand        = "hand"
+)
+
+// maxEmojiLength fits emoji built from several code points, like flags and skin tones
+const maxEmojiLength = 16
+
+// isEphemeral reports whether a message type is one of the ephemeral events, which have their own rate limit
+func isEphemeral(messageType interface{}) bool {
+	switch messageType {
+	case messageReaction, messageRaiseHand, messageLowerHand, messagePointerPing:
+		return true
+	}
+	return false
+}
+
+// ephemeralBody is the body of reaction and pointer-ping messages
+type ephemeralBody struct {
+	Emoji string   `json:"emoji"`
+	X     *float64 `json:"x"`
+	Y     *float64 `json:"y"`
+}
+
+// sendReaction handles reaction. Identical reactions from a member are coalesced into one event with a count.
+func (s *session) sendReaction(ctx context.Context, message map[string]interface{}) {
+	var body ephemeralBody
+	if err := decodeMessage(message, &body); err != nil || !validEmoji(body.Emoji) {
+		s.sendError("reaction requires a single emoji")
+		return
+	}
+
+	s.manager.SendEphemeral(ctx, s.logger, s.roomCode, &connections.EphemeralEvent{
+		Key: messageReaction + ":" + s.name + ":" + body.Emoji,
+		Message: map[string]interface{}{
+			"type":  messageReaction,
+			"name":  s.name,
+			"emoji": body.Emoji,
+			"at":    time.Now().UTC(),
+		},
+		Count: 1,
+	})
+}
+
+// sendPointerPing handles pointer-ping, a short highlight at a position of the shared screen.
+// Only a member's latest ping is sent per flush.
+func (s *session) sendPointerPing(ctx context.Context, message map[string]interface{}) {
+	var body ephemeralBody
+	if err := decodeMessage(message, &body); err != nil || body.X == nil || body.Y == nil {
+		s.sendError("pointer-ping requires x and y")
+		return
+	}
+	if *body.X < 0 || *body.X > 1 || *body.Y < 0 || *body.Y > 1 {
+		s.sendError("x and y must be between 0 and 1")
+		return
+	}
+
+	s.manager.SendEphemeral(ctx, s.logger, s.roomCode, &connections.EphemeralEvent{
+		Key: messagePointerPing + ":" + s.name,
+		Message: map[string]interface{}{
+			"type": messagePointerPing,
+			"name": s.name,
+			"x":    *body.X,
+			"y":    *body.Y,
+			"at":   time.Now().UTC(),
+		},
+	})
+}
+
+// setHand handles raise-hand and lower-hand. Unlike the other ephemeral events
+// raised hands are stored so members who join later see them.
+func (s *session) setHand(ctx context.Context, raised bool) {
+	now := time.Now().UTC()
+	var err error
+	if raised {
+		err = s.manager.RaiseHand(ctx, s.roomCode, s.name, now)
+	} else {
+		_, err = s.manager.LowerHand(ctx, s.roomCode, s.name)
+	}
+	if err != nil {
+		s.logger.Printf("Failed to update hand of %s in room %s: %v", s.name, s.roomCode, err)
+		s.sendError("failed to update hand")
+		return
+	}
+
+	s.manager.SendEphemeral(ctx, s.logger, s.roomCode, &connections.EphemeralEvent{
+		Key: messageHand + ":" + s.name,
+		Message: map[string]interface{}{
+			"type":   messageHand,
+			"name":   s.name,
+			"raised": raised,
+			"at":     now,
+		},
+	})
+}
+
+// validEmoji accepts short strings of printable characters that are not letters or digits
+func validEmoji(emoji string) bool {
+	if emoji == "" || len(emoji) > maxEmojiLength || !utf8.ValidString(emoji) {
+		return false
+	}
+	for _, r := range emoji {
+		if r < utf8.RuneSelf || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
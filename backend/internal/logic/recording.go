@@ -0,0 +1,89 @@
+package logic
+
+import (
+	"context"
+	"errors"
+
+	"github.com/AnishG-git/streamify/internal/connections"
+	"github.com/AnishG-git/streamify/internal/recorder"
+)
+
+const (
+	messageRecordingStart   = "recording-start"
+	messageRecordingStop    = "recording-stop"
+	messageRecordingStarted = "recording-started"
+	messageRecordingStopped = "recording-stopped"
+)
+
+var ErrRecordingDisabled = errors.New("recording is not enabled on this server")
+
+// ListRecordingsLogic returns the recordings of a room to its owner
+func ListRecordingsLogic(ctx context.Context, manager connections.ConnManager, rec *recorder.Recorder, roomCode string, ownerToken string) ([]recorder.Recording, error) {
+	if rec == nil {
+		return nil, ErrRecordingDisabled
+	}
+	if _, err := getOwnedRoom(ctx, manager, roomCode, ownerToken); err != nil {
+		return nil, err
+	}
+	return rec.List(ctx, roomCode)
+}
+
+// startRecording handles recording-start, which only hosts of SFU rooms may send
+func (s *session) startRecording(ctx context.Context) {
+	if !s.canControlRecording() {
+		return
+	}
+
+	participants, err := s.manager.GetUserNamesFromRoom(ctx, s.roomCode)
+	if err != nil {
+		s.logger.Printf("Failed to get user names from room %s: %v", s.roomCode, err)
+	}
+
+	recording, err := s.cfg.Recorder.Start(s.roomCode, s.name, participants)
+	if errors.Is(err, recorder.ErrAlreadyRecording) {
+		s.sendError(err.Error())
+		return
+	}
+	if err != nil {
+		s.logger.Printf("Failed to start recording in room %s: %v", s.roomCode, err)
+		s.sendError("failed to start recording")
+		return
+	}
+
+	s.announce(ctx, map[string]interface{}{
+		"type":      messageRecordingStarted,
+		"recording": recording,
+	})
+}
+
+// stopRecording handles recording-stop, which only hosts of SFU rooms may send
+func (s *session) stopRecording(ctx context.Context) {
+	if !s.canControlRecording() {
+		return
+	}
+
+	recording, err := s.cfg.Recorder.Stop(s.roomCode)
+	if err != nil {
+		s.sendError(err.Error())
+		return
+	}
+
+	s.announce(ctx, map[string]interface{}{
+		"type":      messageRecordingStopped,
+		"recording": recording,
+	})
+}
+
+func (s *session) canControlRecording() bool {
+	switch {
+	case s.cfg.Recorder == nil:
+		s.sendError(ErrRecordingDisabled.Error())
+	case !s.isSFU():
+		s.sendError("only rooms in SFU mode can be recorded")
+	case !s.isHost():
+		s.sendError("only the host can control recording")
+	default:
+		return true
+	}
+	return false
+}
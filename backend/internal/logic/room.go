@@ -3,46 +3,638 @@ package logic
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
 	"log"
+	"time"
 
+	"github.com/AnishG-git/streamify/internal/audit"
+	"github.com/AnishG-git/streamify/internal/codegen"
 	"github.com/AnishG-git/streamify/internal/connections"
+	"github.com/AnishG-git/streamify/internal/files"
+	"github.com/AnishG-git/streamify/internal/metrics"
+	"github.com/AnishG-git/streamify/internal/ratelimit"
+	"github.com/AnishG-git/streamify/internal/recorder"
+	"github.com/AnishG-git/streamify/internal/sfu"
+	"github.com/AnishG-git/streamify/internal/storage"
 	"github.com/gorilla/websocket"
+
+	rdsModels "github.com/AnishG-git/streamify/internal/storage/models"
 )
 
-func GenerateRoomLogic(ctx context.Context, logger *log.Logger, manager connections.ConnManager) (string, error) {
-	var roomCode string
-	for {
-		roomCode = generateRoomCode()
-		exists, err := manager.IsRoomActive(ctx, roomCode)
+var (
+	ErrRoomCodeTaken  = errors.New("room code is already taken")
+	ErrRoomNotFound   = errors.New("room not found")
+	ErrNotRoomOwner   = errors.New("not the owner of this room")
+	ErrOwnerRequired  = errors.New("persistent rooms require an owner")
+	ErrInvalidOptions = errors.New("invalid room options")
+	ErrSFUDisabled    = errors.New("SFU mode is not enabled on this server")
+)
+
+// RoomPolicy holds the server-wide limits applied to every room
+type RoomPolicy struct {
+	Codes           *codegen.Policy
+	DefaultCapacity int
+	MaxCapacity     int
+	// MaxSFUCapacity replaces MaxCapacity for SFU rooms, zero disables SFU mode
+	MaxSFUCapacity int
+	// MaxViewerCapacity bounds the viewers a room can have on top of its capacity, zero disables viewers
+	MaxViewerCapacity int
+	// MaxDuration bounds how long scheduled rooms are open, zero disables scheduled rooms
+	MaxDuration time.Duration
+	// MaxScheduleAhead bounds how far in the future a scheduled room can start
+	MaxScheduleAhead time.Duration
+	// EndWarning is how long before a scheduled room ends its members are warned
+	EndWarning time.Duration
+}
+
+// RoomOptions are the optional settings a client can request when generating a room
+type RoomOptions struct {
+	// Code is a requested vanity code, a random code is generated if empty
+	Code     string
+	Title    string
+	Capacity int
+	// ViewerCapacity is how many viewers can join, none if zero
+	ViewerCapacity int
+	// Mode is rdsModels.RoomModeMesh (the default) or rdsModels.RoomModeSFU
+	Mode       string
+	Persistent bool
+	Owner      string
+	// OwnerID is the user ID of the signed-in user creating the room, who joins it as host
+	OwnerID string
+	// SinglePresenter allows only one screen share at a time
+	SinglePresenter bool
+	// AutoGrantPresenter grants presenter requests in order without the host
+	AutoGrantPresenter bool
+	// WaitingRoom holds members in a lobby until a host admits them
+	WaitingRoom bool
+	// StartsAt schedules the room to open later and needs a Duration
+	StartsAt *time.Time
+	// Duration closes the room this long after it opens, rooms without one stay open
+	Duration time.Duration
+}
+
+type CreatedRoom struct {
+	Code string `json:"code"`
+	// OwnerToken authorizes managing the room later and is only ever returned here
+	OwnerToken string `json:"ownerToken"`
+}
+
+// RoomInfo is the public view of a room. Occupancy counts the members who aren't viewers and
+// ParentCode is only set for breakout rooms.
+type RoomInfo struct {
+	Code           string                 `json:"code"`
+	Title          string                 `json:"title"`
+	Capacity       int                    `json:"capacity"`
+	Occupancy      int                    `json:"occupancy"`
+	ViewerCapacity int                    `json:"viewerCapacity"`
+	Viewers        int                    `json:"viewers"`
+	CreatedAt      time.Time              `json:"createdAt"`
+	CreatedBy      string                 `json:"createdBy"`
+	ParentCode     string                 `json:"parentCode,omitempty"`
+	StartsAt       *time.Time             `json:"startsAt,omitempty"`
+	EndsAt         *time.Time             `json:"endsAt,omitempty"`
+	Settings       rdsModels.RoomSettings `json:"settings"`
+	Flags          rdsModels.RoomFlags    `json:"flags"`
+}
+
+// RoomUpdate lists the fields an owner can change, nil fields are left untouched
+type RoomUpdate struct {
+	Title              *string `json:"title"`
+	Capacity           *int    `json:"capacity"`
+	ViewerCapacity     *int    `json:"viewerCapacity"`
+	Locked             *bool   `json:"locked"`
+	SinglePresenter    *bool   `json:"singlePresenter"`
+	AutoGrantPresenter *bool   `json:"autoGrantPresenter"`
+	WaitingRoom        *bool   `json:"waitingRoom"`
+}
+
+// changes lists the fields the update sets for the audit log
+func (u *RoomUpdate) changes() map[string]interface{} {
+	changes := make(map[string]interface{})
+	if u.Title != nil {
+		changes["title"] = *u.Title
+	}
+	if u.Capacity != nil {
+		changes["capacity"] = *u.Capacity
+	}
+	if u.ViewerCapacity != nil {
+		changes["viewerCapacity"] = *u.ViewerCapacity
+	}
+	if u.Locked != nil {
+		changes["locked"] = *u.Locked
+	}
+	if u.SinglePresenter != nil {
+		changes["singlePresenter"] = *u.SinglePresenter
+	}
+	if u.AutoGrantPresenter != nil {
+		changes["autoGrantPresenter"] = *u.AutoGrantPresenter
+	}
+	if u.WaitingRoom != nil {
+		changes["waitingRoom"] = *u.WaitingRoom
+	}
+	return changes
+}
+
+const maxTitleLength = 100
+
+func (p *RoomPolicy) validateCapacity(capacity int, mode string) error {
+	maxCapacity := p.MaxCapacity
+	if mode == rdsModels.RoomModeSFU {
+		maxCapacity = p.MaxSFUCapacity
+	}
+	if capacity < 1 || capacity > maxCapacity {
+		return fmt.Errorf("%w: capacity must be between 1 and %d", ErrInvalidOptions, maxCapacity)
+	}
+	return nil
+}
+
+func (p *RoomPolicy) validateViewerCapacity(capacity int) error {
+	if capacity > 0 && p.MaxViewerCapacity == 0 {
+		return fmt.Errorf("%w: viewers are not enabled on this server", ErrInvalidOptions)
+	}
+	if capacity < 0 || capacity > p.MaxViewerCapacity {
+		return fmt.Errorf("%w: viewer capacity must be between 0 and %d", ErrInvalidOptions, p.MaxViewerCapacity)
+	}
+	return nil
+}
+
+func (p *RoomPolicy) validateMode(mode string) error {
+	switch mode {
+	case rdsModels.RoomModeMesh:
+		return nil
+	case rdsModels.RoomModeSFU:
+		if p.MaxSFUCapacity == 0 {
+			return ErrSFUDisabled
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: mode must be %q or %q", ErrInvalidOptions, rdsModels.RoomModeMesh, rdsModels.RoomModeSFU)
+	}
+}
+
+// validateSchedule checks the window of a scheduled room, a room without a duration isn't scheduled
+func (p *RoomPolicy) validateSchedule(opts *RoomOptions, now time.Time) error {
+	if opts.StartsAt == nil && opts.Duration == 0 {
+		return nil
+	}
+	if p.MaxDuration == 0 {
+		return fmt.Errorf("%w: scheduled rooms are not enabled on this server", ErrInvalidOptions)
+	}
+	if opts.Duration <= 0 || opts.Duration > p.MaxDuration {
+		return fmt.Errorf("%w: duration must be between 1s and %s", ErrInvalidOptions, p.MaxDuration)
+	}
+	if opts.StartsAt != nil && (opts.StartsAt.Before(now) || opts.StartsAt.After(now.Add(p.MaxScheduleAhead))) {
+		return fmt.Errorf("%w: startsAt must be in the next %s", ErrInvalidOptions, p.MaxScheduleAhead)
+	}
+	if opts.Persistent {
+		return fmt.Errorf("%w: scheduled rooms can't be persistent", ErrInvalidOptions)
+	}
+	return nil
+}
+
+func validateTitle(title string) error {
+	if len(title) > maxTitleLength {
+		return fmt.Errorf("%w: title must be at most %d characters", ErrInvalidOptions, maxTitleLength)
+	}
+	return nil
+}
+
+func GenerateRoomLogic(ctx context.Context, logger *log.Logger, manager connections.ConnManager, policy *RoomPolicy, opts RoomOptions) (*CreatedRoom, error) {
+	if opts.Persistent && opts.Owner == "" && opts.OwnerID == "" {
+		return nil, ErrOwnerRequired
+	}
+	if opts.Mode == "" {
+		opts.Mode = rdsModels.RoomModeMesh
+	}
+	if err := policy.validateMode(opts.Mode); err != nil {
+		return nil, err
+	}
+	if opts.Capacity == 0 {
+		opts.Capacity = policy.DefaultCapacity
+	}
+	if err := policy.validateCapacity(opts.Capacity, opts.Mode); err != nil {
+		return nil, err
+	}
+	if err := policy.validateViewerCapacity(opts.ViewerCapacity); err != nil {
+		return nil, err
+	}
+	if err := validateTitle(opts.Title); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if err := policy.validateSchedule(&opts, now); err != nil {
+		return nil, err
+	}
+
+	ownerToken, err := generateToken()
+	if err != nil {
+		logger.Printf("Failed to generate owner token: %v", err)
+		return nil, err
+	}
+
+	room := &rdsModels.Room{
+		Title:          opts.Title,
+		Capacity:       opts.Capacity,
+		ViewerCapacity: opts.ViewerCapacity,
+		CreatedAt:      now,
+		CreatedBy:      opts.Owner,
+		OwnerID:        opts.OwnerID,
+		OwnerTokenHash: hashToken(ownerToken),
+		Settings: rdsModels.RoomSettings{
+			Mode:               opts.Mode,
+			SinglePresenter:    opts.SinglePresenter,
+			AutoGrantPresenter: opts.AutoGrantPresenter,
+			WaitingRoom:        opts.WaitingRoom,
+		},
+		Flags: rdsModels.RoomFlags{
+			Persistent: opts.Persistent,
+		},
+	}
+	if opts.Duration > 0 {
+		opensAt := now
+		if opts.StartsAt != nil {
+			opensAt = opts.StartsAt.UTC()
+			room.StartsAt = &opensAt
+		}
+		endsAt := opensAt.Add(opts.Duration)
+		room.EndsAt = &endsAt
+	}
+	// CreateRoom only succeeds for codes that are not already active, so reservation is atomic
+	reserve := func(ctx context.Context, code string) (bool, error) {
+		room.Code = code
+		return manager.CreateRoom(ctx, room)
+	}
+
+	if opts.Code != "" {
+		roomCode := codegen.Normalize(opts.Code)
+		if err := codegen.Validate(roomCode); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidOptions, err)
+		}
+		created, err := reserve(ctx, roomCode)
 		if err != nil {
-			logger.Printf("Failed to check room code existence: %v", err)
-			return "", err
+			logger.Printf("Failed to reserve room code %s: %v", roomCode, err)
+			return nil, err
 		}
-		if !exists {
-			break
+		if !created {
+			return nil, ErrRoomCodeTaken
+		}
+	} else {
+		if _, err := policy.Codes.Reserve(ctx, reserve); err != nil {
+			logger.Printf("Failed to reserve room code: %v", err)
+			return nil, err
+		}
+	}
+
+	if room.EndsAt != nil {
+		if err := scheduleRoom(ctx, manager, policy, room); err != nil {
+			logger.Printf("Failed to schedule room %s: %v", room.Code, err)
+			manager.DeleteRoom(ctx, room.Code)
+			return nil, err
+		}
+	}
+
+	return &CreatedRoom{
+		Code:       room.Code,
+		OwnerToken: ownerToken,
+	}, nil
+}
+
+func GetRoomLogic(ctx context.Context, manager connections.ConnManager, roomCode string) (*RoomInfo, error) {
+	room, err := manager.GetRoom(ctx, roomCode)
+	if errors.Is(err, storage.ErrRoomNotFound) {
+		return nil, ErrRoomNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return getRoomInfo(ctx, manager, room)
+}
+
+// getRoomInfo adds the room's occupancy to the room
+func getRoomInfo(ctx context.Context, manager connections.ConnManager, room *rdsModels.Room) (*RoomInfo, error) {
+	occupancy, err := manager.GetRoomOccupancy(ctx, room.Code)
+	if err != nil {
+		return nil, err
+	}
+	viewers, err := manager.GetViewerCount(ctx, room.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RoomInfo{
+		Code:           room.Code,
+		Title:          room.Title,
+		Capacity:       room.Capacity,
+		Occupancy:      occupancy - viewers,
+		ViewerCapacity: room.ViewerCapacity,
+		Viewers:        viewers,
+		CreatedAt:      room.CreatedAt,
+		CreatedBy:      room.CreatedBy,
+		ParentCode:     room.ParentCode,
+		StartsAt:       room.StartsAt,
+		EndsAt:         room.EndsAt,
+		Settings:       room.Settings,
+		Flags:          room.Flags,
+	}, nil
+}
+
+// getOwnedRoom loads a room and checks that ownerToken belongs to its owner
+func getOwnedRoom(ctx context.Context, manager connections.ConnManager, roomCode string, ownerToken string) (*rdsModels.Room, error) {
+	room, err := manager.GetRoom(ctx, roomCode)
+	if errors.Is(err, storage.ErrRoomNotFound) {
+		return nil, ErrRoomNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !tokenMatches(ownerToken, room.OwnerTokenHash) {
+		return nil, ErrNotRoomOwner
+	}
+	return room, nil
+}
+
+// UpdateRoomLogic changes the settings of a room. ip is the owner's address, it is recorded in auditLog.
+func UpdateRoomLogic(ctx context.Context, logger *log.Logger, manager connections.ConnManager, policy *RoomPolicy, auditLog *audit.Log, roomCode string, ownerToken string, ip string, update RoomUpdate) error {
+	if _, err := getOwnedRoom(ctx, manager, roomCode, ownerToken); err != nil {
+		return err
+	}
+	if update.Title != nil {
+		if err := validateTitle(*update.Title); err != nil {
+			return err
+		}
+	}
+	if update.ViewerCapacity != nil {
+		if err := policy.validateViewerCapacity(*update.ViewerCapacity); err != nil {
+			return err
+		}
+	}
+
+	// the changes are applied to the latest room, so concurrent updates don't undo each other
+	var openedLobby bool
+	room, err := manager.UpdateRoom(ctx, roomCode, func(room *rdsModels.Room) error {
+		if update.Title != nil {
+			room.Title = *update.Title
+		}
+		if update.Capacity != nil {
+			if err := policy.validateCapacity(*update.Capacity, room.Settings.Mode); err != nil {
+				return err
+			}
+			room.Capacity = *update.Capacity
+		}
+		if update.ViewerCapacity != nil {
+			room.ViewerCapacity = *update.ViewerCapacity
+		}
+		if update.Locked != nil {
+			room.Settings.Locked = *update.Locked
+		}
+		if update.SinglePresenter != nil {
+			room.Settings.SinglePresenter = *update.SinglePresenter
+		}
+		if update.AutoGrantPresenter != nil {
+			room.Settings.AutoGrantPresenter = *update.AutoGrantPresenter
+		}
+		openedLobby = false
+		if update.WaitingRoom != nil {
+			openedLobby = room.Settings.WaitingRoom && !*update.WaitingRoom
+			room.Settings.WaitingRoom = *update.WaitingRoom
 		}
+		return nil
+	})
+	if errors.Is(err, storage.ErrRoomNotFound) {
+		return ErrRoomNotFound
+	}
+	if errors.Is(err, ErrInvalidOptions) {
+		return err
+	}
+	if err != nil {
+		logger.Printf("Failed to update room %s: %v", roomCode, err)
+		return err
+	}
+	auditLog.Record(ctx, &audit.Entry{
+		Action:   audit.ActionRoomUpdated,
+		RoomCode: roomCode,
+		Actor:    audit.ActorOwner,
+		IP:       ip,
+		Details:  update.changes(),
+	})
+
+	// members may already be waiting for a free slot
+	if room.Settings.AutoGrantPresenter {
+		advancePresenterQueue(ctx, logger, manager, roomCode)
+	}
+	// nobody has to wait once the waiting room is turned off
+	if openedLobby {
+		admitAllKnocks(ctx, logger, manager, roomCode)
+	}
+	return nil
+}
+
+// DeleteRoomLogic closes and deletes a room on behalf of its owner, along with its breakout rooms.
+// ip is the owner's address, it is recorded in auditLog.
+func DeleteRoomLogic(ctx context.Context, logger *log.Logger, manager connections.ConnManager, auditLog *audit.Log, roomCode string, ownerToken string, ip string) error {
+	room, err := getOwnedRoom(ctx, manager, roomCode, ownerToken)
+	if err != nil {
+		return err
 	}
 
-	err := manager.CreateRoom(ctx, roomCode)
+	breakouts, err := manager.GetBreakouts(ctx, roomCode)
 	if err != nil {
-		logger.Printf("Failed to set room code: %v", err)
-		return "", err
+		logger.Printf("Failed to get breakout rooms of room %s: %v", roomCode, err)
+		return err
+	}
+	for _, breakout := range breakouts {
+		manager.CloseRoom(ctx, logger, breakout, closeReasonDeleted)
+		if _, err := manager.DeleteRoom(ctx, breakout); err != nil {
+			logger.Printf("Failed to remove breakout room %s: %v", breakout, err)
+			return err
+		}
+	}
+
+	manager.CloseRoom(ctx, logger, roomCode, closeReasonDeleted)
+	if _, err := manager.DeleteRoom(ctx, roomCode); err != nil {
+		logger.Printf("Failed to remove room %s: %v", roomCode, err)
+		return err
+	}
+
+	if room.ParentCode != "" {
+		if err := manager.RemoveBreakout(ctx, room.ParentCode, roomCode); err != nil {
+			logger.Printf("Failed to unlink breakout room %s from room %s: %v", roomCode, room.ParentCode, err)
+		}
 	}
 
-	return roomCode, nil
+	logger.Printf("Room %s was deleted by its owner", roomCode)
+	auditLog.Record(ctx, &audit.Entry{
+		Action:   audit.ActionRoomDeleted,
+		RoomCode: roomCode,
+		Actor:    audit.ActorOwner,
+		IP:       ip,
+		Details:  map[string]interface{}{"breakouts": breakouts},
+	})
+	return nil
+}
+
+// MessageLimits bound what a single connection may send
+type MessageLimits struct {
+	// MaxMessageSize is the largest frame in bytes a client may send before it is disconnected
+	MaxMessageSize int64 `json:"maxMessageSize"`
+	// Rate limits inbound messages, messages over the limit are dropped with a warning
+	Rate ratelimit.Limit `json:"rate"`
+	// InputRate limits input-event messages instead of Rate, messages over it are dropped silently
+	InputRate ratelimit.Limit `json:"inputRate"`
+	// EphemeralRate limits reactions, hands and pointer pings instead of Rate, messages over it are dropped silently
+	EphemeralRate ratelimit.Limit `json:"ephemeralRate"`
+	// FileChunkRate limits file-chunk messages instead of Rate, chunks over it are dropped with a warning
+	FileChunkRate ratelimit.Limit `json:"fileChunkRate"`
+	// MaxViolations is how many dropped messages within violationWindow are tolerated before disconnecting
+	MaxViolations int `json:"maxViolations"`
+}
+
+// ConnectConfig holds what a connection needs beyond the room itself
+type ConnectConfig struct {
+	Limits MessageLimits
+	// SFU forwards media for rooms in SFU mode, nil when SFU mode is disabled
+	SFU *sfu.SFU
+	// Recorder records SFU rooms, nil when recording is disabled
+	Recorder *recorder.Recorder
+	Chat     ChatConfig
+	// Annotations bounds the shared annotation log of each room
+	Annotations AnnotationConfig
+	// Files relays file transfers, nil when file transfer is disabled
+	Files *files.Manager
+	// LobbyTimeout is how long members wait in the lobby of a waiting room before they are turned away
+	LobbyTimeout time.Duration
+	// KickBan is how long members removed by a host can't rejoin the room
+	KickBan time.Duration
+	// Codes generates the codes of breakout rooms, nil when breakout rooms are disabled
+	Codes *codegen.Policy
+	// Audit records joins, leaves and moderation actions, nil when the audit log is disabled
+	Audit *audit.Log
+}
+
+// violationWindow is how long a rate limit violation counts towards MaxViolations
+const violationWindow = time.Minute
+
+type readResult struct {
+	message map[string]interface{}
+	err     error
+}
+
+// readMessages reads a connection's messages in the background until reading fails, the failure
+// being the last result, or stop is called. Having a single reader lets the lobby and the session
+// take turns handling the messages.
+func readMessages(conn *websocket.Conn) (results <-chan readResult, stop func()) {
+	out := make(chan readResult)
+	done := make(chan struct{})
+	go func() {
+		for {
+			var message map[string]interface{}
+			err := conn.ReadJSON(&message)
+			select {
+			case out <- readResult{message: message, err: err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return out, func() { close(done) }
 }
 
-func ConnectToRoomLogic(ctx context.Context, logger *log.Logger, manager connections.ConnManager, roomCode string, name string, conn *websocket.Conn) (string, error) {
+// ConnectToRoomLogic runs a member's connection to a room until it closes, member comes from
+// ResolveMemberLogic. requestedRole is rdsModels.RoleViewer to join as a viewer and empty or
+// rdsModels.RoleParticipant otherwise. joinToken is the token of a breakout-join message, it is
+// optional. ip is the member's address.
+func ConnectToRoomLogic(ctx context.Context, logger *log.Logger, manager connections.ConnManager, cfg *ConnectConfig, roomCode string, member *Member, ownerToken string, requestedRole string, joinToken string, ip string, conn *websocket.Conn) (string, error) {
+	// members are known by their key from here on
+	name := member.ID
 	var errMsg string
-	if err := manager.CanUserJoinRoom(ctx, roomCode, name); err != nil {
+	role := rdsModels.RoleParticipant
+	switch requestedRole {
+	case "", rdsModels.RoleParticipant:
+	case rdsModels.RoleViewer:
+		role = rdsModels.RoleViewer
+	default:
+		errMsg = fmt.Sprintf("role must be %q or %q", rdsModels.RoleParticipant, rdsModels.RoleViewer)
+		return errMsg, fmt.Errorf("unknown role %q", requestedRole)
+	}
+
+	// members moved by a host were already let in, their pass gets them past the lock, the
+	// capacity and the waiting room
+	moved := false
+	if joinToken != "" {
+		var err error
+		moved, err = manager.ConsumeJoinPass(ctx, roomCode, name, hashToken(joinToken))
+		if err != nil {
+			errMsg = "Internal Server Error"
+			err = fmt.Errorf("Failed to check join pass: %w", err)
+			return errMsg, err
+		}
+	}
+
+	if err := manager.CanUserJoinRoom(ctx, roomCode, name, role, moved); err != nil {
 		errMsg = "user cannot join room at this time"
+		if errors.Is(err, storage.ErrRoomNotStarted) || errors.Is(err, storage.ErrRoomEnded) || errors.Is(err, storage.ErrBanned) {
+			errMsg = err.Error()
+		}
 		err = fmt.Errorf("user cannot join room: %w", err)
 		return errMsg, err
 	}
 
+	room, err := manager.GetRoom(ctx, roomCode)
+	if err != nil {
+		errMsg = "Internal Server Error"
+		err = fmt.Errorf("Failed to get room: %w", err)
+		return errMsg, err
+	}
+
+	// participants who present the owner token or created the room signed in join as hosts, viewers stay viewers
+	isOwner := tokenMatches(ownerToken, room.OwnerTokenHash) || (member.UserID != "" && member.UserID == room.OwnerID)
+	if role == rdsModels.RoleParticipant && isOwner {
+		role = rdsModels.RoleHost
+	}
+
 	// checks have passed, adding connection to room
 	connDetails := manager.SetConnection(conn)
+	connDetails.Role = role
+	connDetails.UserID = member.UserID
+	connDetails.DisplayName = member.DisplayName
+	connDetails.AvatarURL = member.AvatarURL
+	conn.SetReadLimit(cfg.Limits.MaxMessageSize)
+	messages, stopReading := readMessages(conn)
+	defer stopReading()
+
+	// in waiting rooms everyone but the hosts joins once a host admits them
+	if room.Settings.WaitingRoom && role != rdsModels.RoleHost && !moved {
+		admitted, err := waitInLobby(ctx, logger, manager, cfg, roomCode, name, connDetails, messages)
+		if err == nil && admitted {
+			// the room may have filled up or someone with the same name joined while they waited
+			err = manager.CanUserJoinRoom(ctx, roomCode, name, role, false)
+		}
+		if err != nil || !admitted {
+			manager.RemoveConnection(connDetails.ConnectionID)
+		}
+		if err != nil {
+			errMsg = "user cannot join room at this time"
+			err = fmt.Errorf("user cannot join room: %w", err)
+			return errMsg, err
+		}
+		if !admitted {
+			return "", nil
+		}
+	}
+
+	// the member token proves membership to the room's HTTP endpoints
+	memberToken, err := generateToken()
+	if err != nil {
+		errMsg = "Internal Server Error"
+		err = fmt.Errorf("Failed to generate member token: %w", err)
+		return errMsg, err
+	}
+	connDetails.TokenHash = hashToken(memberToken)
 
 	marshalledConnDetails, err := json.Marshal(connDetails)
 	if err != nil {
@@ -51,40 +643,133 @@ func ConnectToRoomLogic(ctx context.Context, logger *log.Logger, manager connect
 		return errMsg, err
 	}
 
-	err = manager.AddUserToRoom(ctx, roomCode, name, string(marshalledConnDetails))
+	// the checks above are repeated in the same step as the member is added, others may have joined since
+	err = manager.AddUserToRoom(ctx, roomCode, name, role, string(marshalledConnDetails), moved)
 	if err != nil {
+		manager.RemoveConnection(connDetails.ConnectionID)
 		errMsg = "Failed to add connection to room"
+		if errors.Is(err, storage.ErrRoomFull) || errors.Is(err, storage.ErrMemberExists) {
+			errMsg = "user cannot join room at this time"
+		} else if errors.Is(err, storage.ErrBanned) {
+			errMsg = err.Error()
+		}
 		err = fmt.Errorf("Failed to add connection to room: %w", err)
 		return errMsg, err
 	}
 
-	logger.Printf("User %s has joined room %s", name, roomCode)
+	logger.Printf("User %s has joined room %s as %s", name, roomCode, role)
 	ctxWithoutCancel := context.WithoutCancel(ctx)
+
+	s := &session{
+		logger:      logger,
+		manager:     manager,
+		cfg:         cfg,
+		room:        room,
+		roomCode:    roomCode,
+		name:        name,
+		member:      member,
+		role:        role,
+		connID:      connDetails.ConnectionID,
+		memberToken: memberToken,
+		ip:          ip,
+	}
+	var details map[string]interface{}
+	if moved {
+		details = map[string]interface{}{"moved": true}
+	}
+	s.audit(ctx, audit.ActionMemberJoined, "", details)
+	if err := s.start(ctx); err != nil {
+		logger.Printf("Failed to start session for user %s in room %s: %v", name, roomCode, err)
+		manager.CloseConnection(s.connID, websocket.CloseInternalServerErr, "failed to start session")
+		go manager.RemoveConnectionFromRoom(ctxWithoutCancel, logger, roomCode, name)
+		s.audit(ctxWithoutCancel, audit.ActionMemberLeft, "", nil)
+		return "", nil
+	}
+	defer func() {
+		// what the member held is released right away, removing them may wait for the room to empty
+		s.stop(ctxWithoutCancel)
+		go manager.RemoveConnectionFromRoom(ctxWithoutCancel, logger, roomCode, name)
+	}()
+
+	limits := &cfg.Limits
+	bucket := ratelimit.NewBucket(limits.Rate)
+	inputBucket := ratelimit.NewBucket(limits.InputRate)
+	ephemeralBucket := ratelimit.NewBucket(limits.EphemeralRate)
+	chunkBucket := ratelimit.NewBucket(limits.FileChunkRate)
+	var violations int
+	var lastViolation time.Time
 	for {
-		var message map[string]interface{}
-		err := conn.ReadJSON(&message)
+		result := <-messages
+		message, err := result.message, result.err
 		if err != nil {
-			// Handle normal WebSocket closure without logging an error
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+			if errors.Is(err, websocket.ErrReadLimit) {
+				// gorilla has already replied with a "message too big" close frame
+				metrics.WSOversizedFrames.Add(1)
+				logger.Printf("User %s in room %s sent a frame over %d bytes, disconnecting", name, roomCode, limits.MaxMessageSize)
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
 				logger.Printf("Unexpected WebSocket close error for user %s in room %s: %v", name, roomCode, err)
 			} else {
 				logger.Printf("WebSocket closed for user %s in room %s: %v", name, roomCode, err)
 			}
-
-			// Remove connection from room
-			go manager.RemoveConnectionFromRoom(ctxWithoutCancel, logger, roomCode, name)
 			break
 		}
 
-		faultyReceiverName, err := manager.BroadcastToRoom(ctx, logger, roomCode, name, message)
-		if err != nil {
-			logger.Printf("Failed to send message to room %s: %v", roomCode, err)
-			if faultyReceiverName != "" {
-				go manager.RemoveConnectionFromRoom(ctxWithoutCancel, logger, roomCode, name) // Remove faulty connection
+		now := time.Now()
+		// remote control input, ephemeral events and file chunks come in bursts, so they have budgets of their own
+		var ownBucket *ratelimit.Bucket
+		var dropped *expvar.Int
+		switch {
+		case message["type"] == messageInputEvent:
+			ownBucket, dropped = inputBucket, metrics.WSInputEventsRateLimited
+		case isEphemeral(message["type"]):
+			ownBucket, dropped = ephemeralBucket, metrics.WSEphemeralEventsRateLimited
+		case message["type"] == messageFileChunk:
+			ownBucket, dropped = chunkBucket, metrics.WSFileChunksRateLimited
+		}
+		if ownBucket != nil {
+			result := ownBucket.Take(now)
+			if result.Allowed {
+				s.handleMessage(ctx, message)
+				continue
+			}
+			dropped.Add(1)
+			// a dropped chunk has to be sent again, so its sender needs to know when
+			if message["type"] == messageFileChunk {
+				s.send(map[string]interface{}{
+					"type":       "rate-limited",
+					"error":      "file chunk rate limit exceeded, chunk was dropped",
+					"retryAfter": result.RetryAfter.Milliseconds(),
+					"id":         message["id"],
+					"seq":        message["seq"],
+				})
 			}
-		} else {
-			logger.Printf("Message from %s: %v", roomCode, message)
+			continue
 		}
+		if result := bucket.Take(now); !result.Allowed {
+			metrics.WSMessagesRateLimited.Add(1)
+			if now.Sub(lastViolation) > violationWindow {
+				violations = 0
+			}
+			violations++
+			lastViolation = now
+
+			if violations > limits.MaxViolations {
+				metrics.WSPolicyDisconnects.Add(1)
+				logger.Printf("User %s in room %s exceeded the message rate limit %d times, disconnecting", name, roomCode, violations)
+				manager.CloseConnection(s.connID, websocket.ClosePolicyViolation, "message rate limit exceeded")
+				break
+			}
+
+			logger.Printf("User %s in room %s exceeded the message rate limit, dropping message", name, roomCode)
+			s.send(map[string]interface{}{
+				"type":       "rate-limited",
+				"error":      "message rate limit exceeded, message was dropped",
+				"retryAfter": result.RetryAfter.Milliseconds(),
+			})
+			continue
+		}
+
+		s.handleMessage(ctx, message)
 	}
 	return "", nil
 }
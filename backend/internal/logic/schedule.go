@@ -0,0 +1,208 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/audit"
+	"github.com/AnishG-git/streamify/internal/connections"
+	"github.com/AnishG-git/streamify/internal/storage"
+	rdsModels "github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+const messageRoomEnding = "room-ending"
+
+// reasons sent with room-closed
+const (
+	closeReasonDeleted = "deleted"
+	closeReasonEnded   = "ended"
+)
+
+// codes sent with the error that ends a connection, for errors clients may want to handle
+const (
+	ErrorCodeRoomNotStarted = "room-not-started"
+	ErrorCodeRoomEnded      = "room-ended"
+	ErrorCodeBanned         = "banned"
+)
+
+const (
+	// maxClaimedEvents bounds how many events one poll of the schedule fires
+	maxClaimedEvents = 100
+	// roomEventLease is how long a claimed event is hidden from the other instances. End events
+	// are claimed again after it until their room is deleted.
+	roomEventLease = 30 * time.Second
+)
+
+// ConnectErrorCode returns the code of an error returned by ConnectToRoomLogic, empty if it has none
+func ConnectErrorCode(err error) string {
+	switch {
+	case errors.Is(err, storage.ErrRoomNotStarted):
+		return ErrorCodeRoomNotStarted
+	case errors.Is(err, storage.ErrRoomEnded):
+		return ErrorCodeRoomEnded
+	case errors.Is(err, storage.ErrBanned):
+		return ErrorCodeBanned
+	default:
+		return ""
+	}
+}
+
+// scheduleRoom queues the end of a scheduled room and the warning before it
+func scheduleRoom(ctx context.Context, manager connections.ConnManager, policy *RoomPolicy, room *rdsModels.Room) error {
+	warnAt := room.EndsAt.Add(-policy.EndWarning)
+	if policy.EndWarning > 0 && warnAt.After(time.Now()) {
+		err := manager.ScheduleRoomEvent(ctx, &rdsModels.RoomEvent{
+			Kind:     rdsModels.RoomEventEndWarning,
+			RoomCode: room.Code,
+			At:       warnAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return manager.ScheduleRoomEvent(ctx, &rdsModels.RoomEvent{
+		Kind:     rdsModels.RoomEventEnd,
+		RoomCode: room.Code,
+		At:       *room.EndsAt,
+	})
+}
+
+// RunScheduler fires the events of scheduled rooms until ctx is done. Every instance runs one and
+// polls the shared schedule each interval. Claiming an event leases it, so it fires on a single
+// instance, which publishes it for every instance to tell the members connected to it and records
+// the rooms that end in auditLog. Warnings are removed from the schedule once published, ends once
+// their room is deleted, so an end whose instance crashed or whose room still had members fires
+// again after the lease. Since published events can be missed, each instance also closes the rooms
+// it holds connections to once they have ended.
+func RunScheduler(ctx context.Context, logger *log.Logger, manager connections.ConnManager, auditLog *audit.Log, interval time.Duration) error {
+	events, err := manager.SubscribeRoomEvents(ctx)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			fireRoomEvents(ctx, logger, manager, auditLog, now)
+			closeEndedRooms(ctx, logger, manager, now)
+		case event, ok := <-events:
+			if !ok {
+				return errors.New("room event subscription closed")
+			}
+			handleRoomEvent(ctx, logger, manager, event)
+		}
+	}
+}
+
+// fireRoomEvents claims the events that are due and publishes them
+func fireRoomEvents(ctx context.Context, logger *log.Logger, manager connections.ConnManager, auditLog *audit.Log, now time.Time) {
+	events, err := manager.ClaimRoomEvents(ctx, now, roomEventLease, maxClaimedEvents)
+	if err != nil {
+		logger.Printf("Failed to claim room events: %v", err)
+		return
+	}
+	for _, event := range events {
+		logger.Printf("Firing %s event of room %s", event.Kind, event.RoomCode)
+		if err := manager.PublishRoomEvent(ctx, event); err != nil {
+			logger.Printf("Failed to publish %s event of room %s: %v", event.Kind, event.RoomCode, err)
+			continue
+		}
+		switch event.Kind {
+		case rdsModels.RoomEventEndWarning:
+			if err := manager.CompleteRoomEvent(ctx, event); err != nil {
+				logger.Printf("Failed to complete %s event of room %s: %v", event.Kind, event.RoomCode, err)
+			}
+		case rdsModels.RoomEventEnd:
+			// deleting the room removes the event, it is claimed again if the room is still there.
+			// Only the first claim is at the room's end, the others are at the end of a lease.
+			room, err := manager.GetRoom(ctx, event.RoomCode)
+			if err == nil && room.EndsAt != nil && room.EndsAt.UnixMilli() == event.At.UnixMilli() {
+				auditLog.Record(ctx, &audit.Entry{
+					Action:   audit.ActionRoomEnded,
+					RoomCode: event.RoomCode,
+				})
+			}
+			deleteEndedRoom(ctx, logger, manager, event.RoomCode)
+		}
+	}
+}
+
+// handleRoomEvent tells the members connected to this instance about a fired event
+func handleRoomEvent(ctx context.Context, logger *log.Logger, manager connections.ConnManager, event *rdsModels.RoomEvent) {
+	breakouts, err := manager.GetBreakouts(ctx, event.RoomCode)
+	if err != nil {
+		logger.Printf("Failed to get breakout rooms of room %s: %v", event.RoomCode, err)
+	}
+	rooms := append([]string{event.RoomCode}, breakouts...)
+
+	switch event.Kind {
+	case rdsModels.RoomEventEndWarning:
+		room, err := manager.GetRoom(ctx, event.RoomCode)
+		if err != nil || room.EndsAt == nil {
+			return
+		}
+		for _, roomCode := range rooms {
+			manager.NotifyRoom(ctx, logger, roomCode, map[string]interface{}{
+				"type":   messageRoomEnding,
+				"endsAt": room.EndsAt,
+			})
+		}
+	case rdsModels.RoomEventEnd:
+		for _, roomCode := range rooms {
+			manager.CloseRoom(ctx, logger, roomCode, closeReasonEnded)
+		}
+	}
+}
+
+// closeEndedRooms closes the connections this instance holds to rooms that have ended, in case
+// it missed their end event. Breakout rooms end with their main room.
+func closeEndedRooms(ctx context.Context, logger *log.Logger, manager connections.ConnManager, now time.Time) {
+	for _, roomCode := range manager.LocalRooms() {
+		room, err := manager.GetRoom(ctx, roomCode)
+		if err != nil {
+			continue
+		}
+		if room.ParentCode != "" {
+			room, err = manager.GetRoom(ctx, room.ParentCode)
+			if err != nil {
+				continue
+			}
+		}
+		if room.EndsAt != nil && !now.Before(*room.EndsAt) {
+			logger.Printf("Closing room %s, which has ended", roomCode)
+			manager.CloseRoom(ctx, logger, roomCode, closeReasonEnded)
+		}
+	}
+}
+
+// deleteEndedRoom deletes an ended room and its breakout rooms if nobody is in them. Rooms with
+// members are deleted once the members' connections, which every instance closes, have dropped.
+func deleteEndedRoom(ctx context.Context, logger *log.Logger, manager connections.ConnManager, roomCode string) {
+	breakouts, err := manager.GetBreakouts(ctx, roomCode)
+	if err != nil {
+		logger.Printf("Failed to get breakout rooms of room %s: %v", roomCode, err)
+		return
+	}
+
+	// the room keeps the list of breakout rooms the other instances close until they are empty
+	occupied := false
+	for _, code := range append(breakouts, roomCode) {
+		occupancy, err := manager.GetRoomOccupancy(ctx, code)
+		if err != nil || occupancy > 0 {
+			occupied = true
+			continue
+		}
+		if code == roomCode && occupied {
+			continue
+		}
+		if _, err := manager.DeleteRoom(ctx, code); err != nil {
+			logger.Printf("Failed to remove room %s: %v", code, err)
+		}
+	}
+}
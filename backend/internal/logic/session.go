@@ -0,0 +1,223 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/AnishG-git/streamify/internal/audit"
+	"github.com/AnishG-git/streamify/internal/connections"
+	"github.com/AnishG-git/streamify/internal/sfu"
+	rdsModels "github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+// session is a single member's connection to a room, from joining until the socket closes
+type session struct {
+	logger   *log.Logger
+	manager  connections.ConnManager
+	cfg      *ConnectConfig
+	room     *rdsModels.Room
+	roomCode string
+	// name is the member's key in the room, member.ID
+	name   string
+	member *Member
+	role   string
+	connID string
+	// memberToken is handed to the member when they join, only its hash is stored
+	memberToken string
+	// ip is the address the member connected from, it is recorded in the audit log
+	ip string
+	// media is what the member is publishing, only this session changes it
+	media rdsModels.MediaState
+}
+
+// start runs once the member has been added to the room
+func (s *session) start(ctx context.Context) error {
+	if s.isSFU() {
+		if err := s.cfg.SFU.Join(s.roomCode, s.connID, s.name, s.isViewer(), s.send); err != nil {
+			return err
+		}
+		s.syncViewerTracks(ctx)
+	}
+	s.send(map[string]interface{}{
+		"type":        messageJoined,
+		"name":        s.name,
+		"role":        s.role,
+		"memberToken": s.memberToken,
+	})
+	s.sendRoomState(ctx)
+	s.sendChatHistory(ctx)
+	s.sendAnnotations(ctx, 0)
+	s.sendKnocks(ctx)
+	s.sendBreakouts(ctx)
+	s.broadcast(ctx, map[string]interface{}{
+		"type":    messageMemberJoined,
+		"name":    s.name,
+		"role":    s.role,
+		"profile": s.profile(),
+	}, s.presenceRoles()...)
+	return nil
+}
+
+// stop runs once the member's socket has closed, before they are removed from the room
+func (s *session) stop(ctx context.Context) {
+	if s.isSFU() {
+		s.cfg.SFU.Leave(s.roomCode, s.connID)
+	}
+	s.clearMediaState(ctx)
+	s.leavePresenterQueue(ctx)
+	s.dropControl(ctx)
+	s.cancelMemberFiles(ctx)
+	s.audit(ctx, audit.ActionMemberLeft, "", nil)
+	// the member is still stored, so they are left out as the sender
+	s.broadcastFrom(ctx, s.name, map[string]interface{}{
+		"type": messageMemberLeft,
+		"name": s.name,
+		"role": s.role,
+	}, s.presenceRoles()...)
+}
+
+// profile is how the member is shown to the rest of the room
+func (s *session) profile() *MemberProfile {
+	return &MemberProfile{
+		UserID:      s.member.UserID,
+		DisplayName: s.member.DisplayName,
+		AvatarURL:   s.member.AvatarURL,
+		Role:        s.role,
+	}
+}
+
+func (s *session) isSFU() bool {
+	return s.room.Settings.Mode == rdsModels.RoomModeSFU && s.cfg.SFU != nil
+}
+
+func (s *session) isHost() bool {
+	return s.role == rdsModels.RoleHost
+}
+
+func (s *session) send(message map[string]interface{}) error {
+	return s.manager.SendToConnection(s.connID, message)
+}
+
+// sendError reports a problem with a single message, unlike "error" it doesn't end the session
+func (s *session) sendError(message string) {
+	s.logger.Printf("Rejected message from %s in room %s: %s", s.name, s.roomCode, message)
+	s.send(map[string]interface{}{
+		"type":  "message-error",
+		"error": message,
+	})
+}
+
+// handleMessage routes messages addressed to the server and relays everything else to the room
+func (s *session) handleMessage(ctx context.Context, message map[string]interface{}) {
+	if s.rejectViewerMessage(message) {
+		return
+	}
+	switch message["type"] {
+	case sfu.MessageAnswer, sfu.MessageCandidate, sfu.MessagePublishOffer, sfu.MessagePublishCandidate, sfu.MessageSelectLayer:
+		if !s.isSFU() {
+			s.sendError("room is not in SFU mode")
+			return
+		}
+		if err := s.cfg.SFU.HandleMessage(s.roomCode, s.connID, message); err != nil {
+			s.sendError("invalid SFU signaling message")
+			s.logger.Printf("Failed to handle SFU message from %s in room %s: %v", s.name, s.roomCode, err)
+		}
+	case messageScreenShareStart, messageScreenShareStop, messageMediaState:
+		s.handleMediaState(ctx, message)
+	case messageRequestPresent:
+		s.requestPresent(ctx)
+	case messageCancelPresent:
+		s.cancelPresent(ctx)
+	case messageGrantPresent:
+		s.grantPresent(ctx, message)
+	case messageDenyPresent:
+		s.denyPresent(ctx, message)
+	case messageReleasePresent:
+		s.releasePresent(ctx, message)
+	case messageControlRequest:
+		s.requestControl(ctx, message)
+	case messageControlGrant:
+		s.grantControl(ctx, message)
+	case messageControlDeny:
+		s.denyControl(ctx, message)
+	case messageControlRevoke:
+		s.revokeControl(ctx)
+	case messageInputEvent:
+		s.relayInputEvent(ctx, message)
+	case messageChat:
+		s.handleChat(ctx, message)
+	case messageReaction:
+		s.sendReaction(ctx, message)
+	case messagePointerPing:
+		s.sendPointerPing(ctx, message)
+	case messageRaiseHand:
+		s.setHand(ctx, true)
+	case messageLowerHand:
+		s.setHand(ctx, false)
+	case messageAnnotation:
+		s.addAnnotation(ctx, message)
+	case messageAnnotationClear:
+		s.clearAnnotations(ctx)
+	case messageAnnotationSync:
+		s.syncAnnotations(ctx, message)
+	case messageKnockAdmit:
+		s.decideKnock(ctx, message, true)
+	case messageKnockDeny:
+		s.decideKnock(ctx, message, false)
+	case messageKick:
+		s.kickMember(ctx, message)
+	case messageBreakoutOpen:
+		s.openBreakouts(ctx, message)
+	case messageBreakoutMove:
+		s.moveBreakoutMember(ctx, message)
+	case messageBreakoutRecall:
+		s.recallBreakouts(ctx)
+	case messageFileOffer, messageFileAccept, messageFileChunk, messageFileComplete, messageFileCancel:
+		s.handleFileMessage(ctx, message)
+	case messageRecordingStart:
+		s.startRecording(ctx)
+	case messageRecordingStop:
+		s.stopRecording(ctx)
+	default:
+		s.relay(ctx, message)
+	}
+}
+
+// decodeMessage converts a generic JSON message into a typed value
+func decodeMessage(message map[string]interface{}, v interface{}) error {
+	marshalled, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(marshalled, v)
+}
+
+// broadcast relays a message to every other member of the room, only to those with one of roles if any are given
+func (s *session) broadcast(ctx context.Context, message map[string]interface{}, roles ...string) {
+	s.broadcastFrom(ctx, s.name, message, roles...)
+}
+
+// announce sends a server event to every member of the room, the sender included
+func (s *session) announce(ctx context.Context, message map[string]interface{}) {
+	s.broadcastFrom(ctx, "", message)
+}
+
+func (s *session) broadcastFrom(ctx context.Context, senderName string, message map[string]interface{}, roles ...string) {
+	broadcastToRoom(ctx, s.logger, s.manager, s.roomCode, senderName, message, roles...)
+}
+
+// broadcastToRoom sends a message to every member but senderName, which is empty for server events.
+// Only members with one of roles receive it if any are given.
+func broadcastToRoom(ctx context.Context, logger *log.Logger, manager connections.ConnManager, roomCode string, senderName string, message map[string]interface{}, roles ...string) {
+	faultyReceiverNames, err := manager.BroadcastToRoom(ctx, logger, roomCode, senderName, message, roles...)
+	if err != nil {
+		logger.Printf("Failed to send message to room %s: %v", roomCode, err)
+		for _, name := range faultyReceiverNames {
+			go manager.RemoveConnectionFromRoom(context.WithoutCancel(ctx), logger, roomCode, name) // Remove faulty connection
+		}
+	} else {
+		// only the type, bodies carry chat text and download tokens
+		logger.Printf("Broadcast %v to room %s", message["type"], roomCode)
+	}
+}
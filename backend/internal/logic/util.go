@@ -1,22 +1,32 @@
 package logic
 
 import (
-	"strings"
-	"time"
-
-	"golang.org/x/exp/rand"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 )
 
-func generateRoomCode() string {
-	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	const length = 5
-	var sb strings.Builder
-	sb.Grow(length)
-	rand.Seed(uint64(time.Now().UnixNano()))
-	for i := 0; i < length; i++ {
-		sb.WriteByte(charset[rand.Intn(len(charset))])
+// generateToken returns a random 256 bit token encoded as hex
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// tokenMatches compares a presented token against a stored hash in constant time
+func tokenMatches(token string, tokenHash string) bool {
+	if token == "" || tokenHash == "" {
+		return false
 	}
-	return sb.String()
+	return subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(tokenHash)) == 1
 }
 
 // func removeConnectionFromRoom(ctx context.Context, roomCode string, name string) {
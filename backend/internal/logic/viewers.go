@@ -0,0 +1,101 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+
+	rdsModels "github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+// memberRoles are the roles that take part in the room rather than watch it
+var memberRoles = []string{rdsModels.RoleHost, rdsModels.RoleParticipant}
+
+func (s *session) isViewer() bool {
+	return s.role == rdsModels.RoleViewer
+}
+
+// viewerCanSend reports whether viewers may send a message. Viewers watch the presenters,
+// so they can't publish, present, control, draw or offer files.
+func viewerCanSend(messageType interface{}) bool {
+	switch messageType {
+	case messageScreenShareStart, messageScreenShareStop, messageMediaState,
+		messageRequestPresent, messageCancelPresent, messageGrantPresent, messageDenyPresent, messageReleasePresent,
+		messageControlRequest, messageControlGrant, messageControlDeny, messageControlRevoke, messageInputEvent,
+		messagePointerPing, messageAnnotation, messageAnnotationClear,
+		messageFileOffer, messageFileChunk, messageFileComplete,
+		messageRecordingStart, messageRecordingStop:
+		return false
+	}
+	return true
+}
+
+// rejectViewerMessage tells a viewer a message is not allowed and reports whether it did
+func (s *session) rejectViewerMessage(message map[string]interface{}) bool {
+	if !s.isViewer() || viewerCanSend(message["type"]) {
+		return false
+	}
+	s.sendError(fmt.Sprintf("viewers cannot send %v messages", message["type"]))
+	return true
+}
+
+// relay passes a message the server doesn't handle on to the room. Only presenters reach
+// the viewers and viewers only reach the other members, so in mesh rooms viewers only
+// connect to the presenters.
+func (s *session) relay(ctx context.Context, message map[string]interface{}) {
+	if s.isViewer() {
+		s.broadcast(ctx, message, memberRoles...)
+		return
+	}
+
+	presenting := s.media.Screen
+	if !presenting {
+		presenter, err := s.manager.GetPresenter(ctx, s.roomCode)
+		if err != nil {
+			s.logger.Printf("Failed to get presenter of room %s: %v", s.roomCode, err)
+		}
+		presenting = presenter == s.name
+	}
+	if presenting {
+		s.broadcast(ctx, message)
+		return
+	}
+	s.broadcast(ctx, message, memberRoles...)
+}
+
+// presenceRoles are the roles told when the member joins or leaves. Viewers come and go
+// in large numbers, so only the other members hear about them.
+func (s *session) presenceRoles() []string {
+	if s.isViewer() {
+		return memberRoles
+	}
+	return nil
+}
+
+// syncViewerTracks tells the SFU whose tracks the viewers of an SFU room receive,
+// the holder of the presenter slot and everyone sharing their screen
+func (s *session) syncViewerTracks(ctx context.Context) {
+	if !s.isSFU() {
+		return
+	}
+	presenter, err := s.manager.GetPresenter(ctx, s.roomCode)
+	if err != nil {
+		s.logger.Printf("Failed to get presenter of room %s: %v", s.roomCode, err)
+		return
+	}
+	states, err := s.manager.GetMediaStates(ctx, s.roomCode)
+	if err != nil {
+		s.logger.Printf("Failed to get media states of room %s: %v", s.roomCode, err)
+		return
+	}
+
+	var presenters []string
+	if presenter != "" {
+		presenters = append(presenters, presenter)
+	}
+	for name, state := range states {
+		if state.Screen && name != presenter {
+			presenters = append(presenters, name)
+		}
+	}
+	s.cfg.SFU.SetPresenters(s.roomCode, presenters)
+}
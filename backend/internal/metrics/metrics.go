@@ -0,0 +1,29 @@
+// Package metrics exposes server counters through expvar at /debug/vars
+package metrics
+
+import "expvar"
+
+var (
+	// HTTPRateLimited counts requests rejected with 429, keyed by rate limit rule
+	HTTPRateLimited = expvar.NewMap("http_rate_limited")
+
+	// WSMessagesRateLimited counts inbound WebSocket messages dropped by the per-connection rate limit
+	WSMessagesRateLimited = expvar.NewInt("ws_messages_rate_limited")
+	// WSInputEventsRateLimited counts input-event messages dropped by their own rate limit
+	WSInputEventsRateLimited = expvar.NewInt("ws_input_events_rate_limited")
+	// WSEphemeralEventsRateLimited counts reactions, hands and pointer pings dropped by their own rate limit
+	WSEphemeralEventsRateLimited = expvar.NewInt("ws_ephemeral_events_rate_limited")
+	// WSFileChunksRateLimited counts file-chunk messages dropped by their own rate limit
+	WSFileChunksRateLimited = expvar.NewInt("ws_file_chunks_rate_limited")
+	// WSOversizedFrames counts connections closed for sending a frame over the read limit
+	WSOversizedFrames = expvar.NewInt("ws_oversized_frames")
+	// WSPolicyDisconnects counts connections closed after repeated rate limit violations
+	WSPolicyDisconnects = expvar.NewInt("ws_policy_disconnects")
+)
+
+// PublishLimits exposes the configured limits so they can be read next to the counters
+func PublishLimits(name string, limits interface{}) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return limits
+	}))
+}
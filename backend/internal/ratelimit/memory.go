@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle buckets are dropped from memory
+const sweepInterval = time.Minute
+
+// Memory keeps buckets in process memory, limits are not shared between instances
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*Bucket
+	lastSweep time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		buckets:   make(map[string]*Bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *Memory) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) > sweepInterval {
+		m.sweep(now)
+	}
+
+	bucket, ok := m.buckets[key]
+	if !ok {
+		bucket = NewBucket(limit)
+		m.buckets[key] = bucket
+	}
+	return bucket.Take(now), nil
+}
+
+// sweep drops buckets that have refilled completely, they are equivalent to new buckets
+func (m *Memory) sweep(now time.Time) {
+	for key, bucket := range m.buckets {
+		if bucket.full(now) {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
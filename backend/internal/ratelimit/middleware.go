@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/AnishG-git/streamify/internal/metrics"
+)
+
+// KeyFunc extracts what a request is limited by, an empty key skips the rule
+type KeyFunc func(r *http.Request) string
+
+// Rule limits requests sharing the same key. Name namespaces the buckets so
+// different routes and key types never share a bucket.
+type Rule struct {
+	Name  string
+	Limit Limit
+	Key   KeyFunc
+}
+
+// Middleware rejects requests with 429 Too Many Requests once any rule runs out of tokens.
+// If the limiter itself fails the request is let through so an outage doesn't take the API down.
+func Middleware(limiter Limiter, logger *log.Logger, rules ...Rule) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, rule := range rules {
+				key := rule.Key(r)
+				if key == "" {
+					continue
+				}
+
+				result, err := limiter.Allow(r.Context(), rule.Name+":"+key, rule.Limit)
+				if err != nil {
+					logger.Printf("Rate limiter failed for %s: %v", rule.Name, err)
+					continue
+				}
+				if !result.Allowed {
+					logger.Printf("Rate limit %s exceeded by %s", rule.Name, key)
+					metrics.HTTPRateLimited.Add(rule.Name, 1)
+					seconds := int(math.Ceil(result.RetryAfter.Seconds()))
+					if seconds < 1 {
+						seconds = 1
+					}
+					w.Header().Set("Retry-After", strconv.Itoa(seconds))
+					http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP keys requests by the caller's IP address. Behind trustedProxies proxies the address
+// is read from X-Forwarded-For, counting that many entries from the right. Every proxy appends
+// the address it received the request from, so entries further left were sent by the client and
+// could be anything.
+func ClientIP(trustedProxies int) KeyFunc {
+	return func(r *http.Request) string {
+		if trustedProxies > 0 {
+			var hops []string
+			for _, header := range r.Header.Values("X-Forwarded-For") {
+				for _, hop := range strings.Split(header, ",") {
+					if hop = strings.TrimSpace(hop); hop != "" {
+						hops = append(hops, hop)
+					}
+				}
+			}
+			if len(hops) > 0 {
+				// a shorter list than expected was written by the proxies alone
+				return hops[max(len(hops)-trustedProxies, 0)]
+			}
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+		return host
+	}
+}
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies int
+		forwarded      []string
+		want           string
+	}{
+		{name: "no proxy ignores the header", trustedProxies: 0, forwarded: []string{"203.0.113.7"}, want: "10.0.0.1"},
+		{name: "no header", trustedProxies: 1, want: "10.0.0.1"},
+		{name: "one proxy", trustedProxies: 1, forwarded: []string{"203.0.113.7"}, want: "203.0.113.7"},
+		{name: "spoofed entries before the proxy's", trustedProxies: 1, forwarded: []string{"1.2.3.4, 5.6.7.8, 203.0.113.7"}, want: "203.0.113.7"},
+		{name: "spoofed header line before the proxy's", trustedProxies: 1, forwarded: []string{"1.2.3.4", "203.0.113.7"}, want: "203.0.113.7"},
+		{name: "two proxies", trustedProxies: 2, forwarded: []string{"1.2.3.4, 203.0.113.7, 198.51.100.2"}, want: "203.0.113.7"},
+		{name: "fewer entries than proxies", trustedProxies: 3, forwarded: []string{"203.0.113.7, 198.51.100.2"}, want: "203.0.113.7"},
+		{name: "empty entries", trustedProxies: 1, forwarded: []string{"1.2.3.4, 203.0.113.7, "}, want: "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/room/generate", nil)
+			r.RemoteAddr = "10.0.0.1:51234"
+			for _, forwarded := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", forwarded)
+			}
+			if got := ClientIP(tt.trustedProxies)(r); got != tt.want {
+				t.Fatalf("ClientIP(%d) = %q, want %q", tt.trustedProxies, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareSpoofedForwardedFor(t *testing.T) {
+	handler := Middleware(NewMemory(), log.New(io.Discard, "", 0),
+		Rule{Name: "generate:ip", Limit: PerMinute(1, 2), Key: ClientIP(1)},
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// the attacker rotates the first entry, the proxy appends the same real address every time
+	spoofed := []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"}
+	wantStatus := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}
+	for i, fake := range spoofed {
+		r := httptest.NewRequest(http.MethodGet, "/room/generate", nil)
+		r.RemoteAddr = "10.0.0.1:51234"
+		r.Header.Set("X-Forwarded-For", fake+", 203.0.113.7")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != wantStatus[i] {
+			t.Fatalf("request %d: status %d, want %d", i, w.Code, wantStatus[i])
+		}
+	}
+}
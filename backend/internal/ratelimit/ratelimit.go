@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit describes a token bucket refilled at Rate tokens per second holding at most Burst tokens
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// PerMinute builds a Limit allowing n requests per minute with the given burst
+func PerMinute(n int, burst int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: burst}
+}
+
+type Result struct {
+	Allowed bool
+	// RetryAfter is how long until a token is available again, only set when not allowed
+	RetryAfter time.Duration
+}
+
+type Limiter interface {
+	// Allow takes one token from the bucket identified by key under the given limit
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Bucket is a single token bucket. It is not safe for concurrent use.
+type Bucket struct {
+	limit  Limit
+	tokens float64
+	last   time.Time
+}
+
+func NewBucket(limit Limit) *Bucket {
+	return &Bucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   time.Now(),
+	}
+}
+
+// Take refills the bucket up to now and removes one token if available
+func (b *Bucket) Take(now time.Time) Result {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return Result{Allowed: true}
+	}
+	return Result{RetryAfter: retryAfter(1-b.tokens, b.limit.Rate)}
+}
+
+// full reports whether the bucket would be back at full capacity at now
+func (b *Bucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst)
+}
+
+func retryAfter(missing float64, rate float64) time.Duration {
+	if rate <= 0 {
+		return time.Hour
+	}
+	return time.Duration(missing / rate * float64(time.Second))
+}
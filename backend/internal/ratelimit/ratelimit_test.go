@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPerMinute(t *testing.T) {
+	limit := PerMinute(30, 5)
+	if limit.Rate != 0.5 || limit.Burst != 5 {
+		t.Fatalf("PerMinute(30, 5) = %+v, want rate 0.5 and burst 5", limit)
+	}
+}
+
+func TestBucketTake(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+
+	type take struct {
+		after          time.Duration
+		wantAllowed    bool
+		wantRetryAfter time.Duration
+	}
+	tests := []struct {
+		name  string
+		limit Limit
+		takes []take
+	}{
+		{
+			name:  "burst then denied",
+			limit: Limit{Rate: 1, Burst: 2},
+			takes: []take{
+				{wantAllowed: true},
+				{wantAllowed: true},
+				{wantRetryAfter: time.Second},
+			},
+		},
+		{
+			name:  "refills over time",
+			limit: Limit{Rate: 1, Burst: 1},
+			takes: []take{
+				{wantAllowed: true},
+				{after: 500 * time.Millisecond, wantRetryAfter: 500 * time.Millisecond},
+				{after: time.Second, wantAllowed: true},
+			},
+		},
+		{
+			name:  "refill is capped at the burst",
+			limit: Limit{Rate: 10, Burst: 2},
+			takes: []take{
+				{after: time.Hour, wantAllowed: true},
+				{wantAllowed: true},
+				{wantRetryAfter: 100 * time.Millisecond},
+			},
+		},
+		{
+			name:  "per minute",
+			limit: PerMinute(6, 1),
+			takes: []take{
+				{wantAllowed: true},
+				{wantRetryAfter: 10 * time.Second},
+				{after: 10 * time.Second, wantAllowed: true},
+			},
+		},
+		{
+			name:  "zero rate never refills",
+			limit: Limit{Rate: 0, Burst: 1},
+			takes: []take{
+				{wantAllowed: true},
+				{after: time.Hour, wantRetryAfter: time.Hour},
+			},
+		},
+		{
+			name:  "clock going back doesn't refill",
+			limit: Limit{Rate: 1, Burst: 1},
+			takes: []take{
+				{wantAllowed: true},
+				{after: -time.Minute, wantRetryAfter: time.Second},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := NewBucket(tt.limit)
+			bucket.last = start
+			now := start
+			for i, take := range tt.takes {
+				now = now.Add(take.after)
+				got := bucket.Take(now)
+				if got.Allowed != take.wantAllowed || got.RetryAfter != take.wantRetryAfter {
+					t.Fatalf("take %d: Take() = %+v, want allowed %v and retry after %v",
+						i, got, take.wantAllowed, take.wantRetryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryAllow(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemory()
+	limit := Limit{Rate: 0.001, Burst: 2}
+
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{key: "user-1", want: true},
+		{key: "user-1", want: true},
+		{key: "user-1", want: false},
+		// every key has its own bucket
+		{key: "user-2", want: true},
+	}
+	for i, tt := range tests {
+		result, err := memory.Allow(ctx, tt.key, limit)
+		if err != nil {
+			t.Fatalf("request %d: Allow() = %v", i, err)
+		}
+		if result.Allowed != tt.want {
+			t.Fatalf("request %d: Allow(%q) = %+v, want allowed %v", i, tt.key, result, tt.want)
+		}
+	}
+}
+
+func TestMemorySweep(t *testing.T) {
+	memory := NewMemory()
+	limit := Limit{Rate: 1, Burst: 1}
+	start := time.Unix(1700000000, 0)
+
+	full := NewBucket(limit)
+	full.last = start
+	used := NewBucket(limit)
+	used.last = start
+	used.Take(start)
+	memory.buckets["full"] = full
+	memory.buckets["used"] = used
+
+	memory.sweep(start)
+	if _, ok := memory.buckets["full"]; ok {
+		t.Error("full bucket wasn't swept")
+	}
+	if _, ok := memory.buckets["used"]; !ok {
+		t.Error("used bucket was swept before it refilled")
+	}
+}
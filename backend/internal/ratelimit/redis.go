@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript refills and takes from a bucket stored as a hash in a single round trip.
+// Redis' own clock is used so that every instance agrees on the time.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(state[1])
+local last = tonumber(state[2])
+if tokens == nil or last == nil then
+	tokens = burst
+	last = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - last) * rate)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+elseif rate > 0 then
+	retry = (1 - tokens) / rate
+else
+	retry = 3600
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(now))
+local ttl = 3600000
+if rate > 0 then
+	ttl = math.ceil(burst / rate * 1000) + 1000
+end
+redis.call('PEXPIRE', KEYS[1], ttl)
+
+return {allowed, tostring(retry)}
+`)
+
+// Redis keeps buckets in Redis so limits are shared by every instance
+type Redis struct {
+	cli       *redis.Client
+	keyPrefix string
+}
+
+func NewRedis(cli *redis.Client, keyPrefix string) *Redis {
+	return &Redis{
+		cli:       cli,
+		keyPrefix: keyPrefix,
+	}
+}
+
+func (r *Redis) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	reply, err := tokenBucketScript.Run(ctx, r.cli, []string{r.keyPrefix + "ratelimit:" + key}, limit.Rate, limit.Burst).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	allowed, _ := reply[0].(int64)
+	retryStr, _ := reply[1].(string)
+	retry, err := strconv.ParseFloat(retryStr, 64)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Allowed:    allowed == 1,
+		RetryAfter: time.Duration(retry * float64(time.Second)),
+	}, nil
+}
@@ -0,0 +1,370 @@
+// Package recorder writes the media published in SFU rooms to local disk.
+// A recording attaches to the room as an SFU sink, so it receives every
+// published track without holding a PeerConnection of its own. Each track is
+// written to its own file, VP8, VP9 and AV1 video to IVF and Opus audio to Ogg,
+// next to a JSON metadata file tagging the recording with its room code,
+// participants and timestamps. Files are laid out as <Dir>/<room code>/<recording id>*.
+package recorder
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/sfu"
+	"github.com/AnishG-git/streamify/internal/storage"
+	"github.com/AnishG-git/streamify/internal/storage/models"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media/ivfwriter"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+)
+
+var (
+	ErrAlreadyRecording = errors.New("room is already being recorded")
+	ErrNotRecording     = errors.New("room is not being recorded")
+)
+
+const (
+	// metadataExt is the extension of the file describing a recording
+	metadataExt = ".json"
+	// saveTimeout bounds saving a recording's metadata to the store
+	saveTimeout = 10 * time.Second
+)
+
+type Config struct {
+	// Dir is the directory recordings are written to, it is created if missing
+	Dir string
+	// Store keeps the metadata of every instance's recordings, only local files are listed without one
+	Store storage.RecordingStore
+}
+
+// Recording and Track are defined with the storage models so durable stores can keep them
+type (
+	Recording = models.Recording
+	Track     = models.RecordingTrack
+)
+
+type Recorder struct {
+	config Config
+	sfu    *sfu.SFU
+	logger *log.Logger
+
+	mu sync.Mutex
+	// active holds the recording in progress per room code
+	active map[string]*recording
+}
+
+func New(config Config, sfu *sfu.SFU, logger *log.Logger) (*Recorder, error) {
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	return &Recorder{
+		config: config,
+		sfu:    sfu,
+		logger: logger,
+		active: make(map[string]*recording),
+	}, nil
+}
+
+// Start begins recording every track published in a room. participants are the
+// members present when the recording starts, later publishers are added as they appear.
+func (r *Recorder) Start(roomCode, startedBy string, participants []string) (*Recording, error) {
+	dir, err := r.roomDir(roomCode)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.active[roomCode]; ok {
+		return nil, ErrAlreadyRecording
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	id, err := newID(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &recording{
+		recorder: r,
+		dir:      dir,
+		meta: Recording{
+			ID:           id,
+			RoomCode:     roomCode,
+			StartedBy:    startedBy,
+			StartedAt:    time.Now().UTC(),
+			Participants: []string{},
+			Tracks:       []Track{},
+		},
+	}
+	for _, name := range participants {
+		rec.addParticipant(name)
+	}
+	// written up front so the recording is listed even if the server dies before it stops
+	if err := rec.writeMetadata(); err != nil {
+		return nil, err
+	}
+	r.save(rec.meta)
+
+	// registered before the sink is added since the room may empty and close the sink right away
+	r.active[roomCode] = rec
+	if err := r.sfu.AddSink(roomCode, id, rec); err != nil {
+		delete(r.active, roomCode)
+		os.Remove(rec.metadataPath())
+		return nil, err
+	}
+	r.logger.Printf("Started recording %s in room %s", id, roomCode)
+
+	meta := rec.snapshot()
+	return &meta, nil
+}
+
+// Stop finishes the room's recording and returns its final metadata
+func (r *Recorder) Stop(roomCode string) (*Recording, error) {
+	r.mu.Lock()
+	rec, ok := r.active[roomCode]
+	r.mu.Unlock()
+	if !ok {
+		return nil, ErrNotRecording
+	}
+
+	// removing the sink closes the recording, which finalizes its files
+	r.sfu.RemoveSink(roomCode, rec.meta.ID)
+
+	meta := rec.snapshot()
+	return &meta, nil
+}
+
+// Active returns the room's recording in progress, if any
+func (r *Recorder) Active(roomCode string) (*Recording, bool) {
+	r.mu.Lock()
+	rec, ok := r.active[roomCode]
+	r.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	meta := rec.snapshot()
+	return &meta, true
+}
+
+// List returns the recordings of a room, oldest first
+func (r *Recorder) List(ctx context.Context, roomCode string) ([]Recording, error) {
+	if r.config.Store != nil {
+		return r.config.Store.ListRecordings(ctx, roomCode)
+	}
+	dir, err := r.roomDir(roomCode)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Recording{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	recordings := make([]Recording, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != metadataExt {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var meta Recording
+		if err := json.Unmarshal(data, &meta); err != nil {
+			r.logger.Printf("Skipping unreadable recording metadata %s: %v", entry.Name(), err)
+			continue
+		}
+		recordings = append(recordings, meta)
+	}
+
+	sort.Slice(recordings, func(i, j int) bool {
+		return recordings[i].StartedAt.Before(recordings[j].StartedAt)
+	})
+	return recordings, nil
+}
+
+// roomDir returns the directory holding a room's recordings
+func (r *Recorder) roomDir(roomCode string) (string, error) {
+	if roomCode == "" || strings.ContainsAny(roomCode, `/\.`) {
+		return "", fmt.Errorf("invalid room code %q", roomCode)
+	}
+	return filepath.Join(r.config.Dir, roomCode), nil
+}
+
+// save copies a recording's metadata to the store, the metadata file stays the source of truth
+func (r *Recorder) save(meta Recording) {
+	if r.config.Store == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+	defer cancel()
+	if err := r.config.Store.SaveRecording(ctx, &meta); err != nil {
+		r.logger.Printf("Failed to save metadata of recording %s: %v", meta.ID, err)
+	}
+}
+
+func (r *Recorder) finished(rec *recording) {
+	r.mu.Lock()
+	if r.active[rec.meta.RoomCode] == rec {
+		delete(r.active, rec.meta.RoomCode)
+	}
+	r.mu.Unlock()
+}
+
+// newID returns a sortable, unique recording ID such as 20240102-150405-1a2b3c4d
+func newID(now time.Time) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return now.UTC().Format("20060102-150405") + "-" + hex.EncodeToString(suffix), nil
+}
+
+// recording is an sfu.Sink writing a room's tracks to disk
+type recording struct {
+	recorder *Recorder
+	dir      string
+
+	mu   sync.Mutex
+	meta Recording
+}
+
+func (rec *recording) OpenTrack(info sfu.TrackInfo) sfu.TrackSink {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.meta.StoppedAt != nil {
+		return nil
+	}
+
+	index := len(rec.meta.Tracks)
+	writer, file, err := newWriter(rec.dir, fmt.Sprintf("%s-%d-%s", rec.meta.ID, index, info.Kind), info.Codec)
+	if err != nil {
+		rec.recorder.logger.Printf("Not recording %s track of %s in room %s: %v", info.Kind, info.PublisherName, rec.meta.RoomCode, err)
+		return nil
+	}
+
+	rec.addParticipant(info.PublisherName)
+	rec.meta.Tracks = append(rec.meta.Tracks, Track{
+		Participant: info.PublisherName,
+		Kind:        info.Kind.String(),
+		Codec:       info.Codec.MimeType,
+		File:        file,
+		StartedAt:   time.Now().UTC(),
+	})
+	return &trackWriter{writer: writer, recording: rec, index: index}
+}
+
+// Close finalizes the metadata once the sink is removed or the room empties
+func (rec *recording) Close() {
+	rec.mu.Lock()
+	now := time.Now().UTC()
+	rec.meta.StoppedAt = &now
+	err := rec.writeMetadata()
+	rec.mu.Unlock()
+
+	if err != nil {
+		rec.recorder.logger.Printf("Failed to write metadata for recording %s: %v", rec.meta.ID, err)
+	}
+	rec.recorder.save(rec.snapshot())
+	rec.recorder.finished(rec)
+	rec.recorder.logger.Printf("Stopped recording %s in room %s", rec.meta.ID, rec.meta.RoomCode)
+}
+
+// addParticipant must be called with rec.mu held unless the recording hasn't been shared yet
+func (rec *recording) addParticipant(name string) {
+	for _, participant := range rec.meta.Participants {
+		if participant == name {
+			return
+		}
+	}
+	rec.meta.Participants = append(rec.meta.Participants, name)
+}
+
+func (rec *recording) snapshot() Recording {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	meta := rec.meta
+	meta.Participants = append([]string(nil), rec.meta.Participants...)
+	meta.Tracks = append([]Track(nil), rec.meta.Tracks...)
+	return meta
+}
+
+func (rec *recording) metadataPath() string {
+	return filepath.Join(rec.dir, rec.meta.ID+metadataExt)
+}
+
+// writeMetadata must be called with rec.mu held unless the recording hasn't been shared yet
+func (rec *recording) writeMetadata() error {
+	data, err := json.MarshalIndent(rec.meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write then rename so List never reads a partial file
+	tmp := rec.metadataPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, rec.metadataPath())
+}
+
+type mediaWriter interface {
+	WriteRTP(packet *rtp.Packet) error
+	Close() error
+}
+
+// newWriter creates the file for a track and returns its writer and file name
+func newWriter(dir, baseName string, codec webrtc.RTPCodecParameters) (mediaWriter, string, error) {
+	switch strings.ToLower(codec.MimeType) {
+	case strings.ToLower(webrtc.MimeTypeVP8), strings.ToLower(webrtc.MimeTypeVP9), strings.ToLower(webrtc.MimeTypeAV1):
+		file := baseName + ".ivf"
+		writer, err := ivfwriter.New(filepath.Join(dir, file), ivfwriter.WithCodec(codec.MimeType))
+		return writer, file, err
+	case strings.ToLower(webrtc.MimeTypeOpus):
+		file := baseName + ".ogg"
+		writer, err := oggwriter.New(filepath.Join(dir, file), codec.ClockRate, codec.Channels)
+		return writer, file, err
+	default:
+		return nil, "", fmt.Errorf("unsupported codec %s", codec.MimeType)
+	}
+}
+
+// trackWriter is the sfu.TrackSink for a single track of a recording
+type trackWriter struct {
+	writer    mediaWriter
+	recording *recording
+	index     int
+}
+
+func (t *trackWriter) WriteRTP(packet *rtp.Packet) error {
+	return t.writer.WriteRTP(packet)
+}
+
+func (t *trackWriter) Close() error {
+	err := t.writer.Close()
+
+	rec := t.recording
+	rec.mu.Lock()
+	now := time.Now().UTC()
+	rec.meta.Tracks[t.index].StoppedAt = &now
+	rec.mu.Unlock()
+	return err
+}
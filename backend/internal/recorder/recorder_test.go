@@ -0,0 +1,99 @@
+package recorder
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AnishG-git/streamify/internal/sfu"
+	"github.com/pion/webrtc/v4"
+)
+
+func TestStartAndStop(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	s, err := sfu.New(sfu.Config{}, logger)
+	if err != nil {
+		t.Fatalf("sfu.New: %v", err)
+	}
+	r, err := New(Config{Dir: t.TempDir()}, s, logger)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	if _, err := r.Start("ABC123", "alice", []string{"alice"}); !errors.Is(err, sfu.ErrRoomNotFound) {
+		t.Errorf("Start without an SFU session = %v, want ErrRoomNotFound", err)
+	}
+	if _, err := r.Start("../ABC123", "alice", nil); err == nil {
+		t.Error("Start accepted a room code escaping the recording directory")
+	}
+
+	if err := s.Join("ABC123", "alice-id", "alice", false, func(map[string]interface{}) error { return nil }); err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	defer s.Leave("ABC123", "alice-id")
+
+	started, err := r.Start("ABC123", "alice", []string{"alice", "bob"})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := r.Start("ABC123", "alice", nil); !errors.Is(err, ErrAlreadyRecording) {
+		t.Errorf("second Start = %v, want ErrAlreadyRecording", err)
+	}
+
+	// tracks are written by the sink the SFU feeds
+	r.mu.Lock()
+	rec := r.active["ABC123"]
+	r.mu.Unlock()
+	video := rec.OpenTrack(sfu.TrackInfo{
+		PublisherName: "carol",
+		Kind:          webrtc.RTPCodecTypeVideo,
+		Codec:         webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000}},
+	})
+	if video == nil {
+		t.Fatal("OpenTrack skipped a VP8 track")
+	}
+	if err := video.Close(); err != nil {
+		t.Errorf("closing the VP8 track: %v", err)
+	}
+	unsupported := rec.OpenTrack(sfu.TrackInfo{
+		PublisherName: "dave",
+		Kind:          webrtc.RTPCodecTypeVideo,
+		Codec:         webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000}},
+	})
+	if unsupported != nil {
+		t.Error("OpenTrack recorded an H264 track")
+	}
+
+	stopped, err := r.Stop("ABC123")
+	if err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if stopped.ID != started.ID || stopped.StoppedAt == nil {
+		t.Errorf("Stop returned %+v, want recording %s stopped", stopped, started.ID)
+	}
+	if _, err := r.Stop("ABC123"); !errors.Is(err, ErrNotRecording) {
+		t.Errorf("second Stop = %v, want ErrNotRecording", err)
+	}
+
+	recordings, err := r.List(context.Background(), "ABC123")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(recordings) != 1 {
+		t.Fatalf("List returned %d recordings, want 1", len(recordings))
+	}
+	got := recordings[0]
+	if want := []string{"alice", "bob", "carol"}; len(got.Participants) != len(want) || got.Participants[2] != "carol" {
+		t.Errorf("participants = %v, want %v", got.Participants, want)
+	}
+	if len(got.Tracks) != 1 || got.Tracks[0].StoppedAt == nil {
+		t.Fatalf("tracks = %+v, want one stopped track", got.Tracks)
+	}
+	if _, err := os.Stat(filepath.Join(r.config.Dir, "ABC123", got.Tracks[0].File)); err != nil {
+		t.Errorf("track file: %v", err)
+	}
+}
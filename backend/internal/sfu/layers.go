@@ -0,0 +1,174 @@
+package sfu
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+)
+
+// LayerAuto lets the server pick the best layer the subscriber's bandwidth allows
+const LayerAuto = "auto"
+
+// Layers are the simulcast RIDs publishers must use, lowest quality first.
+// A track published without simulcast has a single layer with an empty RID.
+var Layers = []string{"q", "h", "f"}
+
+// switchTimestampStep is how far the timestamp advances across a layer switch, one frame at 30 fps on the 90 kHz video clock
+const switchTimestampStep = 90000 / 30
+
+// layerRank orders layers from lowest to highest quality, it is -1 for unknown layers
+func layerRank(rid string) int {
+	if rid == "" {
+		return 0
+	}
+	for i, layer := range Layers {
+		if layer == rid {
+			return i
+		}
+	}
+	return -1
+}
+
+// layerSelector forwards a single layer of a publication to one receiver. Layers
+// are only switched at keyframes, and sequence numbers and timestamps are
+// rewritten so the receiver sees one continuous stream.
+type layerSelector struct {
+	write func(packet *rtp.Packet) error
+
+	mu      sync.Mutex
+	target  string
+	current string
+	// active is set once the first keyframe of the target layer has been forwarded
+	active          bool
+	lastSeq         uint16
+	lastTimestamp   uint32
+	seqOffset       uint16
+	timestampOffset uint32
+}
+
+func newLayerSelector(target string, write func(packet *rtp.Packet) error) *layerSelector {
+	return &layerSelector{target: target, write: write}
+}
+
+// setTarget reports whether the target changed
+func (s *layerSelector) setTarget(rid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.target == rid {
+		return false
+	}
+	s.target = rid
+	return true
+}
+
+func (s *layerSelector) getTarget() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.target
+}
+
+// currentLayer returns the layer being forwarded, or the target before anything has been
+func (s *layerSelector) currentLayer() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.active {
+		return s.target
+	}
+	return s.current
+}
+
+func (s *layerSelector) forward(rid string, packet *rtp.Packet, keyframe bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.active || rid != s.current {
+		// the receiver could not decode the new layer without starting from a keyframe
+		if rid != s.target || !keyframe {
+			return
+		}
+		if s.active {
+			s.seqOffset = packet.SequenceNumber - s.lastSeq - 1
+			s.timestampOffset = packet.Timestamp - s.lastTimestamp - switchTimestampStep
+		}
+		s.current = rid
+		s.active = true
+	}
+
+	out := *packet
+	out.SequenceNumber -= s.seqOffset
+	out.Timestamp -= s.timestampOffset
+	// header extension IDs were negotiated with the publisher and mean nothing to the receiver
+	out.Extension = false
+	out.Extensions = nil
+	s.lastSeq = out.SequenceNumber
+	s.lastTimestamp = out.Timestamp
+
+	s.write(&out)
+}
+
+// isKeyframe reports whether a video packet starts a keyframe. Packets of codecs
+// it can't parse are treated as keyframes so they are never held back.
+func isKeyframe(mimeType string, payload []byte) bool {
+	switch strings.ToLower(mimeType) {
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		var vp8 codecs.VP8Packet
+		if _, err := vp8.Unmarshal(payload); err != nil {
+			return false
+		}
+		return vp8.S == 1 && vp8.PID == 0 && len(vp8.Payload) > 0 && vp8.Payload[0]&0x01 == 0
+	case strings.ToLower(webrtc.MimeTypeVP9):
+		var vp9 codecs.VP9Packet
+		if _, err := vp9.Unmarshal(payload); err != nil {
+			return false
+		}
+		return vp9.B && !vp9.P
+	case strings.ToLower(webrtc.MimeTypeH264):
+		return isH264Keyframe(payload)
+	case strings.ToLower(webrtc.MimeTypeAV1):
+		// the N bit of the aggregation header marks the first packet of a coded video sequence
+		return len(payload) > 0 && payload[0]&0x08 != 0
+	default:
+		return true
+	}
+}
+
+const (
+	h264NALUIDR  = 5
+	h264NALUSPS  = 7
+	h264NALUSTAP = 24
+	h264NALUFU   = 28
+)
+
+func isH264Keyframe(payload []byte) bool {
+	if len(payload) < 2 {
+		return false
+	}
+	switch naluType := payload[0] & 0x1F; naluType {
+	case h264NALUIDR, h264NALUSPS:
+		return true
+	case h264NALUSTAP:
+		// aggregated NAL units, each prefixed by a 16 bit size
+		for offset := 1; offset+2 < len(payload); {
+			size := int(payload[offset])<<8 | int(payload[offset+1])
+			offset += 2
+			if offset >= len(payload) {
+				return false
+			}
+			if t := payload[offset] & 0x1F; t == h264NALUIDR || t == h264NALUSPS {
+				return true
+			}
+			offset += size
+		}
+		return false
+	case h264NALUFU:
+		// fragmented NAL unit, only its first fragment starts the frame
+		start := payload[1]&0x80 != 0
+		t := payload[1] & 0x1F
+		return start && (t == h264NALUIDR || t == h264NALUSPS)
+	default:
+		return false
+	}
+}
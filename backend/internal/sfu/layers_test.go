@@ -0,0 +1,83 @@
+package sfu
+
+import (
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+func TestLayerSelectorSwitchesAtKeyframes(t *testing.T) {
+	var got []*rtp.Packet
+	s := newLayerSelector("q", func(packet *rtp.Packet) error {
+		got = append(got, packet)
+		return nil
+	})
+	send := func(rid string, seq uint16, timestamp uint32, keyframe bool) {
+		s.forward(rid, &rtp.Packet{Header: rtp.Header{SequenceNumber: seq, Timestamp: timestamp}}, keyframe)
+	}
+
+	send("q", 10, 1000, false) // waits for a keyframe
+	send("h", 500, 9000, true) // not the target
+	send("q", 11, 2000, true)
+	send("q", 12, 3000, false)
+	s.setTarget("h")
+	send("h", 501, 9000, false) // the old layer is kept until the new one has a keyframe
+	send("q", 13, 4000, false)
+	send("h", 502, 10000, true)
+	send("q", 14, 5000, true) // no longer the target
+	send("h", 503, 11000, false)
+
+	want := []struct {
+		seq       uint16
+		timestamp uint32
+	}{
+		{11, 2000},
+		{12, 3000},
+		{13, 4000},
+		{14, 4000 + switchTimestampStep},
+		{15, 5000 + switchTimestampStep},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("forwarded %d packets, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].SequenceNumber != w.seq || got[i].Timestamp != w.timestamp {
+			t.Errorf("packet %d = seq %d ts %d, want seq %d ts %d", i, got[i].SequenceNumber, got[i].Timestamp, w.seq, w.timestamp)
+		}
+	}
+	if layer := s.currentLayer(); layer != "h" {
+		t.Errorf("currentLayer = %q, want h", layer)
+	}
+}
+
+func TestChooseLayer(t *testing.T) {
+	pub := newPublication(TrackInfo{Kind: webrtc.RTPCodecTypeVideo}, "stream")
+	for rid, bitrate := range map[string]uint64{"q": 150_000, "h": 500_000, "f": 2_000_000} {
+		l := &layer{rid: rid}
+		l.bitrate.Store(bitrate)
+		pub.addLayer(l)
+	}
+
+	tests := []struct {
+		name      string
+		requested string
+		budget    uint64
+		want      string
+	}{
+		{"unknown bandwidth", LayerAuto, 0, "q"},
+		{"fits the full layer", LayerAuto, 3_000_000, "f"},
+		{"fits the half layer", LayerAuto, 1_000_000, "h"},
+		{"headroom leaves out the half layer", LayerAuto, 520_000, "q"},
+		{"below the lowest layer", LayerAuto, 10_000, "q"},
+		{"requested layer", "f", 10_000, "f"},
+		{"requested layer not published", "x", 1_000_000, "h"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pub.chooseLayer(tt.requested, tt.budget); got != tt.want {
+				t.Errorf("chooseLayer(%q, %d) = %q, want %q", tt.requested, tt.budget, got, tt.want)
+			}
+		})
+	}
+}
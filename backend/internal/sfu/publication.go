@@ -0,0 +1,290 @@
+package sfu
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+// bitrateHeadroom is how much of a subscriber's budget a layer may use, leaving room for audio and estimate errors
+const bitrateHeadroom = 0.9
+
+// publication is a track published by a peer, with one layer per simulcast encoding
+type publication struct {
+	// id tells apart publications whose publishers picked the same track ID, it is also the ID of
+	// the tracks forwarding the publication
+	id       string
+	info     TrackInfo
+	streamID string
+
+	mu         sync.RWMutex
+	layers     map[string]*layer
+	downTracks map[string]*downTrack
+	sinks      map[string]*sinkTrack
+}
+
+// layer is a single encoding of a publication as received from the publisher
+type layer struct {
+	rid  string
+	ssrc webrtc.SSRC
+	// pc is the PeerConnection the layer arrives on, keyframes are requested through it
+	pc *webrtc.PeerConnection
+
+	// bytes counts what was received since the last measurement
+	bytes atomic.Uint64
+	// bitrate is the measured bits per second
+	bitrate atomic.Uint64
+}
+
+// downTrack forwards a publication to a single subscriber
+type downTrack struct {
+	subscriber *peer
+	track      *webrtc.TrackLocalStaticRTP
+	selector   *layerSelector
+
+	mu sync.Mutex
+	// requested is the layer asked for by the subscriber, or LayerAuto
+	requested string
+}
+
+func (d *downTrack) getRequested() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.requested
+}
+
+func (d *downTrack) setRequested(rid string) {
+	d.mu.Lock()
+	d.requested = rid
+	d.mu.Unlock()
+}
+
+// sinkTrack feeds a publication to a Sink, always from the highest layer
+type sinkTrack struct {
+	sink     TrackSink
+	selector *layerSelector
+}
+
+// publicationID keys a publication by its publisher, since publishers choose their track IDs
+func publicationID(publisherID, trackID string) string {
+	return publisherID + ":" + trackID
+}
+
+func newPublication(info TrackInfo, streamID string) *publication {
+	return &publication{
+		id:         publicationID(info.PublisherID, info.TrackID),
+		info:       info,
+		streamID:   streamID,
+		layers:     make(map[string]*layer),
+		downTracks: make(map[string]*downTrack),
+		sinks:      make(map[string]*sinkTrack),
+	}
+}
+
+func (p *publication) isVideo() bool {
+	return p.info.Kind == webrtc.RTPCodecTypeVideo
+}
+
+func (p *publication) addLayer(l *layer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.layers[l.rid] = l
+
+	// sinks record the best quality available
+	highest := p.highestLayer()
+	for _, sink := range p.sinks {
+		sink.selector.setTarget(highest)
+	}
+}
+
+// removeLayer returns how many layers are left
+func (p *publication) removeLayer(rid string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.layers, rid)
+
+	highest := p.highestLayer()
+	for _, sink := range p.sinks {
+		sink.selector.setTarget(highest)
+	}
+	return len(p.layers)
+}
+
+// layerIDs must be called with p.mu held. It returns the layers lowest quality first.
+func (p *publication) layerIDs() []string {
+	ids := make([]string, 0, len(p.layers))
+	for rid := range p.layers {
+		ids = append(ids, rid)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return layerRank(ids[i]) < layerRank(ids[j])
+	})
+	return ids
+}
+
+// highestLayer must be called with p.mu held
+func (p *publication) highestLayer() string {
+	ids := p.layerIDs()
+	if len(ids) == 0 {
+		return ""
+	}
+	return ids[len(ids)-1]
+}
+
+// chooseLayer must be called with p.mu held. It picks the best layer up to the
+// requested one whose bitrate fits the budget, falling back to the lowest layer.
+// A budget of zero means the bandwidth is unknown.
+func (p *publication) chooseLayer(requested string, budget uint64) string {
+	ids := p.layerIDs()
+	if len(ids) == 0 {
+		return ""
+	}
+	if requested != LayerAuto {
+		if _, ok := p.layers[requested]; ok {
+			return requested
+		}
+	}
+	if budget == 0 {
+		return ids[0]
+	}
+
+	chosen := ids[0]
+	for _, rid := range ids[1:] {
+		if float64(p.layers[rid].bitrate.Load()) > float64(budget)*bitrateHeadroom {
+			break
+		}
+		chosen = rid
+	}
+	return chosen
+}
+
+// forward hands a packet received on a layer to every subscriber and sink
+func (p *publication) forward(l *layer, packet *rtp.Packet) {
+	l.bytes.Add(uint64(packet.MarshalSize()))
+	keyframe := !p.isVideo() || isKeyframe(p.info.Codec.MimeType, packet.Payload)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, down := range p.downTracks {
+		down.selector.forward(l.rid, packet, keyframe)
+	}
+	for _, sink := range p.sinks {
+		sink.selector.forward(l.rid, packet, keyframe)
+	}
+}
+
+// measure updates the layers' bitrates from the bytes received over interval
+func (p *publication) measure(interval time.Duration) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, l := range p.layers {
+		bytes := l.bytes.Swap(0)
+		l.bitrate.Store(uint64(float64(bytes*8) / interval.Seconds()))
+	}
+}
+
+func (p *publication) requestKeyframe(rid string) {
+	p.mu.RLock()
+	l, ok := p.layers[rid]
+	p.mu.RUnlock()
+	if !ok {
+		return
+	}
+	l.pc.WriteRTCP([]rtcp.Packet{
+		&rtcp.PictureLossIndication{MediaSSRC: uint32(l.ssrc)},
+	})
+}
+
+func (p *publication) requestKeyframes() {
+	p.mu.RLock()
+	rids := p.layerIDs()
+	p.mu.RUnlock()
+	for _, rid := range rids {
+		p.requestKeyframe(rid)
+	}
+}
+
+func (p *publication) getDownTrack(subscriberID string) (*downTrack, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	down, ok := p.downTracks[subscriberID]
+	return down, ok
+}
+
+// addDownTrack starts forwarding the publication to a subscriber
+func (p *publication) addDownTrack(subscriber *peer, track *webrtc.TrackLocalStaticRTP) *downTrack {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	down := &downTrack{
+		subscriber: subscriber,
+		track:      track,
+		selector:   newLayerSelector(p.chooseLayer(LayerAuto, 0), track.WriteRTP),
+		requested:  LayerAuto,
+	}
+	p.downTracks[subscriber.id] = down
+	return down
+}
+
+func (p *publication) removeDownTrack(subscriberID string) {
+	p.mu.Lock()
+	delete(p.downTracks, subscriberID)
+	p.mu.Unlock()
+}
+
+// selectLayer retargets a subscriber's layer and tells it when the layer changes
+func (p *publication) selectLayer(down *downTrack, budget uint64) {
+	if !p.isVideo() {
+		return
+	}
+
+	p.mu.RLock()
+	requested := down.getRequested()
+	rid := p.chooseLayer(requested, budget)
+	layers := p.layerIDs()
+	p.mu.RUnlock()
+
+	if !down.selector.setTarget(rid) {
+		return
+	}
+	p.requestKeyframe(rid)
+
+	// subscribers of single layer tracks have nothing to choose from
+	if len(layers) < 2 {
+		return
+	}
+	down.subscriber.signal(map[string]interface{}{
+		"type":      MessageLayer,
+		"trackId":   p.id,
+		"layer":     rid,
+		"requested": requested,
+		"layers":    layers,
+	})
+}
+
+func (p *publication) openSink(sinkID string, sink Sink) {
+	trackSink := sink.OpenTrack(p.info)
+	if trackSink == nil {
+		return
+	}
+	p.mu.Lock()
+	p.sinks[sinkID] = &sinkTrack{
+		sink:     trackSink,
+		selector: newLayerSelector(p.highestLayer(), trackSink.WriteRTP),
+	}
+	p.mu.Unlock()
+}
+
+func (p *publication) closeSink(sinkID string) {
+	p.mu.Lock()
+	sink, ok := p.sinks[sinkID]
+	delete(p.sinks, sinkID)
+	p.mu.Unlock()
+	if ok {
+		sink.sink.Close()
+	}
+}
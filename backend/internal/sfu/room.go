@@ -0,0 +1,437 @@
+package sfu
+
+import (
+	"log"
+	"maps"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/interceptor/pkg/cc"
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	// maxSyncAttempts is how many times signalPeers retries before backing off
+	maxSyncAttempts = 25
+	syncBackoff     = 3 * time.Second
+)
+
+type peer struct {
+	id   string
+	name string
+	// viewers only receive the tracks of the room's presenters
+	viewer bool
+	pc     *webrtc.PeerConnection
+	signal Signaler
+	// estimator is the send side bandwidth estimate for pc, fed by the subscriber's TWCC feedback
+	estimator cc.BandwidthEstimator
+	// remb is the latest bitrate in bits per second reported by the subscriber in REMB packets
+	remb atomic.Uint64
+
+	// publishPC is the optional PeerConnection negotiated by the peer to publish simulcast tracks
+	publishMu sync.Mutex
+	publishPC *webrtc.PeerConnection
+}
+
+// estimate returns the bits per second the peer can receive, zero if unknown
+func (p *peer) estimate() uint64 {
+	var twcc uint64
+	if p.estimator != nil {
+		twcc = uint64(p.estimator.GetTargetBitrate())
+	}
+	remb := p.remb.Load()
+	switch {
+	case twcc == 0:
+		return remb
+	case remb == 0:
+		return twcc
+	default:
+		return min(twcc, remb)
+	}
+}
+
+func (p *peer) close() error {
+	p.publishMu.Lock()
+	publishPC := p.publishPC
+	p.publishMu.Unlock()
+	if publishPC != nil {
+		publishPC.Close()
+	}
+	return p.pc.Close()
+}
+
+type room struct {
+	code   string
+	logger *log.Logger
+
+	mu           sync.Mutex
+	peers        map[string]*peer
+	publications map[string]*publication
+	sinks        map[string]Sink
+	// presenters are the names of the members whose tracks viewers receive
+	presenters map[string]bool
+}
+
+func newRoom(code string, logger *log.Logger) *room {
+	return &room{
+		code:         code,
+		logger:       logger,
+		peers:        make(map[string]*peer),
+		publications: make(map[string]*publication),
+		sinks:        make(map[string]Sink),
+		presenters:   make(map[string]bool),
+	}
+}
+
+// setPresenters reports whether the presenters changed
+func (r *room) setPresenters(names []string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	presenters := make(map[string]bool, len(names))
+	for _, name := range names {
+		presenters[name] = true
+	}
+	if maps.Equal(presenters, r.presenters) {
+		return false
+	}
+	r.presenters = presenters
+	return true
+}
+
+// forwards must be called with r.mu held. It reports whether pub is forwarded to p.
+func (r *room) forwards(pub *publication, p *peer) bool {
+	return pub.info.PublisherID != p.id && (!p.viewer || r.presenters[pub.info.PublisherName])
+}
+
+func (r *room) addPeer(p *peer) {
+	r.mu.Lock()
+	r.peers[p.id] = p
+	r.mu.Unlock()
+}
+
+func (r *room) getPeer(peerID string) (*peer, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.peers[peerID]
+	return p, ok
+}
+
+// removePeer closes the peer's PeerConnections and reports whether the room is now empty
+func (r *room) removePeer(peerID string) bool {
+	r.mu.Lock()
+	p, ok := r.peers[peerID]
+	delete(r.peers, peerID)
+	empty := len(r.peers) == 0
+	for _, pub := range r.publications {
+		pub.removeDownTrack(peerID)
+	}
+	r.mu.Unlock()
+
+	if ok {
+		if err := p.close(); err != nil {
+			r.logger.Printf("Failed to close peer connection for %s in room %s: %v", peerID, r.code, err)
+		}
+	}
+	return empty
+}
+
+func (r *room) isEmpty() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.peers) == 0
+}
+
+// addLayer registers a track received from a publisher, creating its publication on the first layer
+func (r *room) addLayer(publisher *peer, pc *webrtc.PeerConnection, remote *webrtc.TrackRemote) (*publication, *layer) {
+	l := &layer{rid: remote.RID(), ssrc: remote.SSRC(), pc: pc}
+
+	r.mu.Lock()
+	pub, ok := r.publications[publicationID(publisher.id, remote.ID())]
+	if !ok {
+		pub = newPublication(TrackInfo{
+			PublisherID:   publisher.id,
+			PublisherName: publisher.name,
+			TrackID:       remote.ID(),
+			Kind:          remote.Kind(),
+			Codec:         remote.Codec(),
+		}, remote.StreamID())
+		r.publications[pub.id] = pub
+	}
+	pub.addLayer(l)
+	if !ok {
+		for sinkID, sink := range r.sinks {
+			pub.openSink(sinkID, sink)
+		}
+	}
+	r.mu.Unlock()
+
+	if !ok {
+		r.signalPeers()
+	}
+	return pub, l
+}
+
+// removeLayer drops a layer once its publisher stops sending it, and the publication with its last layer
+func (r *room) removeLayer(pub *publication, l *layer) {
+	if remaining := pub.removeLayer(l.rid); remaining > 0 {
+		return
+	}
+
+	r.mu.Lock()
+	if r.publications[pub.id] == pub {
+		delete(r.publications, pub.id)
+	}
+	for sinkID := range r.sinks {
+		pub.closeSink(sinkID)
+	}
+	r.mu.Unlock()
+	r.signalPeers()
+}
+
+// getPublication looks a publication up by the ID of the tracks forwarding it
+func (r *room) getPublication(id string) (*publication, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pub, ok := r.publications[id]
+	return pub, ok
+}
+
+func (r *room) addSink(sinkID string, sink Sink) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sinks[sinkID] = sink
+	for _, pub := range r.publications {
+		pub.openSink(sinkID, sink)
+	}
+}
+
+func (r *room) removeSink(sinkID string) {
+	r.mu.Lock()
+	sink, ok := r.sinks[sinkID]
+	delete(r.sinks, sinkID)
+	for _, pub := range r.publications {
+		pub.closeSink(sinkID)
+	}
+	r.mu.Unlock()
+	if ok {
+		sink.Close()
+	}
+}
+
+// closeSinks removes every sink once the room is gone
+func (r *room) closeSinks() {
+	r.mu.Lock()
+	sinkIDs := make([]string, 0, len(r.sinks))
+	for sinkID := range r.sinks {
+		sinkIDs = append(sinkIDs, sinkID)
+	}
+	r.mu.Unlock()
+
+	for _, sinkID := range sinkIDs {
+		r.removeSink(sinkID)
+	}
+}
+
+// signalPeers brings every peer's senders in line with the publications
+// and sends each peer a fresh offer
+func (r *room) signalPeers() {
+	r.mu.Lock()
+	defer func() {
+		r.mu.Unlock()
+		r.requestKeyframes()
+	}()
+
+	for attempt := 0; ; attempt++ {
+		if attempt == maxSyncAttempts {
+			// release the lock and try again once the peers have settled
+			go func() {
+				time.Sleep(syncBackoff)
+				r.signalPeers()
+			}()
+			return
+		}
+		if !r.attemptSync() {
+			return
+		}
+	}
+}
+
+// attemptSync must be called with r.mu held. It reports whether the sync has to be restarted.
+func (r *room) attemptSync() bool {
+	for id, p := range r.peers {
+		if p.pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			delete(r.peers, id)
+			return true
+		}
+
+		// drop senders whose tracks are no longer published or no longer forwarded to the peer
+		for _, sender := range p.pc.GetSenders() {
+			if sender.Track() == nil {
+				continue
+			}
+			if pub, ok := r.publications[sender.Track().ID()]; ok {
+				if !r.forwards(pub, p) {
+					pub.removeDownTrack(id)
+				} else if down, ok := pub.getDownTrack(id); ok && down.track == sender.Track() {
+					continue
+				}
+			}
+			if err := p.pc.RemoveTrack(sender); err != nil {
+				return true
+			}
+		}
+
+		// forward everything the peer doesn't publish itself, viewers only get the presenters' tracks
+		for _, pub := range r.publications {
+			if !r.forwards(pub, p) {
+				continue
+			}
+			if _, ok := pub.getDownTrack(id); ok {
+				continue
+			}
+			if err := r.subscribe(p, pub); err != nil {
+				return true
+			}
+		}
+
+		offer, err := p.pc.CreateOffer(nil)
+		if err != nil {
+			return true
+		}
+		if err := p.pc.SetLocalDescription(offer); err != nil {
+			return true
+		}
+		err = p.signal(map[string]interface{}{
+			"type":  MessageOffer,
+			"offer": offer,
+		})
+		if err != nil {
+			r.logger.Printf("Failed to send offer to peer %s in room %s: %v", id, r.code, err)
+			return true
+		}
+	}
+	return false
+}
+
+// subscribe must be called with r.mu held. It adds a track forwarding pub to the subscriber's PeerConnection.
+func (r *room) subscribe(subscriber *peer, pub *publication) error {
+	// every subscriber gets its own track so it can receive its own layer
+	track, err := webrtc.NewTrackLocalStaticRTP(pub.info.Codec.RTPCodecCapability, pub.id, pub.streamID)
+	if err != nil {
+		return err
+	}
+	sender, err := subscriber.pc.AddTrack(track)
+	if err != nil {
+		return err
+	}
+	down := pub.addDownTrack(subscriber, track)
+
+	// RTCP has to be read for the interceptors to see NACKs and TWCC feedback
+	go func() {
+		for {
+			packets, _, err := sender.ReadRTCP()
+			if err != nil {
+				return
+			}
+			for _, packet := range packets {
+				switch packet := packet.(type) {
+				case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+					pub.requestKeyframe(down.selector.currentLayer())
+				case *rtcp.ReceiverEstimatedMaximumBitrate:
+					subscriber.remb.Store(uint64(packet.Bitrate))
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// updateLayers measures the published layers and moves each subscriber to the
+// best layer its bandwidth allows. A subscriber's estimate is split evenly
+// between the video tracks it receives.
+func (r *room) updateLayers(interval time.Duration) {
+	r.mu.Lock()
+	pubs := make([]*publication, 0, len(r.publications))
+	for _, pub := range r.publications {
+		pubs = append(pubs, pub)
+	}
+	r.mu.Unlock()
+
+	videoTracks := make(map[string]int)
+	for _, pub := range pubs {
+		pub.measure(interval)
+		if !pub.isVideo() {
+			continue
+		}
+		pub.mu.RLock()
+		for subscriberID := range pub.downTracks {
+			videoTracks[subscriberID]++
+		}
+		pub.mu.RUnlock()
+	}
+
+	for _, pub := range pubs {
+		if !pub.isVideo() {
+			continue
+		}
+		pub.mu.RLock()
+		downs := make([]*downTrack, 0, len(pub.downTracks))
+		for _, down := range pub.downTracks {
+			downs = append(downs, down)
+		}
+		pub.mu.RUnlock()
+
+		for _, down := range downs {
+			budget := down.subscriber.estimate() / uint64(videoTracks[down.subscriber.id])
+			pub.selectLayer(down, budget)
+		}
+	}
+}
+
+// selectLayer applies a subscriber's layer request for a track, trackID is the ID of the track it receives
+func (r *room) selectLayer(subscriber *peer, trackID, rid string) error {
+	pub, ok := r.getPublication(trackID)
+	if !ok {
+		return ErrTrackNotFound
+	}
+	down, ok := pub.getDownTrack(subscriber.id)
+	if !ok {
+		return ErrTrackNotFound
+	}
+
+	down.setRequested(rid)
+	pub.selectLayer(down, subscriber.estimate()/uint64(r.videoTrackCount(subscriber.id)))
+	return nil
+}
+
+// videoTrackCount returns how many video tracks a subscriber receives, at least one
+func (r *room) videoTrackCount(subscriberID string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for _, pub := range r.publications {
+		if _, ok := pub.getDownTrack(subscriberID); ok && pub.isVideo() {
+			count++
+		}
+	}
+	return max(count, 1)
+}
+
+// requestKeyframes sends a PLI for every layer of every published video track
+func (r *room) requestKeyframes() {
+	r.mu.Lock()
+	pubs := make([]*publication, 0, len(r.publications))
+	for _, pub := range r.publications {
+		if pub.isVideo() {
+			pubs = append(pubs, pub)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, pub := range pubs {
+		pub.requestKeyframes()
+	}
+}
@@ -0,0 +1,499 @@
+// Package sfu implements a selective forwarding unit for rooms that outgrow
+// mesh WebRTC. Every participant holds a PeerConnection with the server,
+// publishes its tracks once and receives everyone else's tracks forwarded by
+// the server. Signaling runs over the room WebSocket using sfu-offer,
+// sfu-answer and sfu-candidate messages, with the server creating the offers.
+//
+// Publishers that want to send simulcast negotiate a second, publish-only
+// PeerConnection with sfu-publish-offer, sfu-publish-answer and
+// sfu-publish-candidate messages, since the browser has to create the offer
+// for simulcast. Each subscriber receives one layer of every simulcast track,
+// either the layer it asked for with sfu-select-layer or the best layer its
+// bandwidth estimate allows.
+//
+// Viewers hold a receive-only PeerConnection and are only forwarded the
+// tracks of the members set with SetPresenters.
+//
+// Rooms live in the memory of the instance that holds their connections, so
+// all members of an SFU room must be connected to the same instance.
+package sfu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/cc"
+	"github.com/pion/interceptor/pkg/gcc"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	MessageOffer            = "sfu-offer"
+	MessageAnswer           = "sfu-answer"
+	MessageCandidate        = "sfu-candidate"
+	MessagePublishOffer     = "sfu-publish-offer"
+	MessagePublishAnswer    = "sfu-publish-answer"
+	MessagePublishCandidate = "sfu-publish-candidate"
+	MessageSelectLayer      = "sfu-select-layer"
+	MessageLayer            = "sfu-layer"
+)
+
+var (
+	ErrPeerNotFound  = errors.New("peer not found")
+	ErrRoomNotFound  = errors.New("no SFU session for room")
+	ErrTrackNotFound = errors.New("track not found")
+	ErrUnknownLayer  = errors.New("unknown simulcast layer")
+	ErrViewer        = errors.New("viewers cannot publish")
+)
+
+const (
+	// keyframeInterval is how often publishers are asked for a keyframe so that new subscribers can start decoding
+	keyframeInterval = 3 * time.Second
+	// layerInterval is how often layer bitrates are measured and subscribers moved between layers
+	layerInterval = time.Second
+	// initialEstimate is the bandwidth assumed for a subscriber before its feedback arrives
+	initialEstimate = 1_000_000
+)
+
+type Config struct {
+	ICEServers []webrtc.ICEServer
+	// PublicIP is advertised in host candidates when the server is behind 1:1 NAT
+	PublicIP string
+	// PortMin and PortMax bound the UDP ports used for media, any port is used when both are zero
+	PortMin uint16
+	PortMax uint16
+}
+
+// Signaler delivers a signaling message to a peer's WebSocket
+type Signaler func(message map[string]interface{}) error
+
+// TrackInfo describes a published track
+type TrackInfo struct {
+	PublisherID   string
+	PublisherName string
+	TrackID       string
+	Kind          webrtc.RTPCodecType
+	Codec         webrtc.RTPCodecParameters
+}
+
+// Sink receives published media without a PeerConnection of its own, e.g. to record it
+type Sink interface {
+	// OpenTrack is called for every published track. The returned TrackSink receives the
+	// track's RTP packets until the track ends or the sink is removed. Returning nil skips the track.
+	OpenTrack(track TrackInfo) TrackSink
+	// Close is called once the sink has been removed or its room has emptied
+	Close()
+}
+
+type TrackSink interface {
+	WriteRTP(packet *rtp.Packet) error
+	Close() error
+}
+
+type SFU struct {
+	api    *webrtc.API
+	config Config
+	logger *log.Logger
+
+	mu    sync.Mutex
+	rooms map[string]*room
+
+	// pcMu serializes PeerConnection creation so the estimator handed over by
+	// the congestion controller can be matched with its PeerConnection
+	pcMu          sync.Mutex
+	nextEstimator cc.BandwidthEstimator
+}
+
+func New(config Config, logger *log.Logger) (*SFU, error) {
+	mediaEngine := &webrtc.MediaEngine{}
+	if err := mediaEngine.RegisterDefaultCodecs(); err != nil {
+		return nil, err
+	}
+
+	registry := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(mediaEngine, registry); err != nil {
+		return nil, err
+	}
+
+	// estimate each subscriber's bandwidth from its TWCC feedback. Packets are
+	// never paced since the layer choice already keeps them within the estimate.
+	congestionController, err := cc.NewInterceptor(func() (cc.BandwidthEstimator, error) {
+		return gcc.NewSendSideBWE(
+			gcc.SendSideBWEInitialBitrate(initialEstimate),
+			gcc.SendSideBWEPacer(gcc.NewNoOpPacer()),
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+	registry.Add(congestionController)
+	if err := webrtc.ConfigureTWCCHeaderExtensionSender(mediaEngine, registry); err != nil {
+		return nil, err
+	}
+
+	settings := webrtc.SettingEngine{}
+	if config.PortMin != 0 || config.PortMax != 0 {
+		if err := settings.SetEphemeralUDPPortRange(config.PortMin, config.PortMax); err != nil {
+			return nil, err
+		}
+	}
+	if config.PublicIP != "" {
+		if net.ParseIP(config.PublicIP) == nil {
+			return nil, fmt.Errorf("invalid SFU public IP %q", config.PublicIP)
+		}
+		settings.SetNAT1To1IPs([]string{config.PublicIP}, webrtc.ICECandidateTypeHost)
+	}
+
+	s := &SFU{
+		api: webrtc.NewAPI(
+			webrtc.WithMediaEngine(mediaEngine),
+			webrtc.WithInterceptorRegistry(registry),
+			webrtc.WithSettingEngine(settings),
+		),
+		config: config,
+		logger: logger,
+		rooms:  make(map[string]*room),
+	}
+	congestionController.OnNewPeerConnection(func(_ string, estimator cc.BandwidthEstimator) {
+		s.nextEstimator = estimator
+	})
+	go s.requestKeyframes()
+	go s.updateLayers()
+	return s, nil
+}
+
+// newPeerConnection creates a PeerConnection along with its bandwidth estimator
+func (s *SFU) newPeerConnection() (*webrtc.PeerConnection, cc.BandwidthEstimator, error) {
+	s.pcMu.Lock()
+	defer s.pcMu.Unlock()
+	pc, err := s.api.NewPeerConnection(webrtc.Configuration{
+		ICEServers: s.config.ICEServers,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// the estimator is handed over while NewPeerConnection builds the interceptors
+	estimator := s.nextEstimator
+	s.nextEstimator = nil
+	return pc, estimator, nil
+}
+
+// Join creates a PeerConnection for a room member and sends it the first offer.
+// Viewers can't publish and only receive the presenters' tracks.
+func (s *SFU) Join(roomCode, peerID, name string, viewer bool, signal Signaler) error {
+	pc, estimator, err := s.newPeerConnection()
+	if err != nil {
+		return err
+	}
+
+	// every participant may publish one video and one audio track
+	direction := webrtc.RTPTransceiverDirectionRecvonly
+	if viewer {
+		direction = webrtc.RTPTransceiverDirectionInactive
+	}
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		_, err := pc.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{
+			Direction: direction,
+		})
+		if err != nil {
+			pc.Close()
+			return err
+		}
+	}
+
+	r := s.getOrCreateRoom(roomCode)
+	p := &peer{id: peerID, name: name, viewer: viewer, pc: pc, signal: signal, estimator: estimator}
+
+	pc.OnICECandidate(s.sendCandidate(r, p, MessageCandidate))
+
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		switch state {
+		case webrtc.PeerConnectionStateFailed:
+			pc.Close()
+		case webrtc.PeerConnectionStateClosed:
+			r.signalPeers()
+		}
+	})
+
+	if !viewer {
+		pc.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+			s.forwardTrack(r, p, pc, remote)
+		})
+	}
+
+	r.addPeer(p)
+	r.signalPeers()
+	return nil
+}
+
+// sendCandidate returns an OnICECandidate handler trickling candidates to the peer
+func (s *SFU) sendCandidate(r *room, p *peer, messageType string) func(*webrtc.ICECandidate) {
+	return func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			return
+		}
+		err := p.signal(map[string]interface{}{
+			"type":      messageType,
+			"candidate": candidate.ToJSON(),
+		})
+		if err != nil {
+			s.logger.Printf("Failed to send ICE candidate to peer %s in room %s: %v", p.id, r.code, err)
+		}
+	}
+}
+
+// forwardTrack forwards a track, or one simulcast layer of it, until the publisher goes away
+func (s *SFU) forwardTrack(r *room, p *peer, pc *webrtc.PeerConnection, remote *webrtc.TrackRemote) {
+	if layerRank(remote.RID()) < 0 {
+		s.logger.Printf("Ignoring unknown simulcast layer %q from peer %s in room %s", remote.RID(), p.id, r.code)
+		return
+	}
+	if remote.RID() == "" {
+		s.logger.Printf("Peer %s in room %s published a %s track", p.id, r.code, remote.Kind())
+	} else {
+		s.logger.Printf("Peer %s in room %s published simulcast layer %q of a %s track", p.id, r.code, remote.RID(), remote.Kind())
+	}
+
+	pub, l := r.addLayer(p, pc, remote)
+	defer r.removeLayer(pub, l)
+
+	for {
+		packet, _, err := remote.ReadRTP()
+		if err != nil {
+			return
+		}
+		pub.forward(l, packet)
+	}
+}
+
+// Leave closes a member's PeerConnection and stops forwarding its tracks
+func (s *SFU) Leave(roomCode, peerID string) {
+	s.mu.Lock()
+	r, ok := s.rooms[roomCode]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	if empty := r.removePeer(peerID); empty {
+		s.mu.Lock()
+		// the room may have been rejoined since removePeer released its lock
+		empty = r.isEmpty()
+		if empty {
+			delete(s.rooms, roomCode)
+		}
+		s.mu.Unlock()
+		if empty {
+			r.closeSinks()
+			return
+		}
+	}
+	r.signalPeers()
+}
+
+// SetPresenters sets the members whose tracks are forwarded to the room's viewers
+func (s *SFU) SetPresenters(roomCode string, names []string) {
+	s.mu.Lock()
+	r, ok := s.rooms[roomCode]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	if r.setPresenters(names) {
+		r.signalPeers()
+	}
+}
+
+// AddSink attaches a sink to a room with at least one member. The sink receives
+// every track published from now on, and the tracks that are already published.
+func (s *SFU) AddSink(roomCode, sinkID string, sink Sink) error {
+	s.mu.Lock()
+	r, ok := s.rooms[roomCode]
+	s.mu.Unlock()
+	if !ok {
+		return ErrRoomNotFound
+	}
+
+	r.addSink(sinkID, sink)
+	// sinks can only start decoding video from a keyframe
+	r.requestKeyframes()
+	return nil
+}
+
+// RemoveSink detaches a sink, closing its track sinks and the sink itself
+func (s *SFU) RemoveSink(roomCode, sinkID string) {
+	s.mu.Lock()
+	r, ok := s.rooms[roomCode]
+	s.mu.Unlock()
+	if ok {
+		r.removeSink(sinkID)
+	}
+}
+
+// HandleMessage applies an sfu-answer or sfu-candidate message sent by a peer
+func (s *SFU) HandleMessage(roomCode, peerID string, message map[string]interface{}) error {
+	s.mu.Lock()
+	r, ok := s.rooms[roomCode]
+	s.mu.Unlock()
+	if !ok {
+		return ErrPeerNotFound
+	}
+	p, ok := r.getPeer(peerID)
+	if !ok {
+		return ErrPeerNotFound
+	}
+
+	switch message["type"] {
+	case MessageAnswer:
+		var answer webrtc.SessionDescription
+		if err := decodeField(message, "answer", &answer); err != nil {
+			return err
+		}
+		return p.pc.SetRemoteDescription(answer)
+	case MessageCandidate:
+		var candidate webrtc.ICECandidateInit
+		if err := decodeField(message, "candidate", &candidate); err != nil {
+			return err
+		}
+		return p.pc.AddICECandidate(candidate)
+	case MessagePublishOffer:
+		if p.viewer {
+			return ErrViewer
+		}
+		var offer webrtc.SessionDescription
+		if err := decodeField(message, "offer", &offer); err != nil {
+			return err
+		}
+		return s.answerPublish(r, p, offer)
+	case MessagePublishCandidate:
+		if p.viewer {
+			return ErrViewer
+		}
+		var candidate webrtc.ICECandidateInit
+		if err := decodeField(message, "candidate", &candidate); err != nil {
+			return err
+		}
+		p.publishMu.Lock()
+		publishPC := p.publishPC
+		p.publishMu.Unlock()
+		if publishPC == nil {
+			return fmt.Errorf("%s sent before %s", MessagePublishCandidate, MessagePublishOffer)
+		}
+		return publishPC.AddICECandidate(candidate)
+	case MessageSelectLayer:
+		var trackID, rid string
+		if err := decodeField(message, "trackId", &trackID); err != nil {
+			return err
+		}
+		if err := decodeField(message, "layer", &rid); err != nil {
+			return err
+		}
+		if rid != LayerAuto && layerRank(rid) < 0 {
+			return ErrUnknownLayer
+		}
+		return r.selectLayer(p, trackID, rid)
+	default:
+		return fmt.Errorf("unsupported SFU message type %v", message["type"])
+	}
+}
+
+// answerPublish applies an offer for the peer's publish PeerConnection, creating
+// it on the first offer, and sends back the answer
+func (s *SFU) answerPublish(r *room, p *peer, offer webrtc.SessionDescription) error {
+	p.publishMu.Lock()
+	defer p.publishMu.Unlock()
+
+	if p.publishPC == nil {
+		pc, _, err := s.newPeerConnection()
+		if err != nil {
+			return err
+		}
+		pc.OnICECandidate(s.sendCandidate(r, p, MessagePublishCandidate))
+		pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+			if state == webrtc.PeerConnectionStateFailed {
+				pc.Close()
+			}
+		})
+		pc.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+			s.forwardTrack(r, p, pc, remote)
+		})
+		p.publishPC = pc
+	}
+
+	if err := p.publishPC.SetRemoteDescription(offer); err != nil {
+		return err
+	}
+	answer, err := p.publishPC.CreateAnswer(nil)
+	if err != nil {
+		return err
+	}
+	if err := p.publishPC.SetLocalDescription(answer); err != nil {
+		return err
+	}
+	return p.signal(map[string]interface{}{
+		"type":   MessagePublishAnswer,
+		"answer": answer,
+	})
+}
+
+func (s *SFU) getOrCreateRoom(roomCode string) *room {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.rooms[roomCode]
+	if !ok {
+		r = newRoom(roomCode, s.logger)
+		s.rooms[roomCode] = r
+	}
+	return r
+}
+
+func (s *SFU) requestKeyframes() {
+	for range time.NewTicker(keyframeInterval).C {
+		s.mu.Lock()
+		rooms := make([]*room, 0, len(s.rooms))
+		for _, r := range s.rooms {
+			rooms = append(rooms, r)
+		}
+		s.mu.Unlock()
+
+		for _, r := range rooms {
+			r.requestKeyframes()
+		}
+	}
+}
+
+func (s *SFU) updateLayers() {
+	for range time.NewTicker(layerInterval).C {
+		s.mu.Lock()
+		rooms := make([]*room, 0, len(s.rooms))
+		for _, r := range s.rooms {
+			rooms = append(rooms, r)
+		}
+		s.mu.Unlock()
+
+		for _, r := range rooms {
+			r.updateLayers(layerInterval)
+		}
+	}
+}
+
+// decodeField converts a field of a generic JSON message into a typed value
+func decodeField(message map[string]interface{}, field string, v interface{}) error {
+	raw, ok := message[field]
+	if !ok {
+		return fmt.Errorf("message is missing %q", field)
+	}
+	marshalled, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(marshalled, v)
+}
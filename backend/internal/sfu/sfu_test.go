@@ -0,0 +1,81 @@
+package sfu
+
+import (
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"testing"
+)
+
+// recorder collects the signaling messages sent to a peer
+type recorder struct {
+	mu       sync.Mutex
+	messages []map[string]interface{}
+}
+
+func (r *recorder) signal(message map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, message)
+	return nil
+}
+
+func (r *recorder) count(messageType string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, message := range r.messages {
+		if message["type"] == messageType {
+			n++
+		}
+	}
+	return n
+}
+
+// nopSink skips every track
+type nopSink struct {
+	closed bool
+}
+
+func (s *nopSink) OpenTrack(track TrackInfo) TrackSink { return nil }
+func (s *nopSink) Close()                              { s.closed = true }
+
+func TestJoinAndLeave(t *testing.T) {
+	s, err := New(Config{}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	alice, bob := &recorder{}, &recorder{}
+	if err := s.Join("ABC123", "alice-id", "alice", false, alice.signal); err != nil {
+		t.Fatalf("Join alice: %v", err)
+	}
+	if err := s.Join("ABC123", "bob-id", "bob", false, bob.signal); err != nil {
+		t.Fatalf("Join bob: %v", err)
+	}
+	if alice.count(MessageOffer) == 0 || bob.count(MessageOffer) == 0 {
+		t.Errorf("offers sent: alice %d, bob %d, want at least one each", alice.count(MessageOffer), bob.count(MessageOffer))
+	}
+
+	err = s.HandleMessage("ABC123", "carol-id", map[string]interface{}{"type": MessageAnswer})
+	if !errors.Is(err, ErrPeerNotFound) {
+		t.Errorf("HandleMessage from a stranger = %v, want ErrPeerNotFound", err)
+	}
+
+	s.Leave("ABC123", "alice-id")
+	sink := &nopSink{}
+	if err := s.AddSink("ABC123", "recording", sink); err != nil {
+		t.Errorf("AddSink with a member left = %v, want nil", err)
+	}
+	s.RemoveSink("ABC123", "recording")
+	if !sink.closed {
+		t.Error("RemoveSink did not close the sink")
+	}
+
+	// the room goes away with its last member
+	s.Leave("ABC123", "bob-id")
+	if err := s.AddSink("ABC123", "recording", &nopSink{}); !errors.Is(err, ErrRoomNotFound) {
+		t.Errorf("AddSink after everyone left = %v, want ErrRoomNotFound", err)
+	}
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/AnishG-git/streamify/internal/storage/models"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// appendAnnotationScript numbers an annotation and adds it to the log (KEYS[1]) unless the
+// log holds ARGV[2] annotations already. A clear (ARGV[3] == "1") drops everything before it.
+// It returns the annotation's sequence number, or false when the log is full.
+var appendAnnotationScript = redis.NewScript(`
+local clear = ARGV[3] == "1"
+if not clear and redis.call("ZCARD", KEYS[1]) >= tonumber(ARGV[2]) then
+	return false
+end
+local seq = redis.call("INCR", KEYS[2])
+if clear then
+	redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", seq - 1)
+end
+redis.call("ZADD", KEYS[1], seq, ARGV[1])
+return seq
+`)
+
+// annotationsKey holds a sorted set of annotations scored by their sequence number
+func (r *RDS) annotationsKey(roomCode string) string {
+	return r.keyPrefix + "room:" + roomCode + ":annotations"
+}
+
+// annotationSeqKey holds the sequence number of the room's last annotation
+func (r *RDS) annotationSeqKey(roomCode string) string {
+	return r.keyPrefix + "room:" + roomCode + ":annotation-seq"
+}
+
+func (r *RDS) AppendAnnotation(ctx context.Context, roomCode string, annotation *models.Annotation, maxAnnotations int) (int64, error) {
+	// the sequence number is the score, so it is left out of the member
+	stored := *annotation
+	stored.Seq = 0
+	marshalledAnnotation, err := json.Marshal(stored)
+	if err != nil {
+		return 0, err
+	}
+
+	clear := "0"
+	if annotation.Kind == models.AnnotationClear {
+		clear = "1"
+	}
+	keys := []string{r.annotationsKey(roomCode), r.annotationSeqKey(roomCode)}
+	seq, err := appendAnnotationScript.Run(ctx, r.cli, keys, marshalledAnnotation, maxAnnotations, clear).Int64()
+	if err == redis.Nil {
+		return 0, ErrAnnotationLogFull
+	}
+	return seq, err
+}
+
+func (r *RDS) GetAnnotations(ctx context.Context, roomCode string, afterSeq int64) ([]*models.Annotation, error) {
+	members, err := r.cli.ZRangeByScoreWithScores(ctx, r.annotationsKey(roomCode), &redis.ZRangeBy{
+		Min: "(" + strconv.FormatInt(afterSeq, 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := make([]*models.Annotation, 0, len(members))
+	for _, member := range members {
+		var annotation models.Annotation
+		if err := json.Unmarshal([]byte(member.Member.(string)), &annotation); err != nil {
+			return nil, err
+		}
+		annotation.Seq = int64(member.Score)
+		annotations = append(annotations, &annotation)
+	}
+	return annotations, nil
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// bansKey holds a hash of member name to when their ban runs out in unix milliseconds. It is
+// deleted with the room and expires once its last ban runs out.
+// banScript records a ban running out at ARGV[2] and pushes the expiry of the bans back to it,
+// never forward, so a shorter ban doesn't cut the others short. ARGV[3] is the time now.
+var banScript = redis.NewScript(`
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl < 0 or ttl < tonumber(ARGV[2]) - tonumber(ARGV[3]) then
+	redis.call("PEXPIREAT", KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+func (r *RDS) bansKey(roomCode string) string {
+	return r.keyPrefix + "room:" + roomCode + ":bans"
+}
+
+func (r *RDS) BanFromRoom(ctx context.Context, roomCode, name string, until time.Time) error {
+	return banScript.Run(ctx, r.cli, []string{r.bansKey(roomCode)}, name, until.UnixMilli(), time.Now().UnixMilli()).Err()
+}
+
+// isBanned reports whether name's ban from the room is still running at now
+func (r *RDS) isBanned(ctx context.Context, roomCode, name string, now time.Time) (bool, error) {
+	until, err := r.cli.HGet(ctx, r.bansKey(roomCode), name).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	untilMilli, err := strconv.ParseInt(until, 10, 64)
+	if err != nil {
+		return false, err
+	}
+	return now.UnixMilli() < untilMilli, nil
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/storage/models"
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+)
+
+func TestBanFromRoom(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { cli.Close() })
+	r := NewRDS(cli, "streamify:")
+
+	roomCode := createTestRoom(t, r, 4, 4)
+	now := time.Now()
+	if err := r.BanFromRoom(ctx, roomCode, "alice", now.Add(time.Hour)); err != nil {
+		t.Fatalf("BanFromRoom(alice) = %v", err)
+	}
+	// a shorter ban must not cut the longer one short
+	if err := r.BanFromRoom(ctx, roomCode, "bob", now.Add(time.Minute)); err != nil {
+		t.Fatalf("BanFromRoom(bob) = %v", err)
+	}
+	mr.FastForward(2 * time.Minute)
+	later := now.Add(2 * time.Minute)
+
+	if banned, err := r.isBanned(ctx, roomCode, "alice", later); err != nil || !banned {
+		t.Errorf("isBanned(alice) = %v, %v, want true", banned, err)
+	}
+	if banned, err := r.isBanned(ctx, roomCode, "bob", later); err != nil || banned {
+		t.Errorf("isBanned(bob) = %v, %v, want false once the ban ran out", banned, err)
+	}
+
+	// bans hold for members moved between rooms too
+	for _, moved := range []bool{false, true} {
+		if err := r.CanUserJoinRoom(ctx, roomCode, "alice", models.RoleParticipant, moved); !errors.Is(err, ErrBanned) {
+			t.Errorf("CanUserJoinRoom(alice, moved %v) = %v, want ErrBanned", moved, err)
+		}
+		if err := r.AddUserToRoom(ctx, roomCode, "alice", models.RoleParticipant, "{}", moved); !errors.Is(err, ErrBanned) {
+			t.Errorf("AddUserToRoom(alice, moved %v) = %v, want ErrBanned", moved, err)
+		}
+	}
+	if err := r.AddUserToRoom(ctx, roomCode, "carol", models.RoleParticipant, "{}", false); err != nil {
+		t.Errorf("AddUserToRoom(carol) = %v, want nil", err)
+	}
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// consumeJoinPassScript deletes the pass at KEYS[1] if it holds the token hash ARGV[1]
+// and reports whether it did
+var consumeJoinPassScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("DEL", KEYS[1])
+	return 1
+end
+return 0
+`)
+
+// breakoutsKey holds the set of the room's breakout room codes
+func (r *RDS) breakoutsKey(roomCode string) string {
+	return r.keyPrefix + "room:" + roomCode + ":breakouts"
+}
+
+// joinPassKey holds the hash of a token that lets name join the room once, it expires on its own
+func (r *RDS) joinPassKey(roomCode, name string) string {
+	return r.keyPrefix + "room:" + roomCode + ":pass:" + name
+}
+
+func (r *RDS) AddBreakout(ctx context.Context, parentCode, roomCode string) error {
+	return r.cli.SAdd(ctx, r.breakoutsKey(parentCode), roomCode).Err()
+}
+
+func (r *RDS) RemoveBreakout(ctx context.Context, parentCode, roomCode string) error {
+	return r.cli.SRem(ctx, r.breakoutsKey(parentCode), roomCode).Err()
+}
+
+func (r *RDS) GetBreakouts(ctx context.Context, parentCode string) ([]string, error) {
+	return r.cli.SMembers(ctx, r.breakoutsKey(parentCode)).Result()
+}
+
+func (r *RDS) SetJoinPass(ctx context.Context, roomCode, name, tokenHash string, ttl time.Duration) error {
+	return r.cli.Set(ctx, r.joinPassKey(roomCode, name), tokenHash, ttl).Err()
+}
+
+func (r *RDS) ConsumeJoinPass(ctx context.Context, roomCode, name, tokenHash string) (bool, error) {
+	return consumeJoinPassScript.Run(ctx, r.cli, []string{r.joinPassKey(roomCode, name)}, tokenHash).Bool()
+}
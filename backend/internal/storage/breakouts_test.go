@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+)
+
+func TestConsumeJoinPass(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { cli.Close() })
+	r := NewRDS(cli, "streamify:")
+
+	if err := r.SetJoinPass(ctx, "BRK001", "alice", "hash-a", time.Minute); err != nil {
+		t.Fatalf("SetJoinPass(alice) = %v", err)
+	}
+	if err := r.SetJoinPass(ctx, "BRK001", "bob", "hash-b", time.Minute); err != nil {
+		t.Fatalf("SetJoinPass(bob) = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		member    string
+		tokenHash string
+		want      bool
+	}{
+		{"another member's token", "alice", "hash-b", false},
+		{"own token", "alice", "hash-a", true},
+		// passes are single use
+		{"own token again", "alice", "hash-a", false},
+		{"no pass", "carol", "hash-a", false},
+	}
+	for _, tt := range tests {
+		consumed, err := r.ConsumeJoinPass(ctx, "BRK001", tt.member, tt.tokenHash)
+		if err != nil || consumed != tt.want {
+			t.Errorf("%s: ConsumeJoinPass() = %v, %v, want %v", tt.name, consumed, err, tt.want)
+		}
+	}
+
+	mr.FastForward(2 * time.Minute)
+	if consumed, err := r.ConsumeJoinPass(ctx, "BRK001", "bob", "hash-b"); err != nil || consumed {
+		t.Errorf("ConsumeJoinPass() after the pass expired = %v, %v, want false", consumed, err)
+	}
+}
+
+func TestBreakouts(t *testing.T) {
+	ctx := context.Background()
+	r := testRDS(t)
+
+	for _, code := range []string{"BRK001", "BRK002"} {
+		if err := r.AddBreakout(ctx, "MAIN01", code); err != nil {
+			t.Fatalf("AddBreakout(%s) = %v", code, err)
+		}
+	}
+	if err := r.RemoveBreakout(ctx, "MAIN01", "BRK001"); err != nil {
+		t.Fatalf("RemoveBreakout() = %v", err)
+	}
+	breakouts, err := r.GetBreakouts(ctx, "MAIN01")
+	if err != nil || len(breakouts) != 1 || breakouts[0] != "BRK002" {
+		t.Errorf("GetBreakouts() = %v, %v, want [BRK002]", breakouts, err)
+	}
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+// chatKey holds a list of the room's most recent chat messages, oldest first
+func (r *RDS) chatKey(roomCode string) string {
+	return r.keyPrefix + "room:" + roomCode + ":chat"
+}
+
+func (r *RDS) AddChatMessage(ctx context.Context, roomCode string, message *models.ChatMessage, historySize int) error {
+	marshalledMessage, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	pipe := r.cli.TxPipeline()
+	pipe.RPush(ctx, r.chatKey(roomCode), marshalledMessage)
+	pipe.LTrim(ctx, r.chatKey(roomCode), int64(-historySize), -1)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (r *RDS) GetChatMessages(ctx context.Context, roomCode string, count int) ([]*models.ChatMessage, error) {
+	marshalledMessages, err := r.cli.LRange(ctx, r.chatKey(roomCode), int64(-count), -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*models.ChatMessage, 0, len(marshalledMessages))
+	for _, marshalledMessage := range marshalledMessages {
+		var message models.ChatMessage
+		if err := json.Unmarshal([]byte(marshalledMessage), &message); err != nil {
+			return nil, err
+		}
+		messages = append(messages, &message)
+	}
+	return messages, nil
+}
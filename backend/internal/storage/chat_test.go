@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+func TestChatHistory(t *testing.T) {
+	ctx := context.Background()
+	r := testRDS(t)
+
+	for i := range 5 {
+		message := &models.ChatMessage{ID: fmt.Sprint(i), Name: "alice", Text: fmt.Sprintf("message %d", i)}
+		if err := r.AddChatMessage(ctx, "ABC123", message, 3); err != nil {
+			t.Fatalf("AddChatMessage() = %v", err)
+		}
+	}
+
+	tests := []struct {
+		count int
+		want  []string
+	}{
+		{count: 2, want: []string{"3", "4"}},
+		// only the history size is kept
+		{count: 10, want: []string{"2", "3", "4"}},
+	}
+	for _, tt := range tests {
+		messages, err := r.GetChatMessages(ctx, "ABC123", tt.count)
+		if err != nil {
+			t.Fatalf("GetChatMessages(%d) = %v", tt.count, err)
+		}
+		var ids []string
+		for _, message := range messages {
+			ids = append(ids, message.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+			t.Errorf("GetChatMessages(%d) = %v, want %v oldest first", tt.count, ids, tt.want)
+		}
+	}
+}
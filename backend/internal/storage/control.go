@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// grantControlScript maps controller ARGV[2] to presenter ARGV[1], dropping the presenter's
+// previous controller. It returns false if the controller controls another presenter.
+var grantControlScript = redis.NewScript(`
+local current = redis.call("HGET", KEYS[1], ARGV[2])
+if current and current ~= ARGV[1] then
+	return false
+end
+local previous = ""
+local controls = redis.call("HGETALL", KEYS[1])
+for i = 1, #controls, 2 do
+	if controls[i + 1] == ARGV[1] and controls[i] ~= ARGV[2] then
+		previous = controls[i]
+		redis.call("HDEL", KEYS[1], previous)
+	end
+end
+redis.call("HSET", KEYS[1], ARGV[2], ARGV[1])
+return previous
+`)
+
+// revokeControlScript removes and returns the controller of presenter ARGV[1]
+var revokeControlScript = redis.NewScript(`
+local controls = redis.call("HGETALL", KEYS[1])
+for i = 1, #controls, 2 do
+	if controls[i + 1] == ARGV[1] then
+		redis.call("HDEL", KEYS[1], controls[i])
+		return controls[i]
+	end
+end
+return ""
+`)
+
+// releaseControlScript removes controller ARGV[1] and returns the presenter it controlled
+var releaseControlScript = redis.NewScript(`
+local presenter = redis.call("HGET", KEYS[1], ARGV[1])
+if not presenter then
+	return ""
+end
+redis.call("HDEL", KEYS[1], ARGV[1])
+return presenter
+`)
+
+// controlKey holds a hash of controller name to the name of the presenter they control
+func (r *RDS) controlKey(roomCode string) string {
+	return r.keyPrefix + "room:" + roomCode + ":control"
+}
+
+func (r *RDS) GrantControl(ctx context.Context, roomCode, presenter, controller string) (string, error) {
+	previous, err := grantControlScript.Run(ctx, r.cli, []string{r.controlKey(roomCode)}, presenter, controller).Text()
+	if err == redis.Nil {
+		return "", ErrAlreadyControlling
+	}
+	return previous, err
+}
+
+func (r *RDS) RevokeControl(ctx context.Context, roomCode, presenter string) (string, error) {
+	return revokeControlScript.Run(ctx, r.cli, []string{r.controlKey(roomCode)}, presenter).Text()
+}
+
+func (r *RDS) ReleaseControl(ctx context.Context, roomCode, controller string) (string, error) {
+	return releaseControlScript.Run(ctx, r.cli, []string{r.controlKey(roomCode)}, controller).Text()
+}
+
+func (r *RDS) GetControlledPresenter(ctx context.Context, roomCode, controller string) (string, error) {
+	presenter, err := r.cli.HGet(ctx, r.controlKey(roomCode), controller).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return presenter, err
+}
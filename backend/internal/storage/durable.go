@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/audit"
+	"github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserExists is returned when creating a user whose email or external identity is already taken
+	ErrUserExists = errors.New("user already exists")
+	// ErrSessionNotFound is returned for auth sessions that don't exist or have expired
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// The stores below keep what has to outlive Redis, which only holds what is live in a room.
+// The postgres package implements all of them.
+
+// RoomStore keeps persistent rooms so they survive Redis being flushed or restarted, and the
+// rooms of signed-in users so they can list them
+type RoomStore interface {
+	// SaveRoom creates or replaces a saved room
+	SaveRoom(ctx context.Context, room *models.Room) error
+	// GetSavedRoom returns ErrRoomNotFound for rooms that were never saved or were deleted
+	GetSavedRoom(ctx context.Context, roomCode string) (*models.Room, error)
+	DeleteSavedRoom(ctx context.Context, roomCode string) error
+	// ListOwnedRooms returns the saved rooms of the user, newest first
+	ListOwnedRooms(ctx context.Context, ownerID string) ([]*models.Room, error)
+}
+
+type UserStore interface {
+	// CreateUser fills in the user's ID and timestamps, ErrUserExists is returned if the email is taken
+	CreateUser(ctx context.Context, user *models.User) error
+	// GetUser and GetUserByEmail return ErrUserNotFound for unknown users
+	GetUser(ctx context.Context, id string) (*models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	UpdateUser(ctx context.Context, user *models.User) error
+
+	// CreateUserWithIdentity creates a user linked to the subject of an external identity provider,
+	// ErrUserExists is returned if the identity is already linked
+	CreateUserWithIdentity(ctx context.Context, user *models.User, issuer, subject string) error
+	// GetUserByIdentity returns ErrUserNotFound for identities that aren't linked to a user
+	GetUserByIdentity(ctx context.Context, issuer, subject string) (*models.User, error)
+
+	// CreateAuthSession signs the user in until expiresAt with the token whose hash is given
+	CreateAuthSession(ctx context.Context, tokenHash, userID string, expiresAt time.Time) error
+	// GetAuthSession returns the signed-in user, ErrSessionNotFound if the session doesn't exist or expired
+	GetAuthSession(ctx context.Context, tokenHash string) (*models.User, error)
+	DeleteAuthSession(ctx context.Context, tokenHash string) error
+	// DeleteOtherAuthSessions signs the user out everywhere but the session whose token hash is given
+	DeleteOtherAuthSessions(ctx context.Context, userID, keepTokenHash string) error
+}
+
+// AuditStore is an audit log sink that can be queried
+type AuditStore interface {
+	AppendAuditEntry(ctx context.Context, entry *audit.Entry) error
+	// QueryAuditEntries follows audit.Querier, it returns one entry more than the limit when there are more
+	QueryAuditEntries(ctx context.Context, filter audit.Filter) ([]*audit.Entry, error)
+}
+
+type RecordingStore interface {
+	// SaveRecording creates or replaces the metadata of a recording
+	SaveRecording(ctx context.Context, recording *models.Recording) error
+	// ListRecordings returns the recordings of a room, oldest first
+	ListRecordings(ctx context.Context, roomCode string) ([]models.Recording, error)
+}
+
+// ChatStore keeps the chat history of every room, Redis only keeps the latest messages of live rooms
+type ChatStore interface {
+	SaveChatMessage(ctx context.Context, roomCode string, message *models.ChatMessage) error
+	// GetChatHistory returns up to limit messages sent before before, oldest first. A zero before
+	// returns the latest messages.
+	GetChatHistory(ctx context.Context, roomCode string, before time.Time, limit int) ([]*models.ChatMessage, error)
+}
+
+const (
+	// chatWriteQueue bounds how many chat messages wait to be saved, more are dropped
+	chatWriteQueue = 1000
+	// chatWriteTimeout bounds how long saving a chat message may take
+	chatWriteTimeout = 5 * time.Second
+)
+
+// chatWrite is a chat message waiting to be saved
+type chatWrite struct {
+	roomCode string
+	message  *models.ChatMessage
+}
+
+// Durable saves persistent rooms, the rooms of signed-in users and chat messages to their stores
+// on top of a Storage. Persistent rooms missing from the Storage are restored the first time they
+// are looked up. Chat messages are saved in the background, so the stores never hold up or fail
+// live chat.
+type Durable struct {
+	Storage
+	rooms      RoomStore
+	chat       ChatStore
+	chatWrites chan chatWrite
+	logger     *log.Logger
+}
+
+func NewDurable(s Storage, rooms RoomStore, chat ChatStore, logger *log.Logger) *Durable {
+	d := &Durable{
+		Storage:    s,
+		rooms:      rooms,
+		chat:       chat,
+		chatWrites: make(chan chatWrite, chatWriteQueue),
+		logger:     logger,
+	}
+	go d.saveChatMessages()
+	return d
+}
+
+// saveChatMessages saves the queued chat messages in order, messages that fail are dropped
+func (d *Durable) saveChatMessages() {
+	for write := range d.chatWrites {
+		ctx, cancel := context.WithTimeout(context.Background(), chatWriteTimeout)
+		if err := d.chat.SaveChatMessage(ctx, write.roomCode, write.message); err != nil {
+			d.logger.Printf("Failed to save chat message %s of room %s: %v", write.message.ID, write.roomCode, err)
+		}
+		cancel()
+	}
+}
+
+// saves reports whether the room is kept in the RoomStore
+func saves(room *models.Room) bool {
+	return room.Flags.Persistent || room.OwnerID != ""
+}
+
+func (d *Durable) CreateRoom(ctx context.Context, room *models.Room) (bool, error) {
+	// a persistent room that hasn't been restored yet still holds its code
+	if saved, err := d.rooms.GetSavedRoom(ctx, room.Code); err == nil && saved.Flags.Persistent {
+		return false, nil
+	} else if err != nil && !errors.Is(err, ErrRoomNotFound) {
+		return false, err
+	}
+
+	created, err := d.Storage.CreateRoom(ctx, room)
+	if err != nil || !created || !saves(room) {
+		return created, err
+	}
+	if err := d.rooms.SaveRoom(ctx, room); err != nil {
+		// a persistent room that can't be saved would be lost later
+		d.Storage.DeleteRoom(ctx, room.Code)
+		return false, err
+	}
+	return true, nil
+}
+
+func (d *Durable) UpdateRoom(ctx context.Context, roomCode string, update func(room *models.Room) error) (*models.Room, error) {
+	room, err := d.Storage.UpdateRoom(ctx, roomCode, update)
+	if err != nil || !saves(room) {
+		return room, err
+	}
+	return room, d.rooms.SaveRoom(ctx, room)
+}
+
+func (d *Durable) DeleteRoom(ctx context.Context, roomCode string) (bool, error) {
+	deleted, err := d.Storage.DeleteRoom(ctx, roomCode)
+	if err != nil {
+		return false, err
+	}
+	return deleted, d.rooms.DeleteSavedRoom(ctx, roomCode)
+}
+
+func (d *Durable) IsRoomActive(ctx context.Context, roomCode string) (bool, error) {
+	active, err := d.Storage.IsRoomActive(ctx, roomCode)
+	if err != nil || active {
+		return active, err
+	}
+	return d.restoreRoom(ctx, roomCode)
+}
+
+func (d *Durable) GetRoom(ctx context.Context, roomCode string) (*models.Room, error) {
+	room, err := d.Storage.GetRoom(ctx, roomCode)
+	if !errors.Is(err, ErrRoomNotFound) {
+		return room, err
+	}
+	restored, restoreErr := d.restoreRoom(ctx, roomCode)
+	if restoreErr != nil {
+		return nil, restoreErr
+	}
+	if !restored {
+		return nil, err
+	}
+	return d.Storage.GetRoom(ctx, roomCode)
+}
+
+func (d *Durable) CanUserJoinRoom(ctx context.Context, roomCode, name, role string, moved bool) error {
+	if _, err := d.IsRoomActive(ctx, roomCode); err != nil {
+		return err
+	}
+	return d.Storage.CanUserJoinRoom(ctx, roomCode, name, role, moved)
+}
+
+// restoreRoom copies a saved persistent room back to the Storage and reports whether there was one.
+// Other saved rooms ended when they left the Storage.
+func (d *Durable) restoreRoom(ctx context.Context, roomCode string) (bool, error) {
+	room, err := d.rooms.GetSavedRoom(ctx, roomCode)
+	if errors.Is(err, ErrRoomNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !room.Flags.Persistent {
+		return false, nil
+	}
+	// another instance may restore it at the same time, either copy will do
+	if _, err := d.Storage.CreateRoom(ctx, room); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (d *Durable) AddChatMessage(ctx context.Context, roomCode string, message *models.ChatMessage, historySize int) error {
+	if err := d.Storage.AddChatMessage(ctx, roomCode, message, historySize); err != nil {
+		return err
+	}
+	select {
+	case d.chatWrites <- chatWrite{roomCode: roomCode, message: message}:
+	default:
+		d.logger.Printf("Dropped chat message %s of room %s, too many are waiting to be saved", message.ID, roomCode)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+// memoryRooms is a RoomStore kept in memory
+type memoryRooms struct {
+	mu    sync.Mutex
+	rooms map[string]*models.Room
+}
+
+func (m *memoryRooms) SaveRoom(ctx context.Context, room *models.Room) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	saved := *room
+	m.rooms[room.Code] = &saved
+	return nil
+}
+
+func (m *memoryRooms) GetSavedRoom(ctx context.Context, roomCode string) (*models.Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	room, ok := m.rooms[roomCode]
+	if !ok {
+		return nil, ErrRoomNotFound
+	}
+	saved := *room
+	return &saved, nil
+}
+
+func (m *memoryRooms) DeleteSavedRoom(ctx context.Context, roomCode string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.rooms, roomCode)
+	return nil
+}
+
+func (m *memoryRooms) ListOwnedRooms(ctx context.Context, ownerID string) ([]*models.Room, error) {
+	return nil, nil
+}
+
+// memoryChat is a ChatStore that hands every saved message to saved
+type memoryChat struct {
+	saved chan *models.ChatMessage
+}
+
+func (m *memoryChat) SaveChatMessage(ctx context.Context, roomCode string, message *models.ChatMessage) error {
+	m.saved <- message
+	return nil
+}
+
+func (m *memoryChat) GetChatHistory(ctx context.Context, roomCode string, before time.Time, limit int) ([]*models.ChatMessage, error) {
+	return nil, nil
+}
+
+func testDurable(t *testing.T) (*Durable, *RDS, *memoryRooms, *memoryChat) {
+	t.Helper()
+	r := testRDS(t)
+	rooms := &memoryRooms{rooms: make(map[string]*models.Room)}
+	chat := &memoryChat{saved: make(chan *models.ChatMessage, 1)}
+	return NewDurable(r, rooms, chat, log.New(io.Discard, "", 0)), r, rooms, chat
+}
+
+func TestDurableRestoresPersistentRooms(t *testing.T) {
+	ctx := context.Background()
+	d, r, rooms, _ := testDurable(t)
+
+	persistent := &models.Room{Code: "DAILY1", Capacity: 4, Flags: models.RoomFlags{Persistent: true}}
+	owned := &models.Room{Code: "OWNED1", Capacity: 4, OwnerID: "user-1"}
+	for _, room := range []*models.Room{persistent, owned} {
+		if created, err := d.CreateRoom(ctx, room); err != nil || !created {
+			t.Fatalf("CreateRoom(%s) = %v, %v", room.Code, created, err)
+		}
+	}
+
+	// Redis loses both rooms, as it would when flushed or restarted without persistence
+	for _, code := range []string{persistent.Code, owned.Code} {
+		if _, err := r.DeleteRoom(ctx, code); err != nil {
+			t.Fatalf("DeleteRoom(%s) = %v", code, err)
+		}
+	}
+
+	// the persistent room holds its code until it is restored
+	if created, err := d.CreateRoom(ctx, &models.Room{Code: "DAILY1", Capacity: 2}); err != nil || created {
+		t.Errorf("CreateRoom() over a saved persistent room = %v, %v, want false", created, err)
+	}
+	if active, err := d.IsRoomActive(ctx, "DAILY1"); err != nil || !active {
+		t.Errorf("IsRoomActive(DAILY1) = %v, %v, want it restored", active, err)
+	}
+	if room, err := r.GetRoom(ctx, "DAILY1"); err != nil || room.Capacity != 4 {
+		t.Errorf("restored room = %+v, %v, want the saved room", room, err)
+	}
+	// other saved rooms end with Redis
+	if active, err := d.IsRoomActive(ctx, "OWNED1"); err != nil || active {
+		t.Errorf("IsRoomActive(OWNED1) = %v, %v, want false", active, err)
+	}
+
+	if _, err := d.DeleteRoom(ctx, "DAILY1"); err != nil {
+		t.Fatalf("DeleteRoom() = %v", err)
+	}
+	if _, err := rooms.GetSavedRoom(ctx, "DAILY1"); !errors.Is(err, ErrRoomNotFound) {
+		t.Errorf("GetSavedRoom() after DeleteRoom = %v, want ErrRoomNotFound", err)
+	}
+}
+
+func TestDurableSavesChatMessages(t *testing.T) {
+	ctx := context.Background()
+	d, r, _, chat := testDurable(t)
+
+	message := &models.ChatMessage{ID: "1", Name: "alice", Text: "hello"}
+	if err := d.AddChatMessage(ctx, "ABC123", message, 10); err != nil {
+		t.Fatalf("AddChatMessage() = %v", err)
+	}
+	if live, err := r.GetChatMessages(ctx, "ABC123", 10); err != nil || len(live) != 1 {
+		t.Errorf("GetChatMessages() = %v, %v, want the message in Redis", live, err)
+	}
+
+	select {
+	case saved := <-chat.saved:
+		if saved.ID != message.ID {
+			t.Errorf("saved message %s, want %s", saved.ID, message.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the message was never saved to the chat store")
+	}
+}
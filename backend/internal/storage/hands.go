@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// handsKey holds a hash of member name to when they raised their hand
+func (r *RDS) handsKey(roomCode string) string {
+	return r.keyPrefix + "room:" + roomCode + ":hands"
+}
+
+func (r *RDS) RaiseHand(ctx context.Context, roomCode, name string, raisedAt time.Time) error {
+	// raising an already raised hand keeps its place in line
+	return r.cli.HSetNX(ctx, r.handsKey(roomCode), name, raisedAt.Format(time.RFC3339Nano)).Err()
+}
+
+func (r *RDS) LowerHand(ctx context.Context, roomCode, name string) (bool, error) {
+	deleted, err := r.cli.HDel(ctx, r.handsKey(roomCode), name).Result()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, nil
+}
+
+func (r *RDS) GetRaisedHands(ctx context.Context, roomCode string) (map[string]time.Time, error) {
+	raisedHands, err := r.cli.HGetAll(ctx, r.handsKey(roomCode)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	hands := make(map[string]time.Time, len(raisedHands))
+	for name, raisedAt := range raisedHands {
+		t, err := time.Parse(time.RFC3339Nano, raisedAt)
+		if err != nil {
+			return nil, err
+		}
+		hands[name] = t
+	}
+	return hands, nil
+}
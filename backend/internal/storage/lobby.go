@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+
+	"github.com/AnishG-git/streamify/internal/storage/models"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// lobbyKey holds a hash of the room's knocks by name
+func (r *RDS) lobbyKey(roomCode string) string {
+	return r.keyPrefix + "room:" + roomCode + ":lobby"
+}
+
+func (r *RDS) AddKnock(ctx context.Context, roomCode string, knock *models.Knock) (bool, error) {
+	marshalledKnock, err := json.Marshal(knock)
+	if err != nil {
+		return false, err
+	}
+	return r.cli.HSetNX(ctx, r.lobbyKey(roomCode), knock.Name, marshalledKnock).Result()
+}
+
+func (r *RDS) RemoveKnock(ctx context.Context, roomCode, name string) (*models.Knock, error) {
+	// reading and deleting in one transaction makes sure only one caller gets the knock
+	pipe := r.cli.TxPipeline()
+	get := pipe.HGet(ctx, r.lobbyKey(roomCode), name)
+	pipe.HDel(ctx, r.lobbyKey(roomCode), name)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	marshalledKnock, err := get.Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var knock models.Knock
+	if err := json.Unmarshal(marshalledKnock, &knock); err != nil {
+		return nil, err
+	}
+	return &knock, nil
+}
+
+func (r *RDS) GetKnocks(ctx context.Context, roomCode string) ([]*models.Knock, error) {
+	marshalledKnocks, err := r.cli.HVals(ctx, r.lobbyKey(roomCode)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	knocks := make([]*models.Knock, 0, len(marshalledKnocks))
+	for _, marshalledKnock := range marshalledKnocks {
+		var knock models.Knock
+		if err := json.Unmarshal([]byte(marshalledKnock), &knock); err != nil {
+			return nil, err
+		}
+		knocks = append(knocks, &knock)
+	}
+	slices.SortFunc(knocks, func(a, b *models.Knock) int {
+		return a.KnockedAt.Compare(b.KnockedAt)
+	})
+	return knocks, nil
+}
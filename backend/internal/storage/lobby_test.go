@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+func TestLobby(t *testing.T) {
+	ctx := context.Background()
+	r := testRDS(t)
+	now := time.Now()
+
+	knocks := []*models.Knock{
+		{Name: "bob", ConnectionID: "conn-bob", KnockedAt: now.Add(time.Second)},
+		{Name: "alice", ConnectionID: "conn-alice", KnockedAt: now},
+		// a second knock from the same member doesn't replace the first
+		{Name: "bob", ConnectionID: "conn-bob-2", KnockedAt: now.Add(2 * time.Second)},
+	}
+	for i, knock := range knocks {
+		added, err := r.AddKnock(ctx, "ABC123", knock)
+		if err != nil {
+			t.Fatalf("AddKnock(%s) = %v", knock.Name, err)
+		}
+		if want := i < 2; added != want {
+			t.Errorf("AddKnock(%s) #%d = %v, want %v", knock.Name, i, added, want)
+		}
+	}
+
+	waiting, err := r.GetKnocks(ctx, "ABC123")
+	if err != nil {
+		t.Fatalf("GetKnocks() = %v", err)
+	}
+	if len(waiting) != 2 || waiting[0].Name != "alice" || waiting[1].ConnectionID != "conn-bob" {
+		t.Fatalf("GetKnocks() = %+v, want alice then bob's first knock", waiting)
+	}
+
+	// only one of the hosts admitting or denying bob at once gets the knock
+	knock, err := r.RemoveKnock(ctx, "ABC123", "bob")
+	if err != nil || knock == nil || knock.ConnectionID != "conn-bob" {
+		t.Errorf("RemoveKnock(bob) = %+v, %v, want bob's knock", knock, err)
+	}
+	if knock, err := r.RemoveKnock(ctx, "ABC123", "bob"); err != nil || knock != nil {
+		t.Errorf("second RemoveKnock(bob) = %+v, %v, want nil", knock, err)
+	}
+}
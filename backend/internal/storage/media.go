@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/AnishG-git/streamify/internal/storage/models"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// claimPresenterScript sets the presenter unless one is set or members are queued (KEYS[2]),
+// and returns the presenter either way
+var claimPresenterScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if current then
+	return current
+end
+if redis.call("LLEN", KEYS[2]) > 0 then
+	return ""
+end
+redis.call("SET", KEYS[1], ARGV[1])
+return ARGV[1]
+`)
+
+// releasePresenterScript deletes the presenter only if it is still ARGV[1]
+var releasePresenterScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// grantPresenterScript moves ARGV[1] from the queue (KEYS[2]) to the presenter slot and returns the previous presenter
+var grantPresenterScript = redis.NewScript(`
+redis.call("LREM", KEYS[2], 0, ARGV[1])
+local previous = redis.call("GET", KEYS[1])
+redis.call("SET", KEYS[1], ARGV[1])
+return previous or ""
+`)
+
+// enqueuePresenterScript appends ARGV[1] to the queue unless it is already queued or presenting
+var enqueuePresenterScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] or redis.call("LPOS", KEYS[2], ARGV[1]) then
+	return 0
+end
+redis.call("RPUSH", KEYS[2], ARGV[1])
+return 1
+`)
+
+// advancePresenterScript pops the head of the queue into the presenter slot if the slot is free
+var advancePresenterScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return ""
+end
+local next = redis.call("LPOP", KEYS[2])
+if not next then
+	return ""
+end
+redis.call("SET", KEYS[1], next)
+return next
+`)
+
+// mediaKey holds a hash of member name to media state
+func (r *RDS) mediaKey(roomCode string) string {
+	return r.keyPrefix + "room:" + roomCode + ":media"
+}
+
+// presenterKey holds the name of the member presenting in a single presenter room
+func (r *RDS) presenterKey(roomCode string) string {
+	return r.keyPrefix + "room:" + roomCode + ":presenter"
+}
+
+// presenterQueueKey holds a list of member names waiting to present, first in line first
+func (r *RDS) presenterQueueKey(roomCode string) string {
+	return r.keyPrefix + "room:" + roomCode + ":presenter-queue"
+}
+
+func (r *RDS) SetMediaState(ctx context.Context, roomCode, name string, state *models.MediaState) error {
+	marshalledState, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return r.cli.HSet(ctx, r.mediaKey(roomCode), name, marshalledState).Err()
+}
+
+func (r *RDS) RemoveMediaState(ctx context.Context, roomCode, name string) error {
+	return r.cli.HDel(ctx, r.mediaKey(roomCode), name).Err()
+}
+
+func (r *RDS) GetMediaStates(ctx context.Context, roomCode string) (map[string]*models.MediaState, error) {
+	marshalledStates, err := r.cli.HGetAll(ctx, r.mediaKey(roomCode)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]*models.MediaState, len(marshalledStates))
+	for name, marshalledState := range marshalledStates {
+		var state models.MediaState
+		if err := json.Unmarshal([]byte(marshalledState), &state); err != nil {
+			return nil, err
+		}
+		states[name] = &state
+	}
+	return states, nil
+}
+
+func (r *RDS) ClaimPresenter(ctx context.Context, roomCode, name string) (string, error) {
+	keys := []string{r.presenterKey(roomCode), r.presenterQueueKey(roomCode)}
+	return claimPresenterScript.Run(ctx, r.cli, keys, name).Text()
+}
+
+func (r *RDS) ReleasePresenter(ctx context.Context, roomCode, name string) (bool, error) {
+	deleted, err := releasePresenterScript.Run(ctx, r.cli, []string{r.presenterKey(roomCode)}, name).Int()
+	if err != nil {
+		return false, err
+	}
+	return deleted == 1, nil
+}
+
+func (r *RDS) GetPresenter(ctx context.Context, roomCode string) (string, error) {
+	presenter, err := r.cli.Get(ctx, r.presenterKey(roomCode)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return presenter, err
+}
+
+func (r *RDS) GrantPresenter(ctx context.Context, roomCode, name string) (string, error) {
+	keys := []string{r.presenterKey(roomCode), r.presenterQueueKey(roomCode)}
+	return grantPresenterScript.Run(ctx, r.cli, keys, name).Text()
+}
+
+func (r *RDS) EnqueuePresenter(ctx context.Context, roomCode, name string) (bool, error) {
+	keys := []string{r.presenterKey(roomCode), r.presenterQueueKey(roomCode)}
+	added, err := enqueuePresenterScript.Run(ctx, r.cli, keys, name).Int()
+	if err != nil {
+		return false, err
+	}
+	return added == 1, nil
+}
+
+func (r *RDS) DequeuePresenter(ctx context.Context, roomCode, name string) (bool, error) {
+	removed, err := r.cli.LRem(ctx, r.presenterQueueKey(roomCode), 0, name).Result()
+	if err != nil {
+		return false, err
+	}
+	return removed > 0, nil
+}
+
+func (r *RDS) AdvancePresenterQueue(ctx context.Context, roomCode string) (string, error) {
+	keys := []string{r.presenterKey(roomCode), r.presenterQueueKey(roomCode)}
+	return advancePresenterScript.Run(ctx, r.cli, keys).Text()
+}
+
+func (r *RDS) GetPresenterQueue(ctx context.Context, roomCode string) ([]string, error) {
+	return r.cli.LRange(ctx, r.presenterQueueKey(roomCode), 0, -1).Result()
+}
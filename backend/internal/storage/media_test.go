@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+func TestMediaStates(t *testing.T) {
+	ctx := context.Background()
+	r := testRDS(t)
+
+	if err := r.SetMediaState(ctx, "ABC123", "alice", &models.MediaState{Mic: true}); err != nil {
+		t.Fatalf("SetMediaState() = %v", err)
+	}
+	if err := r.SetMediaState(ctx, "ABC123", "alice", &models.MediaState{Screen: true, Width: 1920, Height: 1080}); err != nil {
+		t.Fatalf("SetMediaState() = %v", err)
+	}
+	if err := r.SetMediaState(ctx, "ABC123", "bob", &models.MediaState{Camera: true}); err != nil {
+		t.Fatalf("SetMediaState() = %v", err)
+	}
+	if err := r.RemoveMediaState(ctx, "ABC123", "bob"); err != nil {
+		t.Fatalf("RemoveMediaState() = %v", err)
+	}
+
+	states, err := r.GetMediaStates(ctx, "ABC123")
+	if err != nil {
+		t.Fatalf("GetMediaStates() = %v", err)
+	}
+	if len(states) != 1 {
+		t.Fatalf("GetMediaStates() = %v, want only alice", states)
+	}
+	if alice := states["alice"]; alice == nil || alice.Mic || !alice.Screen || alice.Width != 1920 {
+		t.Errorf("alice's state = %+v, want the latest state", alice)
+	}
+}
+
+func TestClaimPresenter(t *testing.T) {
+	ctx := context.Background()
+	r := testRDS(t)
+
+	if presenter, err := r.ClaimPresenter(ctx, "ABC123", "alice"); err != nil || presenter != "alice" {
+		t.Fatalf("ClaimPresenter(alice) = %q, %v, want alice", presenter, err)
+	}
+	if presenter, err := r.ClaimPresenter(ctx, "ABC123", "bob"); err != nil || presenter != "alice" {
+		t.Errorf("ClaimPresenter(bob) = %q, %v, want alice to keep presenting", presenter, err)
+	}
+	if released, err := r.ReleasePresenter(ctx, "ABC123", "bob"); err != nil || released {
+		t.Errorf("ReleasePresenter(bob) = %v, %v, want false", released, err)
+	}
+	if released, err := r.ReleasePresenter(ctx, "ABC123", "alice"); err != nil || !released {
+		t.Errorf("ReleasePresenter(alice) = %v, %v, want true", released, err)
+	}
+	if presenter, err := r.GetPresenter(ctx, "ABC123"); err != nil || presenter != "" {
+		t.Errorf("GetPresenter() = %q, %v, want nobody", presenter, err)
+	}
+}
+
+func TestPresenterQueue(t *testing.T) {
+	ctx := context.Background()
+	r := testRDS(t)
+
+	if _, err := r.ClaimPresenter(ctx, "ABC123", "alice"); err != nil {
+		t.Fatalf("ClaimPresenter() = %v", err)
+	}
+	for _, name := range []string{"bob", "carol", "bob", "alice"} {
+		if _, err := r.EnqueuePresenter(ctx, "ABC123", name); err != nil {
+			t.Fatalf("EnqueuePresenter(%s) = %v", name, err)
+		}
+	}
+	// the presenter and members already queued aren't queued again
+	if queue, err := r.GetPresenterQueue(ctx, "ABC123"); err != nil || len(queue) != 2 || queue[0] != "bob" || queue[1] != "carol" {
+		t.Fatalf("GetPresenterQueue() = %v, %v, want [bob carol]", queue, err)
+	}
+
+	if next, err := r.AdvancePresenterQueue(ctx, "ABC123"); err != nil || next != "" {
+		t.Errorf("AdvancePresenterQueue() while alice presents = %q, %v, want nobody", next, err)
+	}
+	if _, err := r.ReleasePresenter(ctx, "ABC123", "alice"); err != nil {
+		t.Fatalf("ReleasePresenter() = %v", err)
+	}
+	// a free slot goes to the head of the queue, not to whoever claims it first
+	if presenter, err := r.ClaimPresenter(ctx, "ABC123", "dave"); err != nil || presenter != "" {
+		t.Errorf("ClaimPresenter(dave) with a queue = %q, %v, want nobody", presenter, err)
+	}
+	if next, err := r.AdvancePresenterQueue(ctx, "ABC123"); err != nil || next != "bob" {
+		t.Errorf("AdvancePresenterQueue() = %q, %v, want bob", next, err)
+	}
+
+	// the host may grant out of order
+	if previous, err := r.GrantPresenter(ctx, "ABC123", "carol"); err != nil || previous != "bob" {
+		t.Errorf("GrantPresenter(carol) = %q, %v, want bob as the previous presenter", previous, err)
+	}
+	if queue, err := r.GetPresenterQueue(ctx, "ABC123"); err != nil || len(queue) != 0 {
+		t.Errorf("GetPresenterQueue() = %v, %v, want it empty", queue, err)
+	}
+	if removed, err := r.DequeuePresenter(ctx, "ABC123", "carol"); err != nil || removed {
+		t.Errorf("DequeuePresenter(carol) = %v, %v, want false", removed, err)
+	}
+}
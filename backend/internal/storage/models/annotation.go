@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+const (
+	// AnnotationStroke is a freehand line through its points
+	AnnotationStroke = "stroke"
+	// AnnotationShape is a shape spanning from its first to its second point
+	AnnotationShape = "shape"
+	// AnnotationClear removes every annotation before it
+	AnnotationClear = "clear"
+)
+
+// Annotation is a single operation in a room's annotation log
+type Annotation struct {
+	// Seq orders the log, it is assigned by storage when the annotation is appended
+	Seq    int64  `json:"seq"`
+	ID     string `json:"id"`
+	Kind   string `json:"kind"`
+	Author string `json:"author"`
+	// Points are x, y pairs relative to the shared screen, from 0 to 1
+	Points [][2]float64 `json:"points,omitempty"`
+	// Shape is one of line, arrow, rect and ellipse
+	Shape     string    `json:"shape,omitempty"`
+	Color     string    `json:"color,omitempty"`
+	Width     float64   `json:"width,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
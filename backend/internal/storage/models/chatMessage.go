@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// ChatMessage is a text message sent to everyone in a room. Name is the sender's key in the
+// room, DisplayName is what they are shown as.
+type ChatMessage struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName,omitempty"`
+	Text        string    `json:"text"`
+	SentAt      time.Time `json:"sentAt"`
+}
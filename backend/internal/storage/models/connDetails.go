@@ -1,6 +1,21 @@
 package models
 
+const (
+	// RoleHost is held by members who proved ownership of the room when connecting
+	RoleHost        = "host"
+	RoleParticipant = "participant"
+	// RoleViewer members watch the presenters without publishing and don't count against Capacity
+	RoleViewer = "viewer"
+)
+
 type ConnectionDetails struct {
 	ManagerID    string `json:"managerID"`
 	ConnectionID string `json:"connectionID"`
+	Role         string `json:"role,omitempty"`
+	// UserID is set for members who signed in, they are keyed by it instead of their name
+	UserID      string `json:"userID,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+	AvatarURL   string `json:"avatarURL,omitempty"`
+	// TokenHash is the hash of the member token, which proves membership to the room's HTTP endpoints
+	TokenHash string `json:"tokenHash,omitempty"`
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Knock is a request to join a room that waits in its lobby until a host decides on it
+type Knock struct {
+	// Name is the member's key in the room, the user ID of members who signed in
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	AvatarURL   string `json:"avatarUrl,omitempty"`
+	// Role is the role the member joins with once admitted
+	Role string `json:"role"`
+	// ManagerID and ConnectionID locate the waiting connection
+	ManagerID    string    `json:"managerID"`
+	ConnectionID string    `json:"connectionID"`
+	KnockedAt    time.Time `json:"knockedAt"`
+}
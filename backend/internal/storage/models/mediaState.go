@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// MediaState is what a member is currently publishing
+type MediaState struct {
+	Mic    bool `json:"mic"`
+	Camera bool `json:"camera"`
+	Screen bool `json:"screen"`
+	// Width, Height and FPS describe the screen share, zero when unknown
+	Width     int       `json:"width,omitempty"`
+	Height    int       `json:"height,omitempty"`
+	FPS       int       `json:"fps,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
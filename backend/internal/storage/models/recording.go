@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// RecordingTrack is a single published track written to its own file
+type RecordingTrack struct {
+	Participant string     `json:"participant"`
+	Kind        string     `json:"kind"`
+	Codec       string     `json:"codec"`
+	File        string     `json:"file"`
+	StartedAt   time.Time  `json:"startedAt"`
+	StoppedAt   *time.Time `json:"stoppedAt,omitempty"`
+}
+
+// Recording is the metadata of a recording, its files are kept by the instance that made it
+type Recording struct {
+	ID           string           `json:"id"`
+	RoomCode     string           `json:"roomCode"`
+	StartedBy    string           `json:"startedBy"`
+	StartedAt    time.Time        `json:"startedAt"`
+	StoppedAt    *time.Time       `json:"stoppedAt,omitempty"`
+	Participants []string         `json:"participants"`
+	Tracks       []RecordingTrack `json:"tracks"`
+}
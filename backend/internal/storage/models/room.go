@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+const (
+	// RoomModeMesh rooms relay signaling so peers connect to each other directly
+	RoomModeMesh = "mesh"
+	// RoomModeSFU rooms send media through the server's selective forwarding unit
+	RoomModeSFU = "sfu"
+)
+
+type Room struct {
+	Code      string    `json:"code"`
+	Title     string    `json:"title"`
+	Capacity  int       `json:"capacity"`
+	CreatedAt time.Time `json:"createdAt"`
+	CreatedBy string    `json:"createdBy"`
+	// OwnerID is the user ID of the signed-in user who created the room, they join it as host
+	OwnerID string `json:"ownerId,omitempty"`
+	// ViewerCapacity is how many viewers can join on top of Capacity, zero keeps viewers out
+	ViewerCapacity int `json:"viewerCapacity"`
+	// ParentCode is set on breakout rooms to the room they were opened from
+	ParentCode string `json:"parentCode,omitempty"`
+	// scheduled rooms can only be joined from StartsAt until EndsAt. StartsAt is nil for
+	// scheduled rooms that open right away, other rooms have neither.
+	StartsAt *time.Time `json:"startsAt,omitempty"`
+	EndsAt   *time.Time `json:"endsAt,omitempty"`
+	// only a hash of the owner token is stored, the token itself is handed out once on creation
+	OwnerTokenHash string       `json:"ownerTokenHash"`
+	Settings       RoomSettings `json:"settings"`
+	Flags          RoomFlags    `json:"flags"`
+}
+
+// RoomSettings are the options the room owner can change while the room is live
+type RoomSettings struct {
+	// locked rooms don't accept new members
+	Locked bool `json:"locked"`
+	// Mode is either RoomModeMesh or RoomModeSFU and can't be changed after creation
+	Mode string `json:"mode"`
+	// SinglePresenter rooms allow only one member to share their screen at a time
+	SinglePresenter bool `json:"singlePresenter"`
+	// AutoGrantPresenter hands the presenter slot to the next queued member without waiting for the host
+	AutoGrantPresenter bool `json:"autoGrantPresenter"`
+	// WaitingRoom holds everyone but the hosts in a lobby until a host admits them
+	WaitingRoom bool `json:"waitingRoom"`
+}
+
+// RoomFlags describe how the server manages the room's lifecycle
+type RoomFlags struct {
+	// persistent rooms are not deleted when the last user leaves
+	Persistent bool `json:"persistent"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+const (
+	// RoomEventEndWarning fires a while before a scheduled room ends
+	RoomEventEndWarning = "end-warning"
+	// RoomEventEnd fires when a scheduled room ends
+	RoomEventEnd = "end"
+)
+
+// RoomEvent is something that happens to a scheduled room at a set time
+type RoomEvent struct {
+	Kind     string    `json:"kind"`
+	RoomCode string    `json:"roomCode"`
+	At       time.Time `json:"at"`
+	// ClaimedUntil is when the claim on the event runs out and it can be claimed again
+	ClaimedUntil time.Time `json:"-"`
+}
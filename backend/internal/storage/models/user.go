@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// User is an account members can sign in with
+type User struct {
+	ID          string `json:"id"`
+	Email       string `json:"email,omitempty"`
+	DisplayName string `json:"displayName"`
+	AvatarURL   string `json:"avatarUrl,omitempty"`
+	// PasswordHash is the bcrypt hash of the user's password, empty for users without one
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
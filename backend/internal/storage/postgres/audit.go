@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/audit"
+	"github.com/google/uuid"
+)
+
+func (s *Store) AppendAuditEntry(ctx context.Context, entry *audit.Entry) error {
+	var details []byte
+	if len(entry.Details) > 0 {
+		var err error
+		details, err = json.Marshal(entry.Details)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO audit_entries (id, time, action, room_code, actor, target, role, ip, details)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		entry.ID, entry.Time, entry.Action, entry.RoomCode, entry.Actor, entry.Target, entry.Role, entry.IP, details)
+	return err
+}
+
+func (s *Store) QueryAuditEntries(ctx context.Context, filter audit.Filter) ([]*audit.Entry, error) {
+	// the cursor is the time and ID of the last entry of the previous page, which entries are ordered by
+	var afterTime time.Time
+	var afterID *string
+	if filter.After != "" {
+		at, id, ok := strings.Cut(filter.After, "|")
+		var err error
+		afterTime, err = time.Parse(time.RFC3339Nano, at)
+		if !ok || err != nil || uuid.Validate(id) != nil {
+			return nil, audit.ErrInvalidCursor
+		}
+		afterID = &id
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT id::text, time, action, room_code, actor, target, role, ip, details
+		FROM audit_entries
+		WHERE ($1::text = '' OR room_code = $1)
+			AND ($2::timestamptz IS NULL OR time >= $2)
+			AND ($3::timestamptz IS NULL OR time <= $3)
+			AND ($5::uuid IS NULL OR (time, id) > ($6::timestamptz, $5::uuid))
+		ORDER BY time, id
+		LIMIT $4`,
+		filter.RoomCode, nullTime(filter.From), nullTime(filter.To), filter.Max()+1, afterID, afterTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*audit.Entry
+	for rows.Next() {
+		var entry audit.Entry
+		var details []byte
+		err := rows.Scan(&entry.ID, &entry.Time, &entry.Action, &entry.RoomCode, &entry.Actor,
+			&entry.Target, &entry.Role, &entry.IP, &details)
+		if err != nil {
+			return nil, err
+		}
+		if details != nil {
+			if err := json.Unmarshal(details, &entry.Details); err != nil {
+				return nil, err
+			}
+		}
+		entry.Cursor = entry.Time.Format(time.RFC3339Nano) + "|" + entry.ID
+		entries = append(entries, &entry)
+	}
+	return entries, rows.Err()
+}
+
+// AuditSink returns the store as a sink of the audit log
+func (s *Store) AuditSink() audit.Sink {
+	return auditSink{store: s}
+}
+
+type auditSink struct {
+	store *Store
+}
+
+func (a auditSink) Write(ctx context.Context, entry *audit.Entry) error {
+	return a.store.AppendAuditEntry(ctx, entry)
+}
+
+func (a auditSink) Query(ctx context.Context, filter audit.Filter) ([]*audit.Entry, error) {
+	return a.store.QueryAuditEntries(ctx, filter)
+}
@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+func (s *Store) SaveChatMessage(ctx context.Context, roomCode string, message *models.ChatMessage) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO chat_messages (room_code, id, name, display_name, text, sent_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT DO NOTHING`,
+		roomCode, message.ID, message.Name, message.DisplayName, message.Text, message.SentAt)
+	return err
+}
+
+func (s *Store) GetChatHistory(ctx context.Context, roomCode string, before time.Time, limit int) ([]*models.ChatMessage, error) {
+	// the latest messages before before are read newest first and reversed
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, name, display_name, text, sent_at
+		FROM chat_messages
+		WHERE room_code = $1 AND ($2::timestamptz IS NULL OR sent_at < $2)
+		ORDER BY sent_at DESC, id DESC
+		LIMIT $3`, roomCode, nullTime(before), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []*models.ChatMessage{}
+	for rows.Next() {
+		var message models.ChatMessage
+		if err := rows.Scan(&message.ID, &message.Name, &message.DisplayName, &message.Text, &message.SentAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, &message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	slices.Reverse(messages)
+	return messages, nil
+}
@@ -0,0 +1,58 @@
+// Package postgres keeps what has to outlive a room in Postgres: persistent rooms, users, the
+// audit log, recording metadata and chat history. Store implements every durable store of the
+// storage package. Its tables are created by the goose migrations in backend/migrations.
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// uniqueViolation is the SQLSTATE of inserts that break a unique constraint
+const uniqueViolation = "23505"
+
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+// Open connects to the database at url, a URL or key=value connection string
+func Open(ctx context.Context, url string) (*Store, error) {
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return &Store{pool: pool}, nil
+}
+
+func (s *Store) Close() {
+	s.pool.Close()
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// nullTime stores zero times as NULL
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
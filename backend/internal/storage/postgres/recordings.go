@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+func (s *Store) SaveRecording(ctx context.Context, recording *models.Recording) error {
+	tracks, err := json.Marshal(recording.Tracks)
+	if err != nil {
+		return err
+	}
+	participants := recording.Participants
+	if participants == nil {
+		participants = []string{}
+	}
+	_, err = s.pool.Exec(ctx, `
+		INSERT INTO recordings (id, room_code, started_by, started_at, stopped_at, participants, tracks)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET
+			stopped_at = EXCLUDED.stopped_at,
+			participants = EXCLUDED.participants,
+			tracks = EXCLUDED.tracks`,
+		recording.ID, recording.RoomCode, recording.StartedBy, recording.StartedAt, recording.StoppedAt, participants, tracks)
+	return err
+}
+
+func (s *Store) ListRecordings(ctx context.Context, roomCode string) ([]models.Recording, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, room_code, started_by, started_at, stopped_at, participants, tracks
+		FROM recordings
+		WHERE room_code = $1
+		ORDER BY started_at`, roomCode)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recordings := []models.Recording{}
+	for rows.Next() {
+		var recording models.Recording
+		var tracks []byte
+		err := rows.Scan(&recording.ID, &recording.RoomCode, &recording.StartedBy, &recording.StartedAt,
+			&recording.StoppedAt, &recording.Participants, &tracks)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(tracks, &recording.Tracks); err != nil {
+			return nil, err
+		}
+		recordings = append(recordings, recording)
+	}
+	return recordings, rows.Err()
+}
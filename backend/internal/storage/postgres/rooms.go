@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/AnishG-git/streamify/internal/storage"
+	"github.com/AnishG-git/streamify/internal/storage/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const roomColumns = `code, title, capacity, viewer_capacity, created_by, created_at, parent_code,
+	starts_at, ends_at, owner_token_hash, settings, persistent, owner_id::text`
+
+func (s *Store) SaveRoom(ctx context.Context, room *models.Room) error {
+	settings, err := json.Marshal(room.Settings)
+	if err != nil {
+		return err
+	}
+	_, err = s.pool.Exec(ctx, `
+		INSERT INTO rooms (code, title, capacity, viewer_capacity, created_by, created_at, parent_code,
+			starts_at, ends_at, owner_token_hash, settings, persistent, owner_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (code) DO UPDATE SET
+			title = EXCLUDED.title,
+			capacity = EXCLUDED.capacity,
+			viewer_capacity = EXCLUDED.viewer_capacity,
+			created_by = EXCLUDED.created_by,
+			created_at = EXCLUDED.created_at,
+			parent_code = EXCLUDED.parent_code,
+			starts_at = EXCLUDED.starts_at,
+			ends_at = EXCLUDED.ends_at,
+			owner_token_hash = EXCLUDED.owner_token_hash,
+			settings = EXCLUDED.settings,
+			persistent = EXCLUDED.persistent,
+			owner_id = EXCLUDED.owner_id,
+			updated_at = now(),
+			deleted_at = NULL`,
+		room.Code, room.Title, room.Capacity, room.ViewerCapacity, room.CreatedBy, room.CreatedAt,
+		nullString(room.ParentCode), room.StartsAt, room.EndsAt, room.OwnerTokenHash, settings, room.Flags.Persistent,
+		nullString(room.OwnerID))
+	return err
+}
+
+func (s *Store) GetSavedRoom(ctx context.Context, roomCode string) (*models.Room, error) {
+	room, err := scanRoom(s.pool.QueryRow(ctx, `
+		SELECT `+roomColumns+`
+		FROM rooms
+		WHERE code = $1 AND deleted_at IS NULL`, roomCode))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("room %s: %w", roomCode, storage.ErrRoomNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// DeleteSavedRoom keeps the row for the record, it is replaced if the code is used again
+func (s *Store) DeleteSavedRoom(ctx context.Context, roomCode string) error {
+	_, err := s.pool.Exec(ctx, `UPDATE rooms SET deleted_at = now() WHERE code = $1 AND deleted_at IS NULL`, roomCode)
+	return err
+}
+
+func (s *Store) ListOwnedRooms(ctx context.Context, ownerID string) ([]*models.Room, error) {
+	rooms := []*models.Room{}
+	if _, err := uuid.Parse(ownerID); err != nil {
+		return rooms, nil
+	}
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+roomColumns+`
+		FROM rooms
+		WHERE owner_id = $1 AND deleted_at IS NULL
+		ORDER BY created_at DESC`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		room, err := scanRoom(rows)
+		if err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, rows.Err()
+}
+
+// scanRoom reads a row of roomColumns
+func scanRoom(row pgx.Row) (*models.Room, error) {
+	var room models.Room
+	var parentCode, ownerID *string
+	var settings []byte
+	err := row.Scan(
+		&room.Code, &room.Title, &room.Capacity, &room.ViewerCapacity, &room.CreatedBy, &room.CreatedAt, &parentCode,
+		&room.StartsAt, &room.EndsAt, &room.OwnerTokenHash, &settings, &room.Flags.Persistent, &ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if parentCode != nil {
+		room.ParentCode = *parentCode
+	}
+	if ownerID != nil {
+		room.OwnerID = *ownerID
+	}
+	if err := json.Unmarshal(settings, &room.Settings); err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
@@ -0,0 +1,49 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/storage"
+	"github.com/AnishG-git/streamify/internal/storage/models"
+	"github.com/google/uuid"
+)
+
+// CreateAuthSession also drops the user's expired sessions, so they don't pile up
+func (s *Store) CreateAuthSession(ctx context.Context, tokenHash, userID string, expiresAt time.Time) error {
+	if _, err := uuid.Parse(userID); err != nil {
+		return storage.ErrUserNotFound
+	}
+	if _, err := s.pool.Exec(ctx, `DELETE FROM auth_sessions WHERE user_id = $1 AND expires_at <= now()`, userID); err != nil {
+		return err
+	}
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO auth_sessions (token_hash, user_id, expires_at)
+		VALUES ($1, $2, $3)`, tokenHash, userID, expiresAt)
+	return err
+}
+
+func (s *Store) GetAuthSession(ctx context.Context, tokenHash string) (*models.User, error) {
+	user, err := s.getUser(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		WHERE id = (SELECT user_id FROM auth_sessions WHERE token_hash = $1 AND expires_at > now())`, tokenHash)
+	if errors.Is(err, storage.ErrUserNotFound) {
+		return nil, storage.ErrSessionNotFound
+	}
+	return user, err
+}
+
+func (s *Store) DeleteAuthSession(ctx context.Context, tokenHash string) error {
+	_, err := s.pool.Exec(ctx, `DELETE FROM auth_sessions WHERE token_hash = $1`, tokenHash)
+	return err
+}
+
+func (s *Store) DeleteOtherAuthSessions(ctx context.Context, userID, keepTokenHash string) error {
+	if _, err := uuid.Parse(userID); err != nil {
+		return storage.ErrUserNotFound
+	}
+	_, err := s.pool.Exec(ctx, `DELETE FROM auth_sessions WHERE user_id = $1 AND token_hash <> $2`, userID, keepTokenHash)
+	return err
+}
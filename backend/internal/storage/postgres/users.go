@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/storage"
+	"github.com/AnishG-git/streamify/internal/storage/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const userColumns = `id::text, COALESCE(email, ''), display_name, avatar_url, COALESCE(password_hash, ''), created_at, updated_at`
+
+func (s *Store) CreateUser(ctx context.Context, user *models.User) error {
+	now := time.Now().UTC()
+	user.ID = uuid.NewString()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO users (id, email, display_name, avatar_url, password_hash, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		user.ID, nullString(user.Email), user.DisplayName, user.AvatarURL, nullString(user.PasswordHash), now, now)
+	if isUniqueViolation(err) {
+		return storage.ErrUserExists
+	}
+	return err
+}
+
+// CreateUserWithIdentity creates the user and links the identity to them in one transaction
+func (s *Store) CreateUserWithIdentity(ctx context.Context, user *models.User, issuer, subject string) error {
+	now := time.Now().UTC()
+	user.ID = uuid.NewString()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO users (id, email, display_name, avatar_url, password_hash, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			user.ID, nullString(user.Email), user.DisplayName, user.AvatarURL, nullString(user.PasswordHash), now, now)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO user_identities (issuer, subject, user_id, created_at)
+			VALUES ($1, $2, $3, $4)`, issuer, subject, user.ID, now)
+		return err
+	})
+	if isUniqueViolation(err) {
+		return storage.ErrUserExists
+	}
+	return err
+}
+
+func (s *Store) GetUser(ctx context.Context, id string) (*models.User, error) {
+	// anything but a UUID would fail the query instead of finding nobody
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, storage.ErrUserNotFound
+	}
+	return s.getUser(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id)
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return s.getUser(ctx, `SELECT `+userColumns+` FROM users WHERE email = $1`, email)
+}
+
+func (s *Store) GetUserByIdentity(ctx context.Context, issuer, subject string) (*models.User, error) {
+	return s.getUser(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		WHERE id = (SELECT user_id FROM user_identities WHERE issuer = $1 AND subject = $2)`, issuer, subject)
+}
+
+func (s *Store) getUser(ctx context.Context, query string, args ...any) (*models.User, error) {
+	var user models.User
+	err := s.pool.QueryRow(ctx, query, args...).Scan(
+		&user.ID, &user.Email, &user.DisplayName, &user.AvatarURL, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, storage.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *Store) UpdateUser(ctx context.Context, user *models.User) error {
+	if _, err := uuid.Parse(user.ID); err != nil {
+		return storage.ErrUserNotFound
+	}
+	user.UpdatedAt = time.Now().UTC()
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE users SET email = $2, display_name = $3, avatar_url = $4, password_hash = $5, updated_at = $6
+		WHERE id = $1`,
+		user.ID, nullString(user.Email), user.DisplayName, user.AvatarURL, nullString(user.PasswordHash), user.UpdatedAt)
+	if isUniqueViolation(err) {
+		return storage.ErrUserExists
+	}
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrUserNotFound
+	}
+	return nil
+}
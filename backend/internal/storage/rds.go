@@ -2,36 +2,180 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/AnishG-git/streamify/internal/storage/models"
 	redis "github.com/redis/go-redis/v9"
 )
 
+// maxUpdateAttempts bounds how often UpdateRoom retries when the room changes while it updates it
+const maxUpdateAttempts = 10
+
+// createRoomScript adds the code ARGV[1] to the active rooms at KEYS[1] and stores the room ARGV[2]
+// at KEYS[2] in one step, unless the code is already active. It returns whether it created the room.
+var createRoomScript = redis.NewScript(`
+if redis.call("SADD", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("SET", KEYS[2], ARGV[2])
+return 1
+`)
+
+// addMemberScript stores the member ARGV[2] of room ARGV[1] with the connection details ARGV[3]
+// in the members hash at KEYS[2], and in the viewers set at KEYS[3] if ARGV[4] is "1". It refuses
+// members whose room isn't in the active rooms at KEYS[1], who are banned in the hash at KEYS[4]
+// at the unix milliseconds ARGV[6], who are already in the room, or for whose role the room holds
+// ARGV[5] members already, unless ARGV[5] is negative. It returns "ok" or why it refused.
+var addMemberScript = redis.NewScript(`
+if redis.call("SISMEMBER", KEYS[1], ARGV[1]) == 0 then
+	return "not-found"
+end
+local bannedUntil = redis.call("HGET", KEYS[4], ARGV[2])
+if bannedUntil and tonumber(bannedUntil) > tonumber(ARGV[6]) then
+	return "banned"
+end
+if redis.call("HEXISTS", KEYS[2], ARGV[2]) == 1 then
+	return "exists"
+end
+local viewer = ARGV[4] == "1"
+local capacity = tonumber(ARGV[5])
+if capacity >= 0 then
+	local viewers = redis.call("SCARD", KEYS[3])
+	local occupancy = redis.call("HLEN", KEYS[2]) - viewers
+	if viewer then
+		occupancy = viewers
+	end
+	if occupancy >= capacity then
+		return "full"
+	end
+end
+redis.call("HSET", KEYS[2], ARGV[2], ARGV[3])
+if viewer then
+	redis.call("SADD", KEYS[3], ARGV[2])
+end
+return "ok"
+`)
+
 type RDS struct {
 	cli            *redis.Client
+	keyPrefix      string
 	activeRoomsKey string
 }
 
-func NewRDS(cli *redis.Client) *RDS {
+// NewRDS creates a Redis backed Storage. Every key is namespaced with keyPrefix
+// so several deployments (or other applications) can share a Redis instance.
+func NewRDS(cli *redis.Client, keyPrefix string) *RDS {
 	return &RDS{
 		cli:            cli,
-		activeRoomsKey: "active-rooms",
+		keyPrefix:      keyPrefix,
+		activeRoomsKey: keyPrefix + "active-rooms",
+	}
+}
+
+// roomKey holds the room model as JSON
+func (r *RDS) roomKey(roomCode string) string {
+	return r.keyPrefix + "room:" + roomCode
+}
+
+// membersKey holds a hash of member name to connection details
+func (r *RDS) membersKey(roomCode string) string {
+	return r.keyPrefix + "room:" + roomCode + ":members"
+}
+
+// viewersKey holds the names of the room's members who joined as viewers
+func (r *RDS) viewersKey(roomCode string) string {
+	return r.keyPrefix + "room:" + roomCode + ":viewers"
+}
+
+func (r *RDS) CreateRoom(ctx context.Context, room *models.Room) (bool, error) {
+	marshalledRoom, err := json.Marshal(room)
+	if err != nil {
+		return false, err
+	}
+
+	return createRoomScript.Run(ctx, r.cli, []string{r.activeRoomsKey, r.roomKey(room.Code)}, room.Code, marshalledRoom).Bool()
+}
+
+func (r *RDS) DeleteRoom(ctx context.Context, roomCode string) (bool, error) {
+	pipe := r.cli.TxPipeline()
+	removed := pipe.SRem(ctx, r.activeRoomsKey, roomCode)
+	pipe.Del(ctx, r.roomKey(roomCode), r.membersKey(roomCode), r.mediaKey(roomCode), r.presenterKey(roomCode), r.presenterQueueKey(roomCode), r.controlKey(roomCode), r.chatKey(roomCode), r.handsKey(roomCode),
+		r.annotationsKey(roomCode), r.annotationSeqKey(roomCode), r.viewersKey(roomCode), r.lobbyKey(roomCode), r.breakoutsKey(roomCode), r.bansKey(roomCode))
+	pipe.ZRem(ctx, r.scheduleKey(), scheduleMember(models.RoomEventEndWarning, roomCode), scheduleMember(models.RoomEventEnd, roomCode))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
 	}
+	return removed.Val() == 1, nil
 }
 
-func (r *RDS) CreateRoom(ctx context.Context, roomCode string) error {
-	return r.cli.SAdd(ctx, r.activeRoomsKey, roomCode).Err()
+func (r *RDS) GetRoom(ctx context.Context, roomCode string) (*models.Room, error) {
+	marshalledRoom, err := r.cli.Get(ctx, r.roomKey(roomCode)).Bytes()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("room %s: %w", roomCode, ErrRoomNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var room models.Room
+	if err := json.Unmarshal(marshalledRoom, &room); err != nil {
+		return nil, err
+	}
+	return &room, nil
 }
 
-func (r *RDS) DeleteRoom(ctx context.Context, roomCode string) error {
-	return r.cli.SRem(ctx, r.activeRoomsKey, roomCode).Err()
+func (r *RDS) UpdateRoom(ctx context.Context, roomCode string, update func(room *models.Room) error) (*models.Room, error) {
+	key := r.roomKey(roomCode)
+	var updated *models.Room
+	// the transaction fails if the room changed since it was read, so no update is lost
+	txf := func(tx *redis.Tx) error {
+		marshalledRoom, err := tx.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			return fmt.Errorf("room %s: %w", roomCode, ErrRoomNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		var room models.Room
+		if err := json.Unmarshal(marshalledRoom, &room); err != nil {
+			return err
+		}
+		if err := update(&room); err != nil {
+			return err
+		}
+		marshalledRoom, err = json.Marshal(&room)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, marshalledRoom, redis.KeepTTL)
+			return nil
+		})
+		updated = &room
+		return err
+	}
+
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		err := r.cli.Watch(ctx, txf, key)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return updated, nil
+	}
+	return nil, fmt.Errorf("room %s: %w", roomCode, ErrRoomConflict)
 }
 
 func (r *RDS) IsRoomActive(ctx context.Context, roomCode string) (bool, error) {
 	return r.cli.SIsMember(ctx, r.activeRoomsKey, roomCode).Result()
 }
 
-func (r *RDS) CanUserJoinRoom(ctx context.Context, roomCode string, name string) error {
+func (r *RDS) CanUserJoinRoom(ctx context.Context, roomCode string, name string, role string, moved bool) error {
 	roomIsActive, err := r.IsRoomActive(ctx, roomCode)
 	if err != nil {
 		return err
@@ -39,46 +183,122 @@ func (r *RDS) CanUserJoinRoom(ctx context.Context, roomCode string, name string)
 	if !roomIsActive {
 		return fmt.Errorf("room %s does not exist in active set", roomCode)
 	}
+	room, err := r.GetRoom(ctx, roomCode)
+	if err != nil {
+		return err
+	}
+	if room.Settings.Locked && !moved {
+		return fmt.Errorf("room %s is locked", roomCode)
+	}
+	now := time.Now()
+	if room.StartsAt != nil && now.Before(*room.StartsAt) {
+		return fmt.Errorf("%w, it opens at %s", ErrRoomNotStarted, room.StartsAt.Format(time.RFC3339))
+	}
+	if room.EndsAt != nil && !now.Before(*room.EndsAt) {
+		return ErrRoomEnded
+	}
+	// bans hold for moved members too
+	banned, err := r.isBanned(ctx, roomCode, name, now)
+	if err != nil {
+		return err
+	}
+	if banned {
+		return ErrBanned
+	}
 	roomOccupancy, err := r.GetRoomOccupancy(ctx, roomCode)
 	if err != nil {
 		return err
 	}
-	if roomOccupancy < 2 {
-		// check if user already exists in room
-		userExists, err := r.cli.HExists(ctx, roomCode, name).Result()
-		if err != nil {
-			return err
-		}
-		if userExists {
-			return fmt.Errorf("user %s already exists in room %s", name, roomCode)
-		}
-		return nil
+	viewers, err := r.GetViewerCount(ctx, roomCode)
+	if err != nil {
+		return err
 	}
-	return fmt.Errorf("room %s is at capacity", roomCode)
+	// viewers have a capacity of their own
+	occupancy, capacity := roomOccupancy-viewers, room.Capacity
+	if role == models.RoleViewer {
+		occupancy, capacity = viewers, room.ViewerCapacity
+	}
+	if occupancy >= capacity && !moved {
+		return fmt.Errorf("room %s: %w", roomCode, ErrRoomFull)
+	}
+	// check if user already exists in room
+	userExists, err := r.cli.HExists(ctx, r.membersKey(roomCode), name).Result()
+	if err != nil {
+		return err
+	}
+	if userExists {
+		return fmt.Errorf("user %s in room %s: %w", name, roomCode, ErrMemberExists)
+	}
+	return nil
 }
 
 func (r *RDS) GetRoomOccupancy(ctx context.Context, roomCode string) (int, error) {
 	// Using HLen to get the number of fields in the hash
-	occupancy, err := r.cli.HLen(ctx, roomCode).Result()
+	occupancy, err := r.cli.HLen(ctx, r.membersKey(roomCode)).Result()
 	if err != nil {
 		return 0, err
 	}
 	return int(occupancy), nil
 }
 
-func (r *RDS) AddUserToRoom(ctx context.Context, roomCode, name, value string) error {
-	return r.cli.HSet(ctx, roomCode, name, value).Err()
+func (r *RDS) GetViewerCount(ctx context.Context, roomCode string) (int, error) {
+	viewers, err := r.cli.SCard(ctx, r.viewersKey(roomCode)).Result()
+	if err != nil {
+		return 0, err
+	}
+	return int(viewers), nil
+}
+
+func (r *RDS) AddUserToRoom(ctx context.Context, roomCode, memberID, role, connDetails string, moved bool) error {
+	room, err := r.GetRoom(ctx, roomCode)
+	if err != nil {
+		return err
+	}
+	viewer, capacity := "0", room.Capacity
+	if role == models.RoleViewer {
+		viewer, capacity = "1", room.ViewerCapacity
+	}
+	if moved {
+		capacity = -1
+	}
+
+	keys := []string{r.activeRoomsKey, r.membersKey(roomCode), r.viewersKey(roomCode), r.bansKey(roomCode)}
+	result, err := addMemberScript.Run(ctx, r.cli, keys, roomCode, memberID, connDetails, viewer, capacity, time.Now().UnixMilli()).Text()
+	if err != nil {
+		return err
+	}
+	switch result {
+	case "ok":
+		return nil
+	case "not-found":
+		return fmt.Errorf("room %s: %w", roomCode, ErrRoomNotFound)
+	case "banned":
+		return ErrBanned
+	case "exists":
+		return fmt.Errorf("user %s in room %s: %w", memberID, roomCode, ErrMemberExists)
+	case "full":
+		return fmt.Errorf("room %s: %w", roomCode, ErrRoomFull)
+	default:
+		return fmt.Errorf("unexpected result %q adding %s to room %s", result, memberID, roomCode)
+	}
 }
 
 func (r *RDS) RemoveUserFromRoom(ctx context.Context, roomCode, name string) error {
-	return r.cli.HDel(ctx, roomCode, name).Err()
+	// what the member was publishing goes with them
+	pipe := r.cli.TxPipeline()
+	pipe.HDel(ctx, r.membersKey(roomCode), name)
+	pipe.HDel(ctx, r.mediaKey(roomCode), name)
+	pipe.HDel(ctx, r.handsKey(roomCode), name)
+	pipe.SRem(ctx, r.viewersKey(roomCode), name)
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
 func (r *RDS) GetUserConnectionDetails(ctx context.Context, roomCode, name string) (string, error) {
 	// Using HGet to retrieve a field from the hash
-	connDetails, err := r.cli.HGet(ctx, roomCode, name).Result()
+	connDetails, err := r.cli.HGet(ctx, r.membersKey(roomCode), name).Result()
 	if err == redis.Nil {
-		return "", fmt.Errorf("user %s not found in room %s", name, roomCode)
+		return "", fmt.Errorf("user %s in room %s: %w", name, roomCode, ErrMemberNotFound)
 	}
 	if err != nil {
 		return "", err
@@ -88,5 +308,22 @@ func (r *RDS) GetUserConnectionDetails(ctx context.Context, roomCode, name strin
 
 func (r *RDS) GetUserNamesFromRoom(ctx context.Context, roomCode string) ([]string, error) {
 	// Using HKeys to get all the fields in the hash
-	return r.cli.HKeys(ctx, roomCode).Result()
+	return r.cli.HKeys(ctx, r.membersKey(roomCode)).Result()
+}
+
+func (r *RDS) GetMembers(ctx context.Context, roomCode string) (map[string]*models.ConnectionDetails, error) {
+	marshalledMembers, err := r.cli.HGetAll(ctx, r.membersKey(roomCode)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	members := make(map[string]*models.ConnectionDetails, len(marshalledMembers))
+	for memberID, marshalledConnDetails := range marshalledMembers {
+		var connDetails models.ConnectionDetails
+		if err := json.Unmarshal([]byte(marshalledConnDetails), &connDetails); err != nil {
+			return nil, err
+		}
+		members[memberID] = &connDetails
+	}
+	return members, nil
 }
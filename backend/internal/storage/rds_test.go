@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/storage/models"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// testRDS returns storage backed by an in-memory Redis
+func testRDS(t *testing.T) *RDS {
+	t.Helper()
+	cli := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { cli.Close() })
+	return NewRDS(cli, "streamify:")
+}
+
+// createTestRoom stores an active room with the given capacities
+func createTestRoom(t *testing.T, r *RDS, capacity, viewerCapacity int) string {
+	t.Helper()
+	room := &models.Room{Code: "ROOM-" + uuid.NewString()[:8], Capacity: capacity, ViewerCapacity: viewerCapacity}
+	created, err := r.CreateRoom(context.Background(), room)
+	if err != nil || !created {
+		t.Fatalf("CreateRoom() = %v, %v", created, err)
+	}
+	return room.Code
+}
+
+func TestAddUserToRoom(t *testing.T) {
+	ctx := context.Background()
+
+	type join struct {
+		name  string
+		role  string
+		moved bool
+		want  error
+	}
+	tests := []struct {
+		name  string
+		joins []join
+	}{
+		{
+			name: "capacity",
+			joins: []join{
+				{name: "alice", role: models.RoleParticipant},
+				{name: "bob", role: models.RoleParticipant},
+				{name: "carol", role: models.RoleParticipant, want: ErrRoomFull},
+			},
+		},
+		{
+			name: "viewers have their own capacity",
+			joins: []join{
+				{name: "alice", role: models.RoleParticipant},
+				{name: "bob", role: models.RoleParticipant},
+				{name: "vic", role: models.RoleViewer},
+				{name: "val", role: models.RoleViewer, want: ErrRoomFull},
+			},
+		},
+		{
+			name: "moved members skip the capacity",
+			joins: []join{
+				{name: "alice", role: models.RoleParticipant},
+				{name: "bob", role: models.RoleParticipant},
+				{name: "carol", role: models.RoleParticipant, moved: true},
+			},
+		},
+		{
+			name: "same key",
+			joins: []join{
+				{name: "alice", role: models.RoleParticipant},
+				{name: "alice", role: models.RoleViewer, want: ErrMemberExists},
+			},
+		},
+		{
+			name: "banned",
+			joins: []join{
+				{name: "mallory", role: models.RoleParticipant, moved: true, want: ErrBanned},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRDS(t)
+			roomCode := createTestRoom(t, r, 2, 1)
+			if err := r.BanFromRoom(ctx, roomCode, "mallory", time.Now().Add(time.Minute)); err != nil {
+				t.Fatalf("BanFromRoom() = %v", err)
+			}
+			for _, join := range tt.joins {
+				err := r.AddUserToRoom(ctx, roomCode, join.name, join.role, `{"connectionID":"`+join.name+`"}`, join.moved)
+				if !errors.Is(err, join.want) {
+					t.Fatalf("AddUserToRoom(%s) = %v, want %v", join.name, err, join.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAddUserToRoomConcurrent(t *testing.T) {
+	r := testRDS(t)
+	ctx := context.Background()
+	const capacity = 3
+	roomCode := createTestRoom(t, r, capacity, 0)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// half of the joins use a name another join uses too
+			name := fmt.Sprintf("member-%d", i/2)
+			errs[i] = r.AddUserToRoom(ctx, roomCode, name, models.RoleParticipant, `{"connectionID":"`+name+`"}`, false)
+		}()
+	}
+	wg.Wait()
+
+	joined := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			joined++
+		case !errors.Is(err, ErrRoomFull) && !errors.Is(err, ErrMemberExists):
+			t.Fatalf("AddUserToRoom() = %v", err)
+		}
+	}
+	occupancy, err := r.GetRoomOccupancy(ctx, roomCode)
+	if err != nil {
+		t.Fatalf("GetRoomOccupancy() = %v", err)
+	}
+	if joined != capacity || occupancy != capacity {
+		t.Fatalf("%d joins succeeded and %d members are stored, want %d", joined, occupancy, capacity)
+	}
+}
+
+func TestDeleteRoom(t *testing.T) {
+	r := testRDS(t)
+	ctx := context.Background()
+	room := &models.Room{Code: "TEAM-STANDUP", Capacity: 1, ViewerCapacity: 1}
+	if _, err := r.CreateRoom(ctx, room); err != nil {
+		t.Fatalf("CreateRoom() = %v", err)
+	}
+	if err := r.AddUserToRoom(ctx, room.Code, "alice", models.RoleParticipant, `{"connectionID":"alice"}`, false); err != nil {
+		t.Fatalf("AddUserToRoom() = %v", err)
+	}
+	if err := r.AddUserToRoom(ctx, room.Code, "vic", models.RoleViewer, `{"connectionID":"vic"}`, false); err != nil {
+		t.Fatalf("AddUserToRoom() = %v", err)
+	}
+
+	// the room is deleted while its members are still in it, e.g. when its schedule ends
+	for i, want := range []bool{true, false} {
+		deleted, err := r.DeleteRoom(ctx, room.Code)
+		if err != nil || deleted != want {
+			t.Fatalf("DeleteRoom() call %d = %v, %v, want %v", i, deleted, err, want)
+		}
+	}
+
+	// a room created again under the same code starts out empty
+	created, err := r.CreateRoom(ctx, room)
+	if err != nil || !created {
+		t.Fatalf("CreateRoom() = %v, %v", created, err)
+	}
+	occupancy, err := r.GetRoomOccupancy(ctx, room.Code)
+	if err != nil || occupancy != 0 {
+		t.Fatalf("GetRoomOccupancy() = %d, %v, want 0", occupancy, err)
+	}
+	if err := r.AddUserToRoom(ctx, room.Code, "alice", models.RoleParticipant, `{"connectionID":"alice"}`, false); err != nil {
+		t.Fatalf("AddUserToRoom() after recreating = %v", err)
+	}
+	if err := r.AddUserToRoom(ctx, room.Code, "vic", models.RoleViewer, `{"connectionID":"vic"}`, false); err != nil {
+		t.Fatalf("AddUserToRoom() of a viewer after recreating = %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/storage/models"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// claimRoomEventsScript hides up to ARGV[3] events due by ARGV[1] in the schedule at KEYS[1]
+// until ARGV[2] and returns them with their scores. Claiming in one script means every event is
+// claimed once, and an event whose instance dies while handling it is claimed again once the
+// lease runs out.
+var claimRoomEventsScript = redis.NewScript(`
+local due = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "WITHSCORES", "LIMIT", 0, ARGV[3])
+for i = 1, #due, 2 do
+	redis.call("ZADD", KEYS[1], ARGV[2], due[i])
+end
+return due
+`)
+
+// completeRoomEventScript removes the event ARGV[1] from the schedule at KEYS[1] if it is still
+// claimed until ARGV[2], an event that was rescheduled in the meantime stays
+var completeRoomEventScript = redis.NewScript(`
+local score = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if score and tonumber(score) == tonumber(ARGV[2]) then
+	redis.call("ZREM", KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// scheduleKey holds a sorted set of "<kind>:<room code>" scored by when the event fires, in unix milliseconds
+func (r *RDS) scheduleKey() string {
+	return r.keyPrefix + "room-schedule"
+}
+
+// roomEventsChannel carries fired room events to every instance
+func (r *RDS) roomEventsChannel() string {
+	return r.keyPrefix + "room-events"
+}
+
+func scheduleMember(kind, roomCode string) string {
+	return kind + ":" + roomCode
+}
+
+func (r *RDS) ScheduleRoomEvent(ctx context.Context, event *models.RoomEvent) error {
+	return r.cli.ZAdd(ctx, r.scheduleKey(), redis.Z{
+		Score:  float64(event.At.UnixMilli()),
+		Member: scheduleMember(event.Kind, event.RoomCode),
+	}).Err()
+}
+
+func (r *RDS) ClaimRoomEvents(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.RoomEvent, error) {
+	claimedUntil := now.Add(lease)
+	due, err := claimRoomEventsScript.Run(ctx, r.cli, []string{r.scheduleKey()},
+		now.UnixMilli(), claimedUntil.UnixMilli(), limit).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*models.RoomEvent, 0, len(due)/2)
+	for i := 0; i+1 < len(due); i += 2 {
+		kind, roomCode, ok := strings.Cut(due[i], ":")
+		if !ok {
+			continue
+		}
+		at, err := strconv.ParseFloat(due[i+1], 64)
+		if err != nil {
+			continue
+		}
+		events = append(events, &models.RoomEvent{
+			Kind:         kind,
+			RoomCode:     roomCode,
+			At:           time.UnixMilli(int64(at)).UTC(),
+			ClaimedUntil: time.UnixMilli(claimedUntil.UnixMilli()).UTC(),
+		})
+	}
+	return events, nil
+}
+
+func (r *RDS) CompleteRoomEvent(ctx context.Context, event *models.RoomEvent) error {
+	return completeRoomEventScript.Run(ctx, r.cli, []string{r.scheduleKey()},
+		scheduleMember(event.Kind, event.RoomCode), event.ClaimedUntil.UnixMilli()).Err()
+}
+
+func (r *RDS) PublishRoomEvent(ctx context.Context, event *models.RoomEvent) error {
+	marshalledEvent, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return r.cli.Publish(ctx, r.roomEventsChannel(), marshalledEvent).Err()
+}
+
+func (r *RDS) SubscribeRoomEvents(ctx context.Context) (<-chan *models.RoomEvent, error) {
+	pubsub := r.cli.Subscribe(ctx, r.roomEventsChannel())
+	// waiting for the confirmation makes sure no event published after returning is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	events := make(chan *models.RoomEvent)
+	go func() {
+		defer close(events)
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+				var event models.RoomEvent
+				if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+					continue
+				}
+				select {
+				case events <- &event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
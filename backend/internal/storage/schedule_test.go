@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+func TestClaimRoomEvents(t *testing.T) {
+	ctx := context.Background()
+	r := testRDS(t)
+	now := time.Now()
+
+	claim := func(at time.Time) []*models.RoomEvent {
+		t.Helper()
+		events, err := r.ClaimRoomEvents(ctx, at, time.Minute, 10)
+		if err != nil {
+			t.Fatalf("ClaimRoomEvents() = %v", err)
+		}
+		return events
+	}
+
+	for _, event := range []*models.RoomEvent{
+		{Kind: models.RoomEventEnd, RoomCode: "ABC123", At: now.Add(-time.Second)},
+		{Kind: models.RoomEventEnd, RoomCode: "XYZ789", At: now.Add(time.Hour)},
+	} {
+		if err := r.ScheduleRoomEvent(ctx, event); err != nil {
+			t.Fatalf("ScheduleRoomEvent(%s) = %v", event.RoomCode, err)
+		}
+	}
+
+	first := claim(now)
+	if len(first) != 1 || first[0].RoomCode != "ABC123" || first[0].Kind != models.RoomEventEnd {
+		t.Fatalf("ClaimRoomEvents() = %+v, want the ABC123 end", first)
+	}
+	// another instance doesn't get the event while it is leased
+	if events := claim(now); len(events) != 0 {
+		t.Errorf("ClaimRoomEvents() during the lease = %+v, want none", events)
+	}
+
+	// the event is claimed again once an instance dies holding it
+	second := claim(now.Add(2 * time.Minute))
+	if len(second) != 1 || second[0].RoomCode != "ABC123" {
+		t.Fatalf("ClaimRoomEvents() after the lease = %+v, want the ABC123 end again", second)
+	}
+	// the instance that lost its claim can't complete the event
+	if err := r.CompleteRoomEvent(ctx, first[0]); err != nil {
+		t.Fatalf("CompleteRoomEvent() = %v", err)
+	}
+	if events := claim(now.Add(4 * time.Minute)); len(events) != 1 {
+		t.Fatalf("ClaimRoomEvents() after a stale completion = %+v, want the event still scheduled", events)
+	}
+
+	third := claim(now.Add(6 * time.Minute))
+	if err := r.CompleteRoomEvent(ctx, third[0]); err != nil {
+		t.Fatalf("CompleteRoomEvent() = %v", err)
+	}
+	if events := claim(now.Add(10 * time.Minute)); len(events) != 0 {
+		t.Errorf("ClaimRoomEvents() after completion = %+v, want none", events)
+	}
+}
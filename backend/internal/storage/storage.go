@@ -2,21 +2,157 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+var (
+	ErrRoomNotFound = errors.New("room not found")
+	// ErrRoomConflict is returned when a room keeps changing while it is updated
+	ErrRoomConflict = errors.New("room changed while it was updated")
+	// ErrAlreadyControlling is returned when granting control to a member who controls another presenter
+	ErrAlreadyControlling = errors.New("already controlling another presenter")
+	// ErrAnnotationLogFull is returned when a room's annotation log has to be cleared before drawing more
+	ErrAnnotationLogFull = errors.New("annotation log is full, it has to be cleared first")
+	// ErrRoomNotStarted is returned when joining a scheduled room before it opens
+	ErrRoomNotStarted = errors.New("room has not started yet")
+	// ErrRoomEnded is returned when joining a scheduled room after it ended
+	ErrRoomEnded = errors.New("room has ended")
+	// ErrBanned is returned when joining a room one was removed from
+	ErrBanned = errors.New("you were removed from this room and can't rejoin yet")
+	// ErrRoomFull is returned when joining a room that has no place left for the member's role
+	ErrRoomFull = errors.New("room is at capacity")
+	// ErrMemberExists is returned when joining a room someone with the same key is already in
+	ErrMemberExists = errors.New("someone with this name is already in the room")
+	// ErrMemberNotFound is returned when looking up someone who isn't in the room
+	ErrMemberNotFound = errors.New("member not found")
 )
 
 type Storage interface {
 	// Room Management
-	CreateRoom(ctx context.Context, roomCode string) error
-	DeleteRoom(ctx context.Context, roomCode string) error
+	// created is false if the room code was already taken
+	CreateRoom(ctx context.Context, room *models.Room) (created bool, err error)
+	// deleted is false if the room was already deleted, only one of several concurrent callers deletes it
+	DeleteRoom(ctx context.Context, roomCode string) (deleted bool, err error)
 	IsRoomActive(ctx context.Context, roomCode string) (bool, error)
 	GetRoomOccupancy(ctx context.Context, roomCode string) (int, error)
+	GetRoom(ctx context.Context, roomCode string) (*models.Room, error)
+	// UpdateRoom applies update to the stored room and stores the result, both in one step. update
+	// may run more than once when the room changes meanwhile, and an error from it cancels the update.
+	UpdateRoom(ctx context.Context, roomCode string, update func(room *models.Room) error) (*models.Room, error)
 
 	// User Management
-	AddUserToRoom(ctx context.Context, roomCode, username, connID string) error
+	// AddUserToRoom stores a member's marshalled models.ConnectionDetails, role is one of the
+	// models.Role constants. Members are keyed by memberID, the user ID of members who signed in
+	// and the name of guests, so members who share a display name don't clash. The capacity, bans
+	// and the key are checked in the same step as the member is stored, so concurrent joins can't
+	// overfill the room or replace each other, and ErrRoomFull, ErrBanned or ErrMemberExists is
+	// returned. moved skips the capacity like it does for CanUserJoinRoom.
+	AddUserToRoom(ctx context.Context, roomCode, memberID, role, connDetails string, moved bool) error
 	RemoveUserFromRoom(ctx context.Context, roomCode, username string) error
 	GetUserNamesFromRoom(ctx context.Context, roomCode string) ([]string, error)
 	GetUserConnectionDetails(ctx context.Context, roomCode, username string) (string, error)
+	// GetMembers returns the connection details of every member, by their key
+	GetMembers(ctx context.Context, roomCode string) (map[string]*models.ConnectionDetails, error)
+
+	// GetViewerCount returns how many of the room's members are viewers
+	GetViewerCount(ctx context.Context, roomCode string) (int, error)
+
+	// User can join room if and only if the returned error is nil.
+	// Viewers are checked against the room's viewer capacity, everyone else against its capacity.
+	// Scheduled rooms return ErrRoomNotStarted or ErrRoomEnded outside of their window. Members
+	// moved by a host are already let in, so moved skips the lock and the capacity.
+	CanUserJoinRoom(ctx context.Context, roomCode, name, role string, moved bool) error
+
+	// Media State
+	SetMediaState(ctx context.Context, roomCode, name string, state *models.MediaState) error
+	RemoveMediaState(ctx context.Context, roomCode, name string) error
+	GetMediaStates(ctx context.Context, roomCode string) (map[string]*models.MediaState, error)
+
+	// Presenter Queue
+	// ClaimPresenter makes name the room's presenter unless someone else is, and returns the presenter.
+	// It returns an empty string when the slot is free but other members are queued for it.
+	ClaimPresenter(ctx context.Context, roomCode, name string) (presenter string, err error)
+	// ReleasePresenter gives up the presenter slot if name holds it
+	ReleasePresenter(ctx context.Context, roomCode, name string) (released bool, err error)
+	// GetPresenter returns an empty string when nobody is presenting
+	GetPresenter(ctx context.Context, roomCode string) (string, error)
+	// GrantPresenter makes name the presenter, taking it out of the queue, and returns the previous presenter
+	GrantPresenter(ctx context.Context, roomCode, name string) (previous string, err error)
+	// EnqueuePresenter queues name unless it is already queued or presenting
+	EnqueuePresenter(ctx context.Context, roomCode, name string) (added bool, err error)
+	DequeuePresenter(ctx context.Context, roomCode, name string) (removed bool, err error)
+	// AdvancePresenterQueue grants the slot to the first queued member if it is free and returns who got it
+	AdvancePresenterQueue(ctx context.Context, roomCode string) (presenter string, err error)
+	GetPresenterQueue(ctx context.Context, roomCode string) ([]string, error)
+
+	// Remote Control
+	// GrantControl lets controller send input to presenter and returns the controller it replaced
+	GrantControl(ctx context.Context, roomCode, presenter, controller string) (previous string, err error)
+	// RevokeControl takes control of presenter away and returns who had it
+	RevokeControl(ctx context.Context, roomCode, presenter string) (controller string, err error)
+	// ReleaseControl gives up the controller's control and returns the presenter it controlled
+	ReleaseControl(ctx context.Context, roomCode, controller string) (presenter string, err error)
+	// GetControlledPresenter returns an empty string when controller controls nobody
+	GetControlledPresenter(ctx context.Context, roomCode, controller string) (string, error)
+
+	// Chat
+	// AddChatMessage appends a message and drops the oldest ones beyond historySize
+	AddChatMessage(ctx context.Context, roomCode string, message *models.ChatMessage, historySize int) error
+	// GetChatMessages returns up to count of the most recent messages, oldest first
+	GetChatMessages(ctx context.Context, roomCode string, count int) ([]*models.ChatMessage, error)
+
+	// Raised Hands
+	RaiseHand(ctx context.Context, roomCode, name string, raisedAt time.Time) error
+	// LowerHand reports whether the hand was raised
+	LowerHand(ctx context.Context, roomCode, name string) (lowered bool, err error)
+	// GetRaisedHands returns when each member with a raised hand raised it
+	GetRaisedHands(ctx context.Context, roomCode string) (map[string]time.Time, error)
+
+	// Bans
+	// BanFromRoom keeps name from joining the room until the given time or the room is deleted,
+	// CanUserJoinRoom returns ErrBanned for them
+	BanFromRoom(ctx context.Context, roomCode, name string, until time.Time) error
+
+	// Lobby
+	// AddKnock puts a member in the room's lobby unless someone with their name is already waiting
+	AddKnock(ctx context.Context, roomCode string, knock *models.Knock) (added bool, err error)
+	// RemoveKnock takes a member out of the lobby and returns their knock, nil if they weren't waiting.
+	// Only one of several concurrent callers gets the knock.
+	RemoveKnock(ctx context.Context, roomCode, name string) (*models.Knock, error)
+	// GetKnocks returns the members waiting in the lobby, longest waiting first
+	GetKnocks(ctx context.Context, roomCode string) ([]*models.Knock, error)
+
+	// Breakout Rooms
+	AddBreakout(ctx context.Context, parentCode, roomCode string) error
+	RemoveBreakout(ctx context.Context, parentCode, roomCode string) error
+	// GetBreakouts returns the codes of the parent's breakout rooms
+	GetBreakouts(ctx context.Context, parentCode string) ([]string, error)
+	// SetJoinPass lets name join the room once with the token whose hash is given, until ttl passes
+	SetJoinPass(ctx context.Context, roomCode, name, tokenHash string, ttl time.Duration) error
+	// ConsumeJoinPass uses up name's pass if it matches tokenHash and reports whether it did
+	ConsumeJoinPass(ctx context.Context, roomCode, name, tokenHash string) (bool, error)
+
+	// Annotations
+	// AppendAnnotation adds an annotation to the room's log and returns its sequence number.
+	// Clears always fit, anything else is rejected once the log holds maxAnnotations.
+	AppendAnnotation(ctx context.Context, roomCode string, annotation *models.Annotation, maxAnnotations int) (seq int64, err error)
+	// GetAnnotations returns the annotations after afterSeq, in order
+	GetAnnotations(ctx context.Context, roomCode string, afterSeq int64) ([]*models.Annotation, error)
 
-	// User can join room if and only if the returned error is nil
-	CanUserJoinRoom(ctx context.Context, roomCode, name string) error
+	// Schedule
+	// ScheduleRoomEvent replaces the room's pending event of the same kind
+	ScheduleRoomEvent(ctx context.Context, event *models.RoomEvent) error
+	// ClaimRoomEvents returns up to limit events due by now and hides them from other callers,
+	// even across instances, for lease. They are claimed again once the lease runs out unless
+	// they are completed or their room is deleted first.
+	ClaimRoomEvents(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.RoomEvent, error)
+	// CompleteRoomEvent removes a claimed event from the schedule, unless it was rescheduled
+	CompleteRoomEvent(ctx context.Context, event *models.RoomEvent) error
+	// PublishRoomEvent passes a fired event on to every subscriber
+	PublishRoomEvent(ctx context.Context, event *models.RoomEvent) error
+	// SubscribeRoomEvents receives the published events until ctx is done
+	SubscribeRoomEvents(ctx context.Context) (<-chan *models.RoomEvent, error)
 }
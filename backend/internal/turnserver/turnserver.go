@@ -0,0 +1,197 @@
+// Package turnserver runs an embedded STUN/TURN server for deployments that
+// don't want to operate coturn separately. It accepts the ephemeral TURN REST
+// credentials issued by the ice package and caps allocations per room.
+package turnserver
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AnishG-git/streamify/internal/ice"
+	"github.com/pion/turn/v4"
+)
+
+type Config struct {
+	// ListenAddr is the UDP and TCP address to listen on, e.g. "0.0.0.0:3478"
+	ListenAddr string
+	// PublicIP is the address relayed candidates are advertised with
+	PublicIP string
+	Realm    string
+	// Secret must match the secret used by ice.Config to sign credentials
+	Secret string
+	// RelayMinPort and RelayMaxPort bound the relay ports, any port is used when both are zero
+	RelayMinPort uint16
+	RelayMaxPort uint16
+	// RoomAllocationQuota is the most concurrent allocations a single room may hold
+	RoomAllocationQuota int
+}
+
+// reservationTTL is how long a quota approval holds a slot before its allocation is created.
+// Approvals whose allocation failed lapse after it.
+const reservationTTL = 10 * time.Second
+
+type Server struct {
+	turn   *turn.Server
+	config Config
+	logger *log.Logger
+
+	mu sync.Mutex
+	// allocations counts live allocations per room code
+	allocations map[string]int
+	// reservations are the quota approvals per room code whose allocations haven't been created yet,
+	// by when they lapse
+	reservations map[string][]time.Time
+}
+
+// Start listens on config.ListenAddr and serves STUN and TURN until Close is called
+func Start(config Config, logger *log.Logger) (*Server, error) {
+	publicIP := net.ParseIP(config.PublicIP)
+	if publicIP == nil {
+		return nil, fmt.Errorf("invalid TURN public IP %q", config.PublicIP)
+	}
+	if config.Secret == "" {
+		return nil, fmt.Errorf("embedded TURN server requires a shared secret")
+	}
+
+	udpListener, err := net.ListenPacket("udp4", config.ListenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on udp %s: %w", config.ListenAddr, err)
+	}
+	tcpListener, err := net.Listen("tcp4", config.ListenAddr)
+	if err != nil {
+		udpListener.Close()
+		return nil, fmt.Errorf("failed to listen on tcp %s: %w", config.ListenAddr, err)
+	}
+
+	s := &Server{
+		config:       config,
+		logger:       logger,
+		allocations:  make(map[string]int),
+		reservations: make(map[string][]time.Time),
+	}
+
+	s.turn, err = turn.NewServer(turn.ServerConfig{
+		Realm:        config.Realm,
+		AuthHandler:  s.authenticate,
+		QuotaHandler: s.allowAllocation,
+		EventHandler: turn.EventHandler{
+			OnAllocationCreated: func(_, _ net.Addr, _, username, _ string, _ net.Addr, _ int) {
+				s.trackAllocation(username, 1)
+			},
+			OnAllocationDeleted: func(_, _ net.Addr, _, username, _ string) {
+				s.trackAllocation(username, -1)
+			},
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{{
+			PacketConn:            udpListener,
+			RelayAddressGenerator: s.relayAddressGenerator(publicIP),
+			PermissionHandler:     permissionHandler(publicIP),
+		}},
+		ListenerConfigs: []turn.ListenerConfig{{
+			Listener:              tcpListener,
+			RelayAddressGenerator: s.relayAddressGenerator(publicIP),
+			PermissionHandler:     permissionHandler(publicIP),
+		}},
+	})
+	if err != nil {
+		udpListener.Close()
+		tcpListener.Close()
+		return nil, err
+	}
+
+	logger.Printf("Embedded TURN server listening on %s, relaying via %s", config.ListenAddr, config.PublicIP)
+	return s, nil
+}
+
+func (s *Server) Close() error {
+	return s.turn.Close()
+}
+
+func (s *Server) relayAddressGenerator(publicIP net.IP) turn.RelayAddressGenerator {
+	if s.config.RelayMinPort == 0 && s.config.RelayMaxPort == 0 {
+		return &turn.RelayAddressGeneratorStatic{
+			RelayAddress: publicIP,
+			Address:      "0.0.0.0",
+		}
+	}
+	return &turn.RelayAddressGeneratorPortRange{
+		RelayAddress: publicIP,
+		Address:      "0.0.0.0",
+		MinPort:      s.config.RelayMinPort,
+		MaxPort:      s.config.RelayMaxPort,
+	}
+}
+
+// permissionHandler only lets clients relay to public peers, so the server can't be used to reach
+// the hosts around it. Its own public IP is allowed, peers that both relay through it reach each
+// other there.
+func permissionHandler(publicIP net.IP) turn.PermissionHandler {
+	return func(clientAddr net.Addr, peerIP net.IP) bool {
+		if peerIP.Equal(publicIP) {
+			return true
+		}
+		return !peerIP.IsLoopback() && !peerIP.IsPrivate() && !peerIP.IsLinkLocalUnicast() &&
+			!peerIP.IsLinkLocalMulticast() && !peerIP.IsInterfaceLocalMulticast() && !peerIP.IsMulticast() &&
+			!peerIP.IsUnspecified()
+	}
+}
+
+// authenticate accepts unexpired credentials signed with the shared secret
+func (s *Server) authenticate(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+	if _, _, err := ice.ParseUsername(username, time.Now()); err != nil {
+		s.logger.Printf("Rejected TURN credentials from %s: %v", srcAddr, err)
+		return nil, false
+	}
+	return turn.GenerateAuthKey(username, realm, ice.Password(s.config.Secret, username)), true
+}
+
+func (s *Server) allowAllocation(username, realm string, srcAddr net.Addr) bool {
+	roomCode, _, err := ice.ParseUsername(username, time.Now())
+	if err != nil {
+		return false
+	}
+
+	// the slot is reserved right away, so concurrent requests can't all pass the check
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	reservations := slices.DeleteFunc(s.reservations[roomCode], now.After)
+	if s.allocations[roomCode]+len(reservations) >= s.config.RoomAllocationQuota {
+		s.setReservations(roomCode, reservations)
+		s.logger.Printf("Room %s reached its TURN allocation quota of %d", roomCode, s.config.RoomAllocationQuota)
+		return false
+	}
+	s.setReservations(roomCode, append(reservations, now.Add(reservationTTL)))
+	return true
+}
+
+func (s *Server) setReservations(roomCode string, reservations []time.Time) {
+	if len(reservations) == 0 {
+		delete(s.reservations, roomCode)
+		return
+	}
+	s.reservations[roomCode] = reservations
+}
+
+func (s *Server) trackAllocation(username string, delta int) {
+	// expiry doesn't matter here, a deleted allocation must be counted even if its credentials ran out
+	roomCode, _, err := ice.ParseUsername(username, time.Time{})
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// a created allocation takes the place of the oldest reservation
+	if reservations := s.reservations[roomCode]; delta > 0 && len(reservations) > 0 {
+		s.setReservations(roomCode, reservations[1:])
+	}
+	s.allocations[roomCode] += delta
+	if s.allocations[roomCode] <= 0 {
+		delete(s.allocations, roomCode)
+	}
+}
@@ -0,0 +1,194 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	redis "github.com/redis/go-redis/v9"
+)
+
+const (
+	// maxClaimedDeliveries bounds how many deliveries one poll sends
+	maxClaimedDeliveries = 50
+	// leaseMargin is added to the longest endpoint timeout to get how long a claimed delivery is hidden
+	leaseMargin = 30 * time.Second
+	// maxErrorBody bounds how much of a failed response is kept as the delivery's error
+	maxErrorBody = 256
+)
+
+type Config struct {
+	Endpoints []Endpoint
+	// PollInterval is how often each instance looks for deliveries that are due
+	PollInterval time.Duration
+}
+
+// Dispatcher queues events and delivers them. A nil Dispatcher drops every event.
+type Dispatcher struct {
+	config    Config
+	endpoints map[string]*Endpoint
+	queue     *queue
+	client    *http.Client
+	lease     time.Duration
+	logger    *log.Logger
+}
+
+func New(cli *redis.Client, keyPrefix string, config Config, logger *log.Logger) *Dispatcher {
+	d := &Dispatcher{
+		config:    config,
+		endpoints: make(map[string]*Endpoint),
+		queue:     &queue{cli: cli, keyPrefix: keyPrefix},
+		client:    &http.Client{},
+		logger:    logger,
+	}
+	var longest time.Duration
+	for i := range config.Endpoints {
+		endpoint := &config.Endpoints[i]
+		d.endpoints[endpoint.Name] = endpoint
+		longest = max(longest, time.Duration(endpoint.Timeout))
+	}
+	d.lease = longest + leaseMargin
+	return d
+}
+
+// Emit queues an event for every endpoint subscribed to its type. Failures are logged, the
+// event is lost if it can't be queued.
+func (d *Dispatcher) Emit(ctx context.Context, eventType, roomCode string, data map[string]interface{}) {
+	if d == nil {
+		return
+	}
+	event := &Event{
+		ID:        uuid.NewString(),
+		Type:      eventType,
+		RoomCode:  roomCode,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+
+	var deliveries []*delivery
+	for _, endpoint := range d.config.Endpoints {
+		if endpoint.wants(eventType) {
+			deliveries = append(deliveries, &delivery{
+				ID:       uuid.NewString(),
+				Endpoint: endpoint.Name,
+				Event:    event,
+			})
+		}
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+	if err := d.queue.push(context.WithoutCancel(ctx), deliveries, event.CreatedAt); err != nil {
+		d.logger.Printf("Failed to queue webhook event %s of room %s: %v", eventType, roomCode, err)
+	}
+}
+
+// Run sends the deliveries that are due until ctx is done. Every instance runs it, a delivery is
+// only claimed by one instance at a time.
+func (d *Dispatcher) Run(ctx context.Context) {
+	if d == nil {
+		return
+	}
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			deliveries, err := d.queue.claim(ctx, now, d.lease, maxClaimedDeliveries)
+			if err != nil {
+				d.logger.Printf("Failed to claim webhook deliveries: %v", err)
+				continue
+			}
+			for _, attempt := range deliveries {
+				go d.deliver(ctx, attempt)
+			}
+		}
+	}
+}
+
+// deliver makes one attempt and removes, reschedules or buries the delivery depending on the outcome
+func (d *Dispatcher) deliver(ctx context.Context, attempt *delivery) {
+	endpoint, ok := d.endpoints[attempt.Endpoint]
+	if !ok {
+		d.logger.Printf("Dropping webhook delivery %s to endpoint %s, which is no longer configured", attempt.ID, attempt.Endpoint)
+		d.queue.remove(ctx, attempt.ID)
+		return
+	}
+
+	attempt.Attempt++
+	err := d.send(ctx, endpoint, attempt)
+	if err == nil {
+		if err := d.queue.remove(ctx, attempt.ID); err != nil {
+			d.logger.Printf("Failed to remove webhook delivery %s: %v", attempt.ID, err)
+		}
+		return
+	}
+
+	attempt.LastError = err.Error()
+	if attempt.Attempt >= endpoint.MaxAttempts {
+		d.logger.Printf("Giving up webhook delivery %s of %s to %s after %d attempts: %v",
+			attempt.ID, attempt.Event.Type, endpoint.Name, attempt.Attempt, err)
+		if err := d.queue.bury(ctx, attempt); err != nil {
+			d.logger.Printf("Failed to bury webhook delivery %s: %v", attempt.ID, err)
+		}
+		return
+	}
+
+	wait := backoff(endpoint, attempt.Attempt)
+	d.logger.Printf("Failed to deliver webhook %s of %s to %s, retrying in %s: %v",
+		attempt.ID, attempt.Event.Type, endpoint.Name, wait.Round(time.Millisecond), err)
+	if err := d.queue.push(ctx, []*delivery{attempt}, time.Now().Add(wait)); err != nil {
+		d.logger.Printf("Failed to reschedule webhook delivery %s: %v", attempt.ID, err)
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, endpoint *Endpoint, attempt *delivery) error {
+	body, err := json.Marshal(attempt.Event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(endpoint.Timeout))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "streamify-webhooks")
+	req.Header.Set(HeaderEvent, attempt.Event.Type)
+	req.Header.Set(HeaderDelivery, attempt.ID)
+	req.Header.Set(HeaderSignature, Sign(endpoint.Secret, time.Now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	return fmt.Errorf("endpoint answered %s: %s", resp.Status, bytes.TrimSpace(snippet))
+}
+
+// backoff doubles MinBackoff with every attempt up to MaxBackoff, and waits a random
+// part of the last half so retries of many deliveries spread out
+func backoff(endpoint *Endpoint, attempt int) time.Duration {
+	wait := time.Duration(endpoint.MinBackoff)
+	for i := 1; i < attempt && wait < time.Duration(endpoint.MaxBackoff); i++ {
+		wait *= 2
+	}
+	wait = min(wait, time.Duration(endpoint.MaxBackoff))
+	return wait/2 + rand.N(wait/2+1)
+}
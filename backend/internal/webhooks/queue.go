@@ -0,0 +1,118 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// maxDeadDeliveries bounds the dead letter list, the oldest deliveries are dropped first
+const maxDeadDeliveries = 1000
+
+// claimDeliveriesScript hides up to ARGV[3] deliveries due by ARGV[1] until ARGV[2] and returns
+// their IDs and bodies. A delivery whose instance dies while sending it is claimed again once
+// the lease runs out.
+var claimDeliveriesScript = redis.NewScript(`
+local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[3])
+local claimed = {}
+for _, id in ipairs(ids) do
+	local body = redis.call("HGET", KEYS[2], id)
+	if body then
+		redis.call("ZADD", KEYS[1], ARGV[2], id)
+		table.insert(claimed, id)
+		table.insert(claimed, body)
+	else
+		redis.call("ZREM", KEYS[1], id)
+	end
+end
+return claimed
+`)
+
+// delivery is an event on its way to one endpoint
+type delivery struct {
+	ID       string `json:"id"`
+	Endpoint string `json:"endpoint"`
+	Event    *Event `json:"event"`
+	// Attempt counts the attempts made so far
+	Attempt   int    `json:"attempt"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// queue keeps deliveries in Redis, a hash of delivery ID to delivery and a sorted set of
+// delivery IDs scored by when they are due in unix milliseconds
+type queue struct {
+	cli       *redis.Client
+	keyPrefix string
+}
+
+func (q *queue) scheduleKey() string {
+	return q.keyPrefix + "webhooks:queue"
+}
+
+func (q *queue) deliveriesKey() string {
+	return q.keyPrefix + "webhooks:deliveries"
+}
+
+func (q *queue) deadKey() string {
+	return q.keyPrefix + "webhooks:dead"
+}
+
+func (q *queue) push(ctx context.Context, deliveries []*delivery, at time.Time) error {
+	pipe := q.cli.TxPipeline()
+	for _, d := range deliveries {
+		marshalledDelivery, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		pipe.HSet(ctx, q.deliveriesKey(), d.ID, marshalledDelivery)
+		pipe.ZAdd(ctx, q.scheduleKey(), redis.Z{Score: float64(at.UnixMilli()), Member: d.ID})
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (q *queue) claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*delivery, error) {
+	claimed, err := claimDeliveriesScript.Run(ctx, q.cli, []string{q.scheduleKey(), q.deliveriesKey()},
+		now.UnixMilli(), now.Add(lease).UnixMilli(), limit).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*delivery, 0, len(claimed)/2)
+	for i := 0; i+1 < len(claimed); i += 2 {
+		var d delivery
+		if err := json.Unmarshal([]byte(claimed[i+1]), &d); err != nil {
+			// a delivery that can't be read would be claimed forever
+			q.remove(ctx, claimed[i])
+			continue
+		}
+		deliveries = append(deliveries, &d)
+	}
+	return deliveries, nil
+}
+
+// remove forgets a delivery that succeeded or can't be made
+func (q *queue) remove(ctx context.Context, id string) error {
+	pipe := q.cli.TxPipeline()
+	pipe.ZRem(ctx, q.scheduleKey(), id)
+	pipe.HDel(ctx, q.deliveriesKey(), id)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// bury moves a delivery that ran out of attempts to the dead letter list
+func (q *queue) bury(ctx context.Context, d *delivery) error {
+	marshalledDelivery, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	pipe := q.cli.TxPipeline()
+	pipe.ZRem(ctx, q.scheduleKey(), d.ID)
+	pipe.HDel(ctx, q.deliveriesKey(), d.ID)
+	pipe.LPush(ctx, q.deadKey(), marshalledDelivery)
+	pipe.LTrim(ctx, q.deadKey(), 0, maxDeadDeliveries-1)
+	_, err = pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,109 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/redis/go-redis/v9"
+)
+
+// testQueue returns a queue backed by an in-memory Redis
+func testQueue(t *testing.T) *queue {
+	t.Helper()
+	cli := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { cli.Close() })
+	return &queue{cli: cli, keyPrefix: "streamify:"}
+}
+
+func TestQueueClaimLease(t *testing.T) {
+	q := testQueue(t)
+	ctx := context.Background()
+	now := time.Now()
+	lease := time.Minute
+
+	d := &delivery{ID: "delivery-1", Endpoint: "crm", Event: &Event{ID: "event-1", Type: EventRoomCreated}}
+	if err := q.push(ctx, []*delivery{d}, now); err != nil {
+		t.Fatalf("push() = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want int
+	}{
+		{name: "due", at: now, want: 1},
+		{name: "leased", at: now.Add(lease / 2), want: 0},
+		{name: "lease ran out", at: now.Add(lease + time.Second), want: 1},
+	}
+	for _, tt := range tests {
+		claimed, err := q.claim(ctx, tt.at, lease, maxClaimedDeliveries)
+		if err != nil {
+			t.Fatalf("%s: claim() = %v", tt.name, err)
+		}
+		if len(claimed) != tt.want {
+			t.Fatalf("%s: claimed %d deliveries, want %d", tt.name, len(claimed), tt.want)
+		}
+	}
+}
+
+func TestDeliverOutcomes(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		maxAttempts int
+		wantQueued  bool
+		wantDead    int64
+	}{
+		{name: "success is removed", status: http.StatusOK, maxAttempts: 3},
+		{name: "failure is retried", status: http.StatusInternalServerError, maxAttempts: 3, wantQueued: true},
+		{name: "last failure is buried", status: http.StatusInternalServerError, maxAttempts: 1, wantDead: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := testQueue(t)
+			ctx := context.Background()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			endpoint := Endpoint{
+				Name:        "crm",
+				URL:         server.URL,
+				Secret:      "secret",
+				MaxAttempts: tt.maxAttempts,
+				Timeout:     Duration(time.Second),
+				MinBackoff:  Duration(time.Minute),
+				MaxBackoff:  Duration(time.Minute),
+			}
+			d := New(q.cli, q.keyPrefix, Config{Endpoints: []Endpoint{endpoint}}, log.New(io.Discard, "", 0))
+			attempt := &delivery{ID: "delivery-1", Endpoint: "crm", Event: &Event{ID: "event-1", Type: EventRoomCreated}}
+			if err := q.push(ctx, []*delivery{attempt}, time.Now()); err != nil {
+				t.Fatalf("push() = %v", err)
+			}
+
+			d.deliver(ctx, attempt)
+
+			queued, err := q.cli.HExists(ctx, q.deliveriesKey(), attempt.ID).Result()
+			if err != nil {
+				t.Fatalf("HExists() = %v", err)
+			}
+			if queued != tt.wantQueued {
+				t.Errorf("delivery queued = %v, want %v", queued, tt.wantQueued)
+			}
+			dead, err := q.cli.LLen(ctx, q.deadKey()).Result()
+			if err != nil {
+				t.Fatalf("LLen() = %v", err)
+			}
+			if dead != tt.wantDead {
+				t.Errorf("dead letters = %d, want %d", dead, tt.wantDead)
+			}
+		})
+	}
+}
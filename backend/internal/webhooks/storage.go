@@ -0,0 +1,97 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/AnishG-git/streamify/internal/storage"
+	"github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+// Storage emits the lifecycle events of the rooms it stores. Wrapping the storage catches
+// every path that creates, joins, leaves or deletes a room, including the automatic ones.
+type Storage struct {
+	storage.Storage
+	dispatcher *Dispatcher
+}
+
+func NewStorage(s storage.Storage, dispatcher *Dispatcher) *Storage {
+	return &Storage{
+		Storage:    s,
+		dispatcher: dispatcher,
+	}
+}
+
+func (s *Storage) CreateRoom(ctx context.Context, room *models.Room) (bool, error) {
+	created, err := s.Storage.CreateRoom(ctx, room)
+	if err != nil || !created {
+		return created, err
+	}
+
+	data := map[string]interface{}{
+		"title":          room.Title,
+		"capacity":       room.Capacity,
+		"viewerCapacity": room.ViewerCapacity,
+		"mode":           room.Settings.Mode,
+		"createdBy":      room.CreatedBy,
+		"persistent":     room.Flags.Persistent,
+	}
+	if room.ParentCode != "" {
+		data["parentCode"] = room.ParentCode
+	}
+	if room.StartsAt != nil {
+		data["startsAt"] = room.StartsAt
+	}
+	if room.EndsAt != nil {
+		data["endsAt"] = room.EndsAt
+	}
+	s.dispatcher.Emit(ctx, EventRoomCreated, room.Code, data)
+	return true, nil
+}
+
+func (s *Storage) DeleteRoom(ctx context.Context, roomCode string) (bool, error) {
+	// rooms are sometimes deleted more than once, only the deletion that removed the room is an event
+	deleted, err := s.Storage.DeleteRoom(ctx, roomCode)
+	if err != nil {
+		return false, err
+	}
+	if deleted {
+		s.dispatcher.Emit(ctx, EventRoomDeleted, roomCode, nil)
+	}
+	return deleted, nil
+}
+
+func (s *Storage) AddUserToRoom(ctx context.Context, roomCode, memberID, role, connDetails string, moved bool) error {
+	// details that can't be read are refused before the member is stored, the event needs them
+	var details models.ConnectionDetails
+	if err := json.Unmarshal([]byte(connDetails), &details); err != nil {
+		return fmt.Errorf("invalid connection details of %s in room %s: %w", memberID, roomCode, err)
+	}
+	if err := s.Storage.AddUserToRoom(ctx, roomCode, memberID, role, connDetails, moved); err != nil {
+		return err
+	}
+	s.dispatcher.Emit(ctx, EventMemberJoined, roomCode, map[string]interface{}{
+		"name":        memberID,
+		"role":        role,
+		"userId":      details.UserID,
+		"displayName": details.DisplayName,
+	})
+	return nil
+}
+
+func (s *Storage) RemoveUserFromRoom(ctx context.Context, roomCode, username string) error {
+	// the role is only known while the member is still stored
+	var connDetails models.ConnectionDetails
+	if connDetailsStr, err := s.Storage.GetUserConnectionDetails(ctx, roomCode, username); err == nil {
+		json.Unmarshal([]byte(connDetailsStr), &connDetails)
+	}
+	if err := s.Storage.RemoveUserFromRoom(ctx, roomCode, username); err != nil {
+		return err
+	}
+	s.dispatcher.Emit(ctx, EventMemberLeft, roomCode, map[string]interface{}{
+		"name": username,
+		"role": connDetails.Role,
+	})
+	return nil
+}
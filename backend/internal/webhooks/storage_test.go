@@ -0,0 +1,72 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"testing"
+
+	"github.com/AnishG-git/streamify/internal/storage"
+	"github.com/AnishG-git/streamify/internal/storage/models"
+)
+
+// queuedEvents counts the queued deliveries by event type
+func queuedEvents(t *testing.T, q *queue) map[string]int {
+	t.Helper()
+	deliveries, err := q.cli.HVals(context.Background(), q.deliveriesKey()).Result()
+	if err != nil {
+		t.Fatalf("HVals() = %v", err)
+	}
+	events := make(map[string]int)
+	for _, marshalledDelivery := range deliveries {
+		var d delivery
+		if err := json.Unmarshal([]byte(marshalledDelivery), &d); err != nil {
+			t.Fatalf("failed to unmarshal delivery: %v", err)
+		}
+		events[d.Event.Type]++
+	}
+	return events
+}
+
+func TestStorageDeleteRoomEmitsOnce(t *testing.T) {
+	ctx := context.Background()
+	q := testQueue(t)
+	endpoint := Endpoint{Name: "crm", URL: "https://example.com/hook", Secret: "secret"}
+	dispatcher := New(q.cli, q.keyPrefix, Config{Endpoints: []Endpoint{endpoint}}, log.New(io.Discard, "", 0))
+	s := NewStorage(storage.NewRDS(q.cli, q.keyPrefix), dispatcher)
+
+	if _, err := s.CreateRoom(ctx, &models.Room{Code: "ROOM1", Capacity: 2}); err != nil {
+		t.Fatalf("CreateRoom() = %v", err)
+	}
+
+	// the scheduler, the owner and the last member leaving can all delete the room at once
+	var wg sync.WaitGroup
+	deleted := make([]bool, 5)
+	for i := range deleted {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			deleted[i], err = s.DeleteRoom(ctx, "ROOM1")
+			if err != nil {
+				t.Errorf("DeleteRoom() = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	deletions := 0
+	for _, d := range deleted {
+		if d {
+			deletions++
+		}
+	}
+	if deletions != 1 {
+		t.Fatalf("%d calls deleted the room, want 1", deletions)
+	}
+	if events := queuedEvents(t, q); events[EventRoomCreated] != 1 || events[EventRoomDeleted] != 1 {
+		t.Fatalf("queued events %v, want one %s and one %s", events, EventRoomCreated, EventRoomDeleted)
+	}
+}
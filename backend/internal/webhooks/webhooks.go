@@ -0,0 +1,202 @@
+// Package webhooks tells external endpoints about room lifecycle events. Every event is
+// POSTed as signed JSON to the endpoints subscribed to its type. Deliveries are queued in
+// Redis before they are attempted, so they survive restarts and are shared by every
+// instance, and failed ones are retried with exponential backoff until the endpoint's
+// attempt limit, when they are moved to a dead letter list.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EventRoomCreated  = "room.created"
+	EventRoomDeleted  = "room.deleted"
+	EventMemberJoined = "member.joined"
+	EventMemberLeft   = "member.left"
+)
+
+// headers sent with every delivery
+const (
+	HeaderSignature = "Streamify-Signature"
+	HeaderEvent     = "Streamify-Event"
+	HeaderDelivery  = "Streamify-Delivery"
+)
+
+const (
+	defaultMaxAttempts = 8
+	defaultTimeout     = 10 * time.Second
+	defaultMinBackoff  = 5 * time.Second
+	defaultMaxBackoff  = time.Hour
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Event is the JSON body of every delivery
+type Event struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	RoomCode  string                 `json:"roomCode"`
+	CreatedAt time.Time              `json:"createdAt"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// Endpoint is a receiver of events and how deliveries to it are made
+type Endpoint struct {
+	// Name identifies the endpoint in the queue and in logs, it must be unique
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Secret signs the deliveries, see Sign
+	Secret string `json:"secret"`
+	// Events are the event types sent to the endpoint, all of them if empty
+	Events []string `json:"events"`
+	// MaxAttempts is how often a delivery is tried before it is given up
+	MaxAttempts int `json:"maxAttempts"`
+	// Timeout bounds every request
+	Timeout Duration `json:"timeout"`
+	// MinBackoff is the wait before the first retry, it doubles with every attempt up to MaxBackoff
+	MinBackoff Duration `json:"minBackoff"`
+	MaxBackoff Duration `json:"maxBackoff"`
+}
+
+// Duration is a time.Duration written like "10s" in JSON
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadEndpoints reads a JSON array of endpoints from path and fills in the defaults
+func LoadEndpoints(path string) ([]Endpoint, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var endpoints []Endpoint
+	if err := json.Unmarshal(b, &endpoints); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	names := make(map[string]bool)
+	for i := range endpoints {
+		endpoint := &endpoints[i]
+		if err := endpoint.validate(); err != nil {
+			return nil, fmt.Errorf("endpoint %d: %w", i, err)
+		}
+		if names[endpoint.Name] {
+			return nil, fmt.Errorf("endpoint name %q is used twice", endpoint.Name)
+		}
+		names[endpoint.Name] = true
+	}
+	return endpoints, nil
+}
+
+func (e *Endpoint) validate() error {
+	if e.Name == "" || strings.Contains(e.Name, ":") {
+		return errors.New("name is required and can't contain a colon")
+	}
+	u, err := url.Parse(e.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url of %s must be an http or https URL", e.Name)
+	}
+	if e.Secret == "" {
+		return fmt.Errorf("secret of %s is required", e.Name)
+	}
+	if e.MaxAttempts < 0 || e.Timeout < 0 || e.MinBackoff < 0 || e.MaxBackoff < 0 {
+		return fmt.Errorf("limits of %s must not be negative", e.Name)
+	}
+
+	if e.MaxAttempts == 0 {
+		e.MaxAttempts = defaultMaxAttempts
+	}
+	if e.Timeout == 0 {
+		e.Timeout = Duration(defaultTimeout)
+	}
+	if e.MinBackoff == 0 {
+		e.MinBackoff = Duration(defaultMinBackoff)
+	}
+	if e.MaxBackoff == 0 {
+		e.MaxBackoff = Duration(defaultMaxBackoff)
+	}
+	if e.MaxBackoff < e.MinBackoff {
+		e.MaxBackoff = e.MinBackoff
+	}
+	return nil
+}
+
+// wants reports whether the endpoint is subscribed to eventType
+func (e *Endpoint) wants(eventType string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, t := range e.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the signature header of a body sent at t, "t=<unix seconds>,v1=<signature>" where
+// the signature is the hex encoded HMAC-SHA256 of "<unix seconds>.<body>" keyed with the secret
+func Sign(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + signature(secret, timestamp, body)
+}
+
+// Verify checks a signature header made by Sign. Signatures older than tolerance are rejected
+// so captured requests can't be replayed later.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var timestamp, sig string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			sig = value
+		}
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || sig == "" {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("%w: timestamp is outside the tolerance", ErrInvalidSignature)
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func signature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
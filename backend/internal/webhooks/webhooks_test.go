@@ -0,0 +1,173 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	signedAt := time.Unix(1700000000, 0)
+	body := []byte(`{"type":"room.created"}`)
+	header := Sign("secret", signedAt, body)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    []byte
+		now     time.Time
+		wantErr bool
+	}{
+		{name: "valid", secret: "secret", header: header, body: body, now: signedAt},
+		{name: "within tolerance", secret: "secret", header: header, body: body, now: signedAt.Add(4 * time.Minute)},
+		{name: "clock behind within tolerance", secret: "secret", header: header, body: body, now: signedAt.Add(-4 * time.Minute)},
+		{name: "too old", secret: "secret", header: header, body: body, now: signedAt.Add(6 * time.Minute), wantErr: true},
+		{name: "too far ahead", secret: "secret", header: header, body: body, now: signedAt.Add(-6 * time.Minute), wantErr: true},
+		{name: "wrong secret", secret: "other", header: header, body: body, now: signedAt, wantErr: true},
+		{name: "tampered body", secret: "secret", header: header, body: []byte(`{"type":"room.deleted"}`), now: signedAt, wantErr: true},
+		{name: "empty header", secret: "secret", header: "", body: body, now: signedAt, wantErr: true},
+		{name: "missing signature", secret: "secret", header: "t=1700000000", body: body, now: signedAt, wantErr: true},
+		{name: "malformed timestamp", secret: "secret", header: "t=abc,v1=00", body: body, now: signedAt, wantErr: true},
+		{name: "replayed with new timestamp", secret: "secret", header: "t=1700000100," + header[len("t=1700000000,"):], body: body, now: signedAt, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, 5*time.Minute, tt.now)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSignature) {
+					t.Fatalf("Verify() = %v, want ErrInvalidSignature", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Verify() = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	endpoint := &Endpoint{
+		MinBackoff: Duration(time.Second),
+		MaxBackoff: Duration(10 * time.Second),
+	}
+
+	tests := []struct {
+		attempt int
+		// wait is the full backoff, the result is between half of it and all of it
+		wait time.Duration
+	}{
+		{attempt: 1, wait: time.Second},
+		{attempt: 2, wait: 2 * time.Second},
+		{attempt: 3, wait: 4 * time.Second},
+		{attempt: 4, wait: 8 * time.Second},
+		{attempt: 5, wait: 10 * time.Second},
+		{attempt: 50, wait: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			got := backoff(endpoint, tt.attempt)
+			if got < tt.wait/2 || got > tt.wait {
+				t.Fatalf("backoff(attempt %d) = %v, want between %v and %v", tt.attempt, got, tt.wait/2, tt.wait)
+			}
+		}
+	}
+}
+
+func TestEndpointValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		wantErr  bool
+	}{
+		{name: "valid", endpoint: Endpoint{Name: "crm", URL: "https://example.com/hook", Secret: "s"}},
+		{name: "missing name", endpoint: Endpoint{URL: "https://example.com/hook", Secret: "s"}, wantErr: true},
+		{name: "colon in name", endpoint: Endpoint{Name: "a:b", URL: "https://example.com/hook", Secret: "s"}, wantErr: true},
+		{name: "not http", endpoint: Endpoint{Name: "crm", URL: "ftp://example.com/hook", Secret: "s"}, wantErr: true},
+		{name: "no host", endpoint: Endpoint{Name: "crm", URL: "https:///hook", Secret: "s"}, wantErr: true},
+		{name: "missing secret", endpoint: Endpoint{Name: "crm", URL: "https://example.com/hook"}, wantErr: true},
+		{name: "negative attempts", endpoint: Endpoint{Name: "crm", URL: "https://example.com/hook", Secret: "s", MaxAttempts: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.endpoint.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEndpointValidateDefaults(t *testing.T) {
+	endpoint := Endpoint{Name: "crm", URL: "https://example.com/hook", Secret: "s", MinBackoff: Duration(2 * time.Hour)}
+	if err := endpoint.validate(); err != nil {
+		t.Fatalf("validate() = %v", err)
+	}
+	if endpoint.MaxAttempts != defaultMaxAttempts || endpoint.Timeout != Duration(defaultTimeout) {
+		t.Errorf("defaults not applied: %+v", endpoint)
+	}
+	if endpoint.MaxBackoff != endpoint.MinBackoff {
+		t.Errorf("MaxBackoff = %v, want it raised to MinBackoff %v", endpoint.MaxBackoff, endpoint.MinBackoff)
+	}
+}
+
+func TestEndpointWants(t *testing.T) {
+	tests := []struct {
+		name      string
+		events    []string
+		eventType string
+		want      bool
+	}{
+		{name: "all events", events: nil, eventType: EventRoomCreated, want: true},
+		{name: "subscribed", events: []string{EventMemberJoined, EventRoomCreated}, eventType: EventRoomCreated, want: true},
+		{name: "not subscribed", events: []string{EventMemberJoined}, eventType: EventRoomDeleted, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint := &Endpoint{Events: tt.events}
+			if got := endpoint.wants(tt.eventType); got != tt.want {
+				t.Fatalf("wants(%q) = %v, want %v", tt.eventType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendSignsDelivery(t *testing.T) {
+	var verifyErr error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verifyErr = Verify("secret", r.Header.Get(HeaderSignature), body, time.Minute, time.Now())
+		if r.Header.Get(HeaderEvent) != EventRoomCreated || r.Header.Get(HeaderDelivery) != "delivery-1" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	endpoint := &Endpoint{Name: "crm", URL: server.URL, Secret: "secret", Timeout: Duration(time.Second)}
+	d := New(nil, "", Config{}, log.New(io.Discard, "", 0))
+	attempt := &delivery{ID: "delivery-1", Endpoint: "crm", Event: &Event{ID: "event-1", Type: EventRoomCreated, RoomCode: "ABC123"}}
+	if err := d.send(context.Background(), endpoint, attempt); err != nil {
+		t.Fatalf("send() = %v", err)
+	}
+	if verifyErr != nil {
+		t.Fatalf("delivery signature doesn't verify: %v", verifyErr)
+	}
+}
+
+func TestSendFailsOnErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	endpoint := &Endpoint{Name: "crm", URL: server.URL, Secret: "secret", Timeout: Duration(time.Second)}
+	d := New(nil, "", Config{}, log.New(io.Discard, "", 0))
+	attempt := &delivery{ID: "delivery-1", Endpoint: "crm", Event: &Event{ID: "event-1", Type: EventRoomCreated}}
+	if err := d.send(context.Background(), endpoint, attempt); err == nil {
+		t.Fatal("send() = nil, want an error for a 503")
+	}
+}
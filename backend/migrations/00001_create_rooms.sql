@@ -0,0 +1,24 @@
+-- +goose Up
+-- rooms holds persistent rooms, live rooms are only kept in Redis
+CREATE TABLE rooms (
+    code             TEXT PRIMARY KEY,
+    title            TEXT NOT NULL DEFAULT '',
+    capacity         INTEGER NOT NULL,
+    viewer_capacity  INTEGER NOT NULL DEFAULT 0,
+    created_by       TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMPTZ NOT NULL,
+    parent_code      TEXT,
+    starts_at        TIMESTAMPTZ,
+    ends_at          TIMESTAMPTZ,
+    owner_token_hash TEXT NOT NULL,
+    settings         JSONB NOT NULL,
+    persistent       BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- deleted rooms are kept for the record until their code is used again
+    deleted_at       TIMESTAMPTZ
+);
+
+CREATE INDEX rooms_created_by_idx ON rooms (created_by) WHERE deleted_at IS NULL;
+
+-- +goose Down
+DROP TABLE rooms;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE users (
+    id            UUID PRIMARY KEY,
+    email         TEXT UNIQUE,
+    display_name  TEXT NOT NULL,
+    avatar_url    TEXT NOT NULL DEFAULT '',
+    -- bcrypt hash, NULL for users without a password
+    password_hash TEXT,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE users;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- audit_entries is append-only, rows are never updated or deleted by the server
+CREATE TABLE audit_entries (
+    id        UUID PRIMARY KEY,
+    time      TIMESTAMPTZ NOT NULL,
+    action    TEXT NOT NULL,
+    room_code TEXT NOT NULL,
+    actor     TEXT NOT NULL DEFAULT '',
+    target    TEXT NOT NULL DEFAULT '',
+    role      TEXT NOT NULL DEFAULT '',
+    ip        TEXT NOT NULL DEFAULT '',
+    details   JSONB
+);
+
+CREATE INDEX audit_entries_time_idx ON audit_entries (time, id);
+CREATE INDEX audit_entries_room_time_idx ON audit_entries (room_code, time, id);
+
+-- +goose Down
+DROP TABLE audit_entries;
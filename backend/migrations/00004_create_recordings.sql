@@ -0,0 +1,16 @@
+-- +goose Up
+-- recordings holds the metadata of recordings, their files stay on the instance that made them
+CREATE TABLE recordings (
+    id           TEXT PRIMARY KEY,
+    room_code    TEXT NOT NULL,
+    started_by   TEXT NOT NULL,
+    started_at   TIMESTAMPTZ NOT NULL,
+    stopped_at   TIMESTAMPTZ,
+    participants TEXT[] NOT NULL DEFAULT '{}',
+    tracks       JSONB NOT NULL DEFAULT '[]'
+);
+
+CREATE INDEX recordings_room_started_idx ON recordings (room_code, started_at);
+
+-- +goose Down
+DROP TABLE recordings;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE chat_messages (
+    room_code TEXT NOT NULL,
+    id        TEXT NOT NULL,
+    name      TEXT NOT NULL,
+    text      TEXT NOT NULL,
+    sent_at   TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (room_code, id)
+);
+
+CREATE INDEX chat_messages_room_sent_idx ON chat_messages (room_code, sent_at);
+
+-- +goose Down
+DROP TABLE chat_messages;
@@ -0,0 +1,33 @@
+-- +goose Up
+-- user_identities links users to the accounts of external identity providers
+CREATE TABLE user_identities (
+    issuer     TEXT NOT NULL,
+    subject    TEXT NOT NULL,
+    user_id    UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (issuer, subject)
+);
+
+-- auth_sessions holds the sign-ins of users, only a hash of their token is stored
+CREATE TABLE auth_sessions (
+    token_hash TEXT PRIMARY KEY,
+    user_id    UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX auth_sessions_user_idx ON auth_sessions (user_id);
+
+-- rooms created by signed-in users are saved for their owner's room list, even if they aren't persistent
+ALTER TABLE rooms ADD COLUMN owner_id UUID REFERENCES users (id) ON DELETE SET NULL;
+
+CREATE INDEX rooms_owner_idx ON rooms (owner_id, created_at) WHERE deleted_at IS NULL;
+
+ALTER TABLE chat_messages ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE chat_messages DROP COLUMN display_name;
+DROP INDEX rooms_owner_idx;
+ALTER TABLE rooms DROP COLUMN owner_id;
+DROP TABLE auth_sessions;
+DROP TABLE user_identities;